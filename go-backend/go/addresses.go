@@ -2,59 +2,45 @@ package main
 
 import (
 	"errors"
+	"flag"
 	"fmt"
-	"net"
-	"strconv"
 
-	"github.com/google/gopacket"
-	"github.com/google/gopacket/pcap"
+	"github.com/Viasat/Viasat-NetworkTrafficMeter/meter"
 )
 
-// NetworkInterface stores relevant information from devices listed by pcap.FindAllDevs()
-type NetworkInterface struct {
-	Index       int
-	Description string
-	Name        string
-}
-
-// GetMacAddresses returns an array of physical hardware addresses for all devices listed in net.Interfaces().
-func GetMacAddresses() (macs []string, err error) {
-	if ifaces, err := net.Interfaces(); err != nil {
-		return macs, err
-	} else {
-		for _, device := range ifaces {
-			if device.HardwareAddr.String() != "" {
-				macs = append(macs, device.HardwareAddr.String())
-			}
-		}
-	}
-
-	return macs, nil
-}
-
-// PrintUsage prints the usage instructions for the program
-func PrintUsage() {
-	fmt.Println("Usage: go run . -i <interface> [-f <filter> -v]")
-	fmt.Println("-i <interface> - Network interface to capture packets on.")
-	fmt.Println("-legacy - Legacy mode, where the interface must be chosen from the backend.")
+// PrintUsage prints the usage instructions for the program, followed by the list of available interfaces.
+func PrintUsage(flags *flag.FlagSet) {
+	fmt.Println("Usage: go run . [command] [-i <interface>] [-x <interface>] [-f <filter>] [-F <interface>=<filter>] [-decoder <decoder>] [-D <interface>=<decoder>] [-backend <backend>] [-B <interface>=<backend>] [-fanout <number>] [-loopback] [-tunnels] [-l <address>] [-db <path>] [-rules <path>] [-flush <interval>] [-rollup <interval>] [-socket-timeout <interval>] [-accounting <mode>] [-direction <strategy>] [-aggregate <mode>] [-r <file>] [-v]")
+	fmt.Println("Commands:")
+	fmt.Println("  capture - Capture packets and serve the results (default).")
+	fmt.Println("  devices - List the available interfaces and exit.")
+	fmt.Println("Flags:")
+	flags.PrintDefaults()
 	fmt.Println("List of available interfaces: ")
+	PrintInterfaceList()
 }
 
-// GetInterface shows a list of network interfaces.
-func GetInterfaceList() (netDevices []NetworkInterface, err error) {
-	if devices, err := pcap.FindAllDevs(); err != nil {
-		return netDevices, err
+// PrintInterfaceList prints the name and description of every network interface.
+func PrintInterfaceList() {
+	if devices, err := meter.GetInterfaceList(); err != nil {
+		fmt.Println("Unable to retrieve interfaces: ", err)
 	} else {
 		for i, dev := range devices {
-			netDevices = append(netDevices, NetworkInterface{Index: i, Description: dev.Description, Name: dev.Name})
+			switch {
+			case dev.Loopback:
+				fmt.Printf("%d - %s (%s) [loopback]\n", i, dev.Description, dev.Name)
+			case dev.Tunnel:
+				fmt.Printf("%d - %s (%s) [tunnel]\n", i, dev.Description, dev.Name)
+			default:
+				fmt.Printf("%d - %s (%s)\n", i, dev.Description, dev.Name)
+			}
 		}
 	}
-	return netDevices, nil
 }
 
 // GetInterfaceFromList shows a list of network interfaces for the user to choose should they not inform one (legacy mode).
 func GetInterfaceFromList() (device string, err error) {
-	if devices, err := GetInterfaceList(); err != nil {
+	if devices, err := meter.GetInterfaceList(); err != nil {
 		return "", err
 	} else {
 		for i, dev := range devices {
@@ -76,33 +62,3 @@ func GetInterfaceFromList() (device string, err error) {
 		}
 	}
 }
-
-func GetIPs(networklayer gopacket.NetworkLayer)(string, string, error){
-	var (
-		srcIP  string
-		destIP string
-	)
-	srcIP = networklayer.NetworkFlow().Src().String()
-	destIP = networklayer.NetworkFlow().Dst().String()
-
-	return srcIP, destIP, nil
-}
-
-func GetPorts(transportLayer gopacket.TransportLayer)(uint64, uint64, error){
-	var (
-		srcPort  uint64
-		destPort uint64
-		err      error
-	)
-	srcPortStr := transportLayer.TransportFlow().Src().String()
-	destPortStr := transportLayer.TransportFlow().Dst().String()
-
-	if srcPort, err = strconv.ParseUint(srcPortStr, 10, 32); err != nil {
-		return 0, 0, err
-	}
-	if destPort, err = strconv.ParseUint(destPortStr, 10, 32); err != nil {
-		return 0, 0, err
-	}
-
-	return srcPort, destPort, nil
-}
\ No newline at end of file
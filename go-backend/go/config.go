@@ -0,0 +1,139 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Viasat/Viasat-NetworkTrafficMeter/meter"
+)
+
+// Config stores the settings of the backend, as provided on the command line.
+// The settings of the capture engine are embedded from meter.Config.
+type Config struct {
+	meter.Config
+	Command        string        // Command is the subcommand to run ("capture" or "devices")
+	ListenAddress  string        // ListenAddress is the address used by the webserver
+	DatabasePath   string        // DatabasePath is the location of the SQLite database
+	RulesPath      string        // RulesPath is the location of the application rules file, next to the database by default
+	RollupInterval time.Duration // RollupInterval is the time between rollups of the database
+	CaptureFile    string        // CaptureFile is a pcap/pcapng file to analyze instead of capturing live
+}
+
+// filterMap is a flag.Value that stores "interface=filter" pairs, so the flag can be repeated for several interfaces.
+// It also stores the "interface=decoder" pairs of the -D flag, and the "interface=backend" pairs of the -B flag.
+type filterMap map[string]string
+
+func (filters filterMap) String() string {
+	pairs := make([]string, 0, len(filters))
+	for iface, filter := range filters {
+		pairs = append(pairs, iface+"="+filter)
+	}
+	return strings.Join(pairs, " ")
+}
+
+func (filters filterMap) Set(value string) error {
+	if iface, filter, found := strings.Cut(value, "="); !found || iface == "" {
+		return fmt.Errorf("expected <interface>=<value>, got %q", value)
+	} else {
+		filters[iface] = filter
+	}
+	return nil
+}
+
+// stringList is a flag.Value that accumulates comma-separated values, so a flag can be repeated or given as a list.
+type stringList []string
+
+func (list *stringList) String() string {
+	return strings.Join(*list, ",")
+}
+
+func (list *stringList) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*list = append(*list, item)
+		}
+	}
+	return nil
+}
+
+// DefaultDatabasePath returns the location of the database when none is provided.
+func DefaultDatabasePath() string {
+	return os.Getenv("APPDATA") + "/networktrafficmeter/database.db"
+}
+
+// NewFlagSet creates the command-line flags of the backend, storing their values in the given Config.
+func NewFlagSet(config *Config) (flags *flag.FlagSet) {
+	flags = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+	flags.Var((*stringList)(&config.Interfaces), "i", "Network `interface` to capture packets on, by name or description. Can be repeated or comma-separated")
+	flags.Var((*stringList)(&config.ExcludeInterfaces), "x", "Network `interface` to exclude from capture, by name or description. Can be repeated or comma-separated")
+	flags.StringVar(&config.Filter, "f", "", "BPF `filter` applied to every capture handle")
+	flags.Var(filterMap(config.InterfaceFilters), "F", "BPF filter overriding -f for one interface, as `interface=filter`. Can be repeated")
+	flags.StringVar(&config.Decoder, "decoder", meter.DecoderGopacket, "`Decoder` of the captured packets: \"gopacket\" decodes every protocol, \"fast\" only those used for attribution, without allocating per packet")
+	flags.Var(filterMap(config.InterfaceDecoders), "D", "Decoder overriding -decoder for one interface, as `interface=decoder`. Can be repeated")
+	flags.StringVar(&config.Backend, "backend", meter.BackendPcap, "Capture `backend`: \"pcap\" uses libpcap, \"afpacket\" memory-mapped AF_PACKET rings (Linux only)")
+	flags.Var(filterMap(config.InterfaceBackends), "B", "Capture backend overriding -backend for one interface, as `interface=backend`. Can be repeated")
+	flags.IntVar(&config.Fanout, "fanout", 1, "`Number` of AF_PACKET sockets and goroutines each interface captured with the afpacket backend is spread over")
+	flags.BoolVar(&config.CaptureLoopback, "loopback", false, "Capture the loopback interface, for traffic between local processes")
+	flags.BoolVar(&config.CaptureTunnels, "tunnels", false, "Capture VPN and tunnel interfaces. Their outer packets on the other interfaces are not counted")
+	flags.StringVar(&config.ListenAddress, "l", "localhost:50000", "`Address` the webserver listens on")
+	flags.StringVar(&config.DatabasePath, "db", DefaultDatabasePath(), "`Path` of the SQLite database")
+	flags.StringVar(&config.RulesPath, "rules", "", "`Path` of the application rules file (default \"rules.json\" next to the database)")
+	flags.DurationVar(&config.FlushInterval, "flush", 5*time.Minute, "`Interval` between saves of captured data to the database")
+	flags.DurationVar(&config.RollupInterval, "rollup", time.Hour, "`Interval` between rollups of the database")
+	flags.DurationVar(&config.SocketTimeout, "socket-timeout", 30*time.Second, "`Interval` a closed socket is still attributed to its process")
+	flags.StringVar(&config.Accounting, "accounting", meter.AccountingPayload, "`Mode` used to count traffic: \"payload\" counts application data, \"ip\" whole IP packets, \"wire\" whole frames")
+	flags.StringVar(&config.Direction, "direction", meter.DirectionAuto, "`Strategy` telling uploads from downloads: \"ip\" matches the local IP addresses, \"mac\" the local MAC addresses, \"auto\" both")
+	flags.StringVar(&config.Aggregate, "aggregate", meter.AggregateProcess, "`Mode` naming the traffic of a process: \"process\" uses its own name, \"application\" the name of its top-level application ancestor")
+	flags.StringVar(&config.CaptureFile, "r", "", "Read packets from a pcap/pcapng capture `file` instead of capturing live")
+	flags.BoolVar(&config.Verbose, "v", false, "Verbose mode, logging discarded packets and debug information")
+
+	flags.Usage = func() { PrintUsage(flags) }
+
+	return flags
+}
+
+// ParseConfig parses the command-line arguments (without the program name) into a Config.
+// The first argument may be a subcommand; "capture" is assumed when none is given.
+func ParseConfig(args []string) (config Config, err error) {
+	config.Command = "capture"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		config.Command, args = args[0], args[1:]
+	}
+
+	if config.Command != "capture" && config.Command != "devices" {
+		return config, fmt.Errorf("unknown command %q", config.Command)
+	}
+
+	config.InterfaceFilters = make(map[string]string)
+	config.InterfaceDecoders = make(map[string]string)
+	config.InterfaceBackends = make(map[string]string)
+
+	flags := NewFlagSet(&config)
+	if err = flags.Parse(args); err != nil {
+		return config, err
+	}
+
+	if flags.NArg() > 0 {
+		return config, fmt.Errorf("unexpected argument %q", flags.Arg(0))
+	}
+
+	// Check the settings before opening any handle
+	if err = config.Validate(); err != nil {
+		return config, err
+	}
+
+	if config.RulesPath == "" {
+		config.RulesPath = filepath.Join(filepath.Dir(config.DatabasePath), "rules.json")
+	}
+
+	if config.RollupInterval <= 0 {
+		return config, fmt.Errorf("intervals must be greater than zero")
+	}
+
+	return config, nil
+}
@@ -6,12 +6,23 @@ import (
 	"log"
 	_ "modernc.org/sqlite"
 	"os"
+	"path/filepath"
 	"time"
+
+	"github.com/Viasat/Viasat-NetworkTrafficMeter/meter"
 )
 
-// OpenDatabase opens the local database (or creates one if it doens't exist) and returns a database handle.
-func OpenDatabase() (db *sql.DB, err error) {
-	db, err = sql.Open("sqlite", os.Getenv("APPDATA")+"/networktrafficmeter/database.db")
+// OpenDatabase opens the database at the given path (or creates one if it doens't exist) and returns a database handle.
+// The services table names the protocols recorded by older versions.
+func OpenDatabase(path string, services *meter.Services) (db *sql.DB, err error) {
+	// Create the database's directory if it doesn't exist
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	if db, err = sql.Open("sqlite", path); err != nil {
+		return nil, err
+	}
 
 	if err = createActiveProcessTable(db); err != nil {
 		return nil, err
@@ -21,7 +32,7 @@ func OpenDatabase() (db *sql.DB, err error) {
 		return nil, err
 	}
 
-	if err = createProtocolDataTable(db); err != nil {
+	if err = createProtocolDataTable(db, services); err != nil {
 		return nil, err
 	}
 
@@ -29,6 +40,22 @@ func OpenDatabase() (db *sql.DB, err error) {
 		return nil, err
 	}
 
+	if err = createUserDataTable(db); err != nil {
+		return nil, err
+	}
+
+	if err = createCgroupDataTable(db); err != nil {
+		return nil, err
+	}
+
+	if err = createProcessMetadataTable(db); err != nil {
+		return nil, err
+	}
+
+	if err = createApplicationDataTable(db); err != nil {
+		return nil, err
+	}
+
 	return db, err
 }
 
@@ -39,12 +66,60 @@ func createActiveProcessTable(db *sql.DB) (err error) {
 		name TEXT NOT NULL,
 		update_time INTEGER NOT NULL,
 		upload INTEGER NOT NULL,
-		download INTEGER NOT NULL
+		download INTEGER NOT NULL,
+		accounting TEXT NOT NULL DEFAULT 'payload',
+		upload_packets INTEGER NOT NULL DEFAULT 0,
+		download_packets INTEGER NOT NULL DEFAULT 0
 	);
 	`
 
-	_, err = db.Exec(createTableSQL)
+	if _, err = db.Exec(createTableSQL); err != nil {
+		return err
+	}
+
+	if err = addAccountingColumn(db, "active_process"); err != nil {
+		return err
+	}
+
+	return addPacketColumns(db, "active_process")
+}
+
+// addAccountingColumn adds the accounting mode to a table created before it was recorded. Databases created before the accounting modes only hold payload bytes.
+func addAccountingColumn(db *sql.DB, tableName string) error {
+	return addColumn(db, tableName, "accounting", "TEXT NOT NULL DEFAULT 'payload'")
+}
+
+// addPacketColumns adds the packet counters to a table created before they were recorded.
+func addPacketColumns(db *sql.DB, tableName string) error {
+	if err := addColumn(db, tableName, "upload_packets", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	return addColumn(db, tableName, "download_packets", "INTEGER NOT NULL DEFAULT 0")
+}
+
+// addColumn adds a column to a table created by an earlier version, if the column does not exist yet.
+func addColumn(db *sql.DB, tableName, columnName, definition string) error {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info(?)`, tableName)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == columnName {
+			return nil
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
 
+	_, err = db.Exec(`ALTER TABLE ` + tableName + ` ADD COLUMN ` + columnName + ` ` + definition)
 	return err
 }
 
@@ -53,21 +128,36 @@ func createProcessDataTable(db *sql.DB) (err error) {
 	CREATE TABLE IF NOT EXISTS process_data (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		pid INTEGER NOT NULL,
+		creation_time INTEGER NOT NULL DEFAULT 0,
 		upload INTEGER NOT NULL,
 		download INTEGER NOT NULL,
 		update_time INTEGER NOT NULL,
 		active_process_name TEXT NOT NULL,
+		accounting TEXT NOT NULL DEFAULT 'payload',
+		upload_packets INTEGER NOT NULL DEFAULT 0,
+		download_packets INTEGER NOT NULL DEFAULT 0,
 		FOREIGN KEY (update_time, active_process_name) REFERENCES active_process (update_time, name)
 		ON DELETE CASCADE
 	);
 	`
 
-	_, err = db.Exec(createTableSQL)
+	if _, err = db.Exec(createTableSQL); err != nil {
+		return err
+	}
+
+	if err = addPacketColumns(db, "process_data"); err != nil {
+		return err
+	}
 
-	return err
+	if err = addAccountingColumn(db, "process_data"); err != nil {
+		return err
+	}
+
+	// Rows stored before process instances were told apart have a creation time of 0
+	return addColumn(db, "process_data", "creation_time", "INTEGER NOT NULL DEFAULT 0")
 }
 
-func createProtocolDataTable(db *sql.DB) (err error) {
+func createProtocolDataTable(db *sql.DB, services *meter.Services) (err error) {
 	createTableSQL := `
 	CREATE TABLE IF NOT EXISTS protocol_data (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -76,14 +166,74 @@ func createProtocolDataTable(db *sql.DB) (err error) {
 		download INTEGER NOT NULL,
 		update_time INTEGER NOT NULL,
 		active_process_name TEXT NOT NULL,
+		accounting TEXT NOT NULL DEFAULT 'payload',
+		upload_packets INTEGER NOT NULL DEFAULT 0,
+		download_packets INTEGER NOT NULL DEFAULT 0,
+		service TEXT NOT NULL DEFAULT '',
 		FOREIGN KEY (update_time, active_process_name) REFERENCES active_process (update_time, name)
 		ON DELETE CASCADE
 	);
 	`
 
-	_, err = db.Exec(createTableSQL)
+	if _, err = db.Exec(createTableSQL); err != nil {
+		return err
+	}
 
-	return err
+	if err = addPacketColumns(db, "protocol_data"); err != nil {
+		return err
+	}
+
+	if err = addAccountingColumn(db, "protocol_data"); err != nil {
+		return err
+	}
+
+	if err = addColumn(db, "protocol_data", "service", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	return migrateLegacyProtocols(db, services)
+}
+
+// migrateLegacyProtocols gives a service name to the protocols recorded before transports were told apart, whose name is a bare port such as "443".
+// Their transport is unknown, so a port is only named if its TCP and UDP services agree or only one of them exists; the others keep their bare port.
+func migrateLegacyProtocols(db *sql.DB, services *meter.Services) error {
+	rows, err := db.Query(`SELECT DISTINCT protocol_name FROM protocol_data WHERE service = '' AND protocol_name <> '' AND protocol_name NOT GLOB '*[^0-9]*'`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var ports []string
+	for rows.Next() {
+		var port string
+		if err = rows.Scan(&port); err != nil {
+			return err
+		}
+		ports = append(ports, port)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, port := range ports {
+		tcp, udp := services.Lookup("tcp/"+port), services.Lookup("udp/"+port)
+
+		service := tcp
+		if tcp == "" {
+			service = udp
+		} else if udp != "" && udp != tcp {
+			continue
+		}
+		if service == "" {
+			continue
+		}
+
+		if _, err = db.Exec(`UPDATE protocol_data SET service = ? WHERE protocol_name = ? AND service = ''`, service, port); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 func createHostDataTable(db *sql.DB) (err error) {
@@ -95,18 +245,172 @@ func createHostDataTable(db *sql.DB) (err error) {
 		download INTEGER NOT NULL,
 		update_time INTEGER NOT NULL,
 		active_process_name TEXT NOT NULL,
+		accounting TEXT NOT NULL DEFAULT 'payload',
+		upload_packets INTEGER NOT NULL DEFAULT 0,
+		download_packets INTEGER NOT NULL DEFAULT 0,
+		FOREIGN KEY (update_time, active_process_name) REFERENCES active_process (update_time, name)
+		ON DELETE CASCADE
+	);
+	`
+
+	if _, err = db.Exec(createTableSQL); err != nil {
+		return err
+	}
+
+	if err = addPacketColumns(db, "host_data"); err != nil {
+		return err
+	}
+
+	return addAccountingColumn(db, "host_data")
+}
+
+// createUserDataTable creates the table of each ActiveProcess' traffic by the user owning its sockets.
+func createUserDataTable(db *sql.DB) (err error) {
+	createTableSQL := `
+	CREATE TABLE IF NOT EXISTS user_data (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		uid INTEGER NOT NULL,
+		username TEXT NOT NULL,
+		upload INTEGER NOT NULL,
+		download INTEGER NOT NULL,
+		update_time INTEGER NOT NULL,
+		active_process_name TEXT NOT NULL,
+		accounting TEXT NOT NULL DEFAULT 'payload',
+		upload_packets INTEGER NOT NULL DEFAULT 0,
+		download_packets INTEGER NOT NULL DEFAULT 0,
+		FOREIGN KEY (update_time, active_process_name) REFERENCES active_process (update_time, name)
+		ON DELETE CASCADE
+	);
+	`
+
+	if _, err = db.Exec(createTableSQL); err != nil {
+		return err
+	}
+
+	return addAccountingColumn(db, "user_data")
+}
+
+// createCgroupDataTable creates the table of each ActiveProcess' traffic by the container or systemd unit it runs in.
+func createCgroupDataTable(db *sql.DB) (err error) {
+	createTableSQL := `
+	CREATE TABLE IF NOT EXISTS cgroup_data (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		cgroup_name TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		upload INTEGER NOT NULL,
+		download INTEGER NOT NULL,
+		update_time INTEGER NOT NULL,
+		active_process_name TEXT NOT NULL,
+		accounting TEXT NOT NULL DEFAULT 'payload',
+		upload_packets INTEGER NOT NULL DEFAULT 0,
+		download_packets INTEGER NOT NULL DEFAULT 0,
+		FOREIGN KEY (update_time, active_process_name) REFERENCES active_process (update_time, name)
+		ON DELETE CASCADE
+	);
+	`
+
+	if _, err = db.Exec(createTableSQL); err != nil {
+		return err
+	}
+
+	return addAccountingColumn(db, "cgroup_data")
+}
+
+// createApplicationDataTable creates the table of each ActiveProcess' traffic by the application matched by the application rules and the executable matched.
+// Traffic stored before the applications were recorded is given to its process' own application, by executable, so process and exe rules still apply to it.
+func createApplicationDataTable(db *sql.DB) (err error) {
+	var existing int
+	if err = db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'application_data'`).Scan(&existing); err != nil {
+		return err
+	}
+
+	createTableSQL := `
+	CREATE TABLE IF NOT EXISTS application_data (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		application_name TEXT NOT NULL,
+		category TEXT NOT NULL,
+		exe TEXT NOT NULL,
+		upload INTEGER NOT NULL,
+		download INTEGER NOT NULL,
+		update_time INTEGER NOT NULL,
+		active_process_name TEXT NOT NULL,
+		accounting TEXT NOT NULL DEFAULT 'payload',
+		upload_packets INTEGER NOT NULL DEFAULT 0,
+		download_packets INTEGER NOT NULL DEFAULT 0,
 		FOREIGN KEY (update_time, active_process_name) REFERENCES active_process (update_time, name)
 		ON DELETE CASCADE
 	);
 	`
 
-	_, err = db.Exec(createTableSQL)
+	if _, err = db.Exec(createTableSQL); err != nil || existing > 0 {
+		return err
+	}
+
+	// Process instances share the traffic of their executable; pseudo-processes have no instances, so their whole traffic is given to them
+	backfillSQL := `
+	INSERT INTO application_data (application_name, category, exe, upload, download, update_time, active_process_name, accounting, upload_packets, download_packets)
+	SELECT p.active_process_name, '', COALESCE(pm.exe, '') AS instance_exe, SUM(p.upload), SUM(p.download), p.update_time, p.active_process_name, p.accounting, SUM(p.upload_packets), SUM(p.download_packets)
+	FROM process_data AS p
+	LEFT JOIN process_metadata AS pm ON p.pid = pm.pid AND p.creation_time = pm.creation_time
+	GROUP BY p.update_time, p.active_process_name, instance_exe, p.accounting;
+
+	INSERT INTO application_data (application_name, category, exe, upload, download, update_time, active_process_name, accounting, upload_packets, download_packets)
+	SELECT ap.name, '', '', ap.upload, ap.download, ap.update_time, ap.name, ap.accounting, ap.upload_packets, ap.download_packets
+	FROM active_process AS ap
+	WHERE NOT EXISTS (SELECT 1 FROM process_data AS p WHERE p.update_time = ap.update_time AND p.active_process_name = ap.name);
+	`
 
+	_, err = db.Exec(backfillSQL)
 	return err
 }
 
+// createProcessMetadataTable creates the table of process instances, which is not tied to any update time.
+func createProcessMetadataTable(db *sql.DB) (err error) {
+	createTableSQL := `
+	CREATE TABLE IF NOT EXISTS process_metadata (
+		pid INTEGER NOT NULL,
+		creation_time INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		exe TEXT NOT NULL DEFAULT '',
+		cmdline TEXT NOT NULL DEFAULT '',
+		username TEXT NOT NULL DEFAULT '',
+		ppid INTEGER NOT NULL DEFAULT 0,
+		application TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (pid, creation_time)
+	);
+	`
+
+	if _, err = db.Exec(createTableSQL); err != nil {
+		return err
+	}
+
+	return addColumn(db, "process_metadata", "application", "TEXT NOT NULL DEFAULT ''")
+}
+
+// InsertProcessMetadata stores the metadata of process instances, ignoring those already stored.
+func InsertProcessMetadata(db *sql.DB, metadata []*meter.ProcessMetadata) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, processMetadata := range metadata {
+		insertMetadataSQL := `
+		INSERT OR IGNORE INTO process_metadata (pid, creation_time, name, exe, cmdline, username, ppid, application)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?);
+		`
+
+		if _, err = tx.Exec(insertMetadataSQL, processMetadata.Pid, processMetadata.Creation_Time, processMetadata.Name, processMetadata.Exe, processMetadata.Cmdline, processMetadata.Username, processMetadata.Ppid, processMetadata.Application); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
 // InsertActiveProcessWithRelatedData saves the current activeProcesses buffer to the database.
-func InsertActiveProcessWithRelatedData(db *sql.DB, activeProcessesList []map[string]*ActiveProcess) error {
+func InsertActiveProcessWithRelatedData(db *sql.DB, activeProcessesList []map[string]*meter.ActiveProcess) error {
 	// Check if there any entries to save
 	if len(activeProcessesList) == 0 {
 		return nil
@@ -126,11 +430,11 @@ func InsertActiveProcessWithRelatedData(db *sql.DB, activeProcessesList []map[st
 		for _, activeProcess := range activeProcesses {
 			// Insert the ActiveProcess
 			insertActiveProcessSQL := `
-			INSERT INTO active_process (name, update_time, upload, download)
-			VALUES (?, ?, ?, ?);
+			INSERT INTO active_process (name, update_time, upload, download, accounting, upload_packets, download_packets)
+			VALUES (?, ?, ?, ?, ?, ?, ?);
 			`
 
-			_, err := tx.Exec(insertActiveProcessSQL, activeProcess.Name, activeProcess.Update_Time, activeProcess.Upload, activeProcess.Download)
+			_, err := tx.Exec(insertActiveProcessSQL, activeProcess.Name, activeProcess.Update_Time, activeProcess.Upload, activeProcess.Download, activeProcess.Accounting, activeProcess.Upload_Packets, activeProcess.Download_Packets)
 			if err != nil {
 				return err
 			}
@@ -138,11 +442,11 @@ func InsertActiveProcessWithRelatedData(db *sql.DB, activeProcessesList []map[st
 			// Insert related ProcessData records
 			for _, processData := range activeProcess.Processes {
 				insertProcessDataSQL := `
-			INSERT INTO process_data (pid, upload, download, update_time, active_process_name)
-			VALUES (?, ?, ?, ?, ?);
+			INSERT INTO process_data (pid, upload, download, update_time, active_process_name, upload_packets, download_packets, creation_time, accounting)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);
 			`
 
-				_, err := tx.Exec(insertProcessDataSQL, processData.Pid, processData.Upload, processData.Download, activeProcess.Update_Time, activeProcess.Name)
+				_, err := tx.Exec(insertProcessDataSQL, processData.Pid, processData.Upload, processData.Download, activeProcess.Update_Time, activeProcess.Name, processData.Upload_Packets, processData.Download_Packets, processData.Creation_Time, activeProcess.Accounting)
 				if err != nil {
 					return err
 				}
@@ -151,11 +455,11 @@ func InsertActiveProcessWithRelatedData(db *sql.DB, activeProcessesList []map[st
 			// Insert related ProtocolData records
 			for _, protocolData := range activeProcess.Protocols {
 				insertProtocolDataSQL := `
-			INSERT INTO protocol_data (protocol_name, upload, download, update_time, active_process_name)
-			VALUES (?, ?, ?, ?, ?);
+			INSERT INTO protocol_data (protocol_name, upload, download, update_time, active_process_name, upload_packets, download_packets, service, accounting)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);
 			`
 
-				_, err := tx.Exec(insertProtocolDataSQL, protocolData.Protocol_Name, protocolData.Upload, protocolData.Download, activeProcess.Update_Time, activeProcess.Name)
+				_, err := tx.Exec(insertProtocolDataSQL, protocolData.Protocol_Name, protocolData.Upload, protocolData.Download, activeProcess.Update_Time, activeProcess.Name, protocolData.Upload_Packets, protocolData.Download_Packets, protocolData.Service, activeProcess.Accounting)
 				if err != nil {
 					return err
 				}
@@ -164,11 +468,50 @@ func InsertActiveProcessWithRelatedData(db *sql.DB, activeProcessesList []map[st
 			// Insert related HostData records
 			for _, hostData := range activeProcess.Hosts {
 				insertHostDataSQL := `
-			INSERT INTO host_data (host_name, upload, download, update_time, active_process_name)
-			VALUES (?, ?, ?, ?, ?);
+			INSERT INTO host_data (host_name, upload, download, update_time, active_process_name, upload_packets, download_packets, accounting)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?);
+			`
+
+				_, err := tx.Exec(insertHostDataSQL, hostData.Host_Name, hostData.Upload, hostData.Download, activeProcess.Update_Time, activeProcess.Name, hostData.Upload_Packets, hostData.Download_Packets, activeProcess.Accounting)
+				if err != nil {
+					return err
+				}
+			}
+
+			// Insert related UserData records
+			for _, userData := range activeProcess.Users {
+				insertUserDataSQL := `
+			INSERT INTO user_data (uid, username, upload, download, update_time, active_process_name, upload_packets, download_packets, accounting)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);
 			`
 
-				_, err := tx.Exec(insertHostDataSQL, hostData.Host_Name, hostData.Upload, hostData.Download, activeProcess.Update_Time, activeProcess.Name)
+				_, err := tx.Exec(insertUserDataSQL, userData.Uid, userData.Username, userData.Upload, userData.Download, activeProcess.Update_Time, activeProcess.Name, userData.Upload_Packets, userData.Download_Packets, activeProcess.Accounting)
+				if err != nil {
+					return err
+				}
+			}
+
+			// Insert related CgroupData records
+			for _, cgroupData := range activeProcess.Cgroups {
+				insertCgroupDataSQL := `
+			INSERT INTO cgroup_data (cgroup_name, kind, upload, download, update_time, active_process_name, upload_packets, download_packets, accounting)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);
+			`
+
+				_, err := tx.Exec(insertCgroupDataSQL, cgroupData.Cgroup_Name, cgroupData.Kind, cgroupData.Upload, cgroupData.Download, activeProcess.Update_Time, activeProcess.Name, cgroupData.Upload_Packets, cgroupData.Download_Packets, activeProcess.Accounting)
+				if err != nil {
+					return err
+				}
+			}
+
+			// Insert related ApplicationData records
+			for _, applicationData := range activeProcess.Applications {
+				insertApplicationDataSQL := `
+			INSERT INTO application_data (application_name, category, exe, upload, download, update_time, active_process_name, upload_packets, download_packets, accounting)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+			`
+
+				_, err := tx.Exec(insertApplicationDataSQL, applicationData.Application_Name, applicationData.Category, applicationData.Exe, applicationData.Upload, applicationData.Download, activeProcess.Update_Time, activeProcess.Name, applicationData.Upload_Packets, applicationData.Download_Packets, activeProcess.Accounting)
 				if err != nil {
 					return err
 				}
@@ -184,40 +527,40 @@ func InsertActiveProcessWithRelatedData(db *sql.DB, activeProcessesList []map[st
 	return nil
 }
 
-func GetActiveProcesses(db *sql.DB) (activeProcesses []ActiveProcess, err error) {
-	selectQuery := `SELECT * FROM active_process`
+func GetActiveProcesses(db *sql.DB, rules *meter.ApplicationRules) (activeProcesses []meter.ActiveProcess, err error) {
+	selectQuery := `SELECT id, name, update_time, upload, download, accounting, upload_packets, download_packets FROM active_process`
 
-	return queryActiveProcesses(db, selectQuery)
+	return queryActiveProcesses(db, rules, selectQuery)
 }
 
-func GetActiveProcessByName(db *sql.DB, name string) (activeProcesses []ActiveProcess, err error) {
+func GetActiveProcessByName(db *sql.DB, rules *meter.ApplicationRules, name string) (activeProcesses []meter.ActiveProcess, err error) {
 	selectQuery := `
-	SELECT * FROM active_process WHERE name = ?
+	SELECT id, name, update_time, upload, download, accounting, upload_packets, download_packets FROM active_process WHERE name = ?
 	`
 
-	return queryActiveProcesses(db, selectQuery, name)
+	return queryActiveProcesses(db, rules, selectQuery, name)
 }
 
-func GetActiveProcessesByTime(db *sql.DB, initialDate, endDate int64) (activeProcesses []ActiveProcess, err error) {
+func GetActiveProcessesByTime(db *sql.DB, rules *meter.ApplicationRules, initialDate, endDate int64) (activeProcesses []meter.ActiveProcess, err error) {
 	selectQuery := `
-	SELECT * FROM active_process WHERE update_time >= ? AND update_time <= ?
+	SELECT id, name, update_time, upload, download, accounting, upload_packets, download_packets FROM active_process WHERE update_time >= ? AND update_time <= ?
 	`
 
-	return queryActiveProcesses(db, selectQuery, initialDate, endDate)
+	return queryActiveProcesses(db, rules, selectQuery, initialDate, endDate)
 }
 
-func GetActiveProcessByNameAndTime(db *sql.DB, name string, initialDate, endDate int64) (activeProcesses []ActiveProcess, err error) {
+func GetActiveProcessByNameAndTime(db *sql.DB, rules *meter.ApplicationRules, name string, initialDate, endDate int64) (activeProcesses []meter.ActiveProcess, err error) {
 	selectQuery := `
-	SELECT * FROM active_process WHERE name = ? AND update_time >= ? AND update_time <= ?
+	SELECT id, name, update_time, upload, download, accounting, upload_packets, download_packets FROM active_process WHERE name = ? AND update_time >= ? AND update_time <= ?
 	`
 
-	return queryActiveProcesses(db, selectQuery, name, initialDate, endDate)
+	return queryActiveProcesses(db, rules, selectQuery, name, initialDate, endDate)
 }
 
 // queryActiveProcesses is a helper function to execute queries related to ActiveProcesses.
 // Specifically for ActiveProcesses, additional "subqueries" are executed in sequence in order to retrieve
-// processes, hosts and protocols related to the activeProcess.
-func queryActiveProcesses(db *sql.DB, query string, args ...interface{}) (activeProcesses []ActiveProcess, err error) {
+// processes, hosts and protocols related to the activeProcess. The applications are reclassified with the given rules.
+func queryActiveProcesses(db *sql.DB, rules *meter.ApplicationRules, query string, args ...interface{}) (activeProcesses []meter.ActiveProcess, err error) {
 	var (
 		id   int       // id stores the unique id of an active_process entry from the database
 		rows *sql.Rows // rows stores the fetched rows from the query
@@ -233,7 +576,7 @@ func queryActiveProcesses(db *sql.DB, query string, args ...interface{}) (active
 	// Iterate through all resulting rows
 	for rows.Next() {
 		// Create an ActiveProcess for each row
-		var activeProcess ActiveProcess
+		var activeProcess meter.ActiveProcess
 
 		// Store the columns from the database in the ActiveProcess' attributes
 		if err = rows.Scan(
@@ -241,17 +584,23 @@ func queryActiveProcesses(db *sql.DB, query string, args ...interface{}) (active
 			&activeProcess.Name,
 			&activeProcess.Update_Time,
 			&activeProcess.Upload,
-			&activeProcess.Download); err != nil {
+			&activeProcess.Download,
+			&activeProcess.Accounting,
+			&activeProcess.Upload_Packets,
+			&activeProcess.Download_Packets); err != nil {
 			return
 		}
 
 		// Initialize the processes/protocols/hosts maps
-		activeProcess.Processes = make(map[int32]*ProcessData)
-		activeProcess.Protocols = make(map[string]*ProtocolData)
-		activeProcess.Hosts = make(map[string]*HostData)
+		activeProcess.Processes = make(map[string]*meter.ProcessData)
+		activeProcess.Protocols = make(map[string]*meter.ProtocolData)
+		activeProcess.Hosts = make(map[string]*meter.HostData)
+		activeProcess.Users = make(map[int32]*meter.UserData)
+		activeProcess.Cgroups = make(map[string]*meter.CgroupData)
+		activeProcess.Applications = make(map[string]*meter.ApplicationData)
 
 		// Run another query to pick all processes related to this ActiveProcess
-		subQuery := "SELECT pr.pid, pr.upload, pr.download FROM process_data AS pr WHERE pr.update_time = ? AND pr.active_process_name = ?"
+		subQuery := "SELECT pr.pid, pr.upload, pr.download, pr.upload_packets, pr.download_packets, pr.creation_time, pr.accounting FROM process_data AS pr WHERE pr.update_time = ? AND pr.active_process_name = ?"
 		subRows, err := db.Query(subQuery, activeProcess.Update_Time, activeProcess.Name)
 		if err != nil {
 			return activeProcesses, err
@@ -260,22 +609,26 @@ func queryActiveProcesses(db *sql.DB, query string, args ...interface{}) (active
 		// Iterate through all resulting rows
 		for subRows.Next() {
 			// Create a new ProcessData for each row
-			var processData ProcessData
+			var processData meter.ProcessData
 
 			// Store the columns from the database in the ProcessData's attributes
 			if err = subRows.Scan(
 				&processData.Pid,
 				&processData.Upload,
-				&processData.Download); err != nil {
+				&processData.Download,
+				&processData.Upload_Packets,
+				&processData.Download_Packets,
+				&processData.Creation_Time,
+				&processData.Accounting); err != nil {
 				return activeProcesses, err
 			}
 
 			// Store the ProcessData in the ActiveProcess.Processes map
-			activeProcess.Processes[processData.Pid] = &processData
+			activeProcess.Processes[meter.ProcessInstanceKey(processData.Pid, processData.Creation_Time)] = &processData
 		}
 
 		// Run another query to pick all protocols from this active process
-		subQuery = "SELECT pr.protocol_name, pr.upload, pr.download FROM protocol_data AS pr WHERE pr.update_time = ? AND pr.active_process_name = ?"
+		subQuery = "SELECT pr.protocol_name, pr.upload, pr.download, pr.upload_packets, pr.download_packets, pr.service, pr.accounting FROM protocol_data AS pr WHERE pr.update_time = ? AND pr.active_process_name = ?"
 		subRows, err = db.Query(subQuery, activeProcess.Update_Time, activeProcess.Name)
 		if err != nil {
 			return nil, err
@@ -284,13 +637,17 @@ func queryActiveProcesses(db *sql.DB, query string, args ...interface{}) (active
 		// Iterate through all resulting rows
 		for subRows.Next() {
 			// Create a new ProtocolData for each row
-			var protocolData ProtocolData
+			var protocolData meter.ProtocolData
 
 			// Store the columns from the database in the ProtocolData's attributes
 			if err = subRows.Scan(
 				&protocolData.Protocol_Name,
 				&protocolData.Upload,
-				&protocolData.Download); err != nil {
+				&protocolData.Download,
+				&protocolData.Upload_Packets,
+				&protocolData.Download_Packets,
+				&protocolData.Service,
+				&protocolData.Accounting); err != nil {
 				return nil, err
 			}
 
@@ -298,7 +655,7 @@ func queryActiveProcesses(db *sql.DB, query string, args ...interface{}) (active
 			activeProcess.Protocols[protocolData.Protocol_Name] = &protocolData
 		}
 		// Run a query to pick all hosts from this active process
-		subQuery = "SELECT h.host_name, h.upload, h.download FROM host_data AS h WHERE h.update_time = ? AND h.active_process_name = ?"
+		subQuery = "SELECT h.host_name, h.upload, h.download, h.upload_packets, h.download_packets, h.accounting FROM host_data AS h WHERE h.update_time = ? AND h.active_process_name = ?"
 		subRows, err = db.Query(subQuery, activeProcess.Update_Time, activeProcess.Name)
 		if err != nil {
 			return nil, err
@@ -307,13 +664,16 @@ func queryActiveProcesses(db *sql.DB, query string, args ...interface{}) (active
 		// Iterate through all resulting rows
 		for subRows.Next() {
 			// Create a new HostData for each row
-			var hostData HostData
+			var hostData meter.HostData
 
 			// Store the columns from the database in the HostData's attributes
 			if err = subRows.Scan(
 				&hostData.Host_Name,
 				&hostData.Upload,
-				&hostData.Download); err != nil {
+				&hostData.Download,
+				&hostData.Upload_Packets,
+				&hostData.Download_Packets,
+				&hostData.Accounting); err != nil {
 				return nil, err
 			}
 
@@ -321,6 +681,94 @@ func queryActiveProcesses(db *sql.DB, query string, args ...interface{}) (active
 			activeProcess.Hosts[hostData.Host_Name] = &hostData
 		}
 
+		// Run a query to pick all users from this active process
+		subQuery = "SELECT u.uid, u.username, u.upload, u.download, u.upload_packets, u.download_packets, u.accounting FROM user_data AS u WHERE u.update_time = ? AND u.active_process_name = ?"
+		subRows, err = db.Query(subQuery, activeProcess.Update_Time, activeProcess.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		// Iterate through all resulting rows
+		for subRows.Next() {
+			// Create a new UserData for each row
+			var userData meter.UserData
+
+			// Store the columns from the database in the UserData's attributes
+			if err = subRows.Scan(
+				&userData.Uid,
+				&userData.Username,
+				&userData.Upload,
+				&userData.Download,
+				&userData.Upload_Packets,
+				&userData.Download_Packets,
+				&userData.Accounting); err != nil {
+				return nil, err
+			}
+
+			// Store the UserData in the ActiveProcess.Users map
+			activeProcess.Users[userData.Uid] = &userData
+		}
+
+		// Run a query to pick all cgroups from this active process
+		subQuery = "SELECT c.cgroup_name, c.kind, c.upload, c.download, c.upload_packets, c.download_packets, c.accounting FROM cgroup_data AS c WHERE c.update_time = ? AND c.active_process_name = ?"
+		subRows, err = db.Query(subQuery, activeProcess.Update_Time, activeProcess.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		// Iterate through all resulting rows
+		for subRows.Next() {
+			// Create a new CgroupData for each row
+			var cgroupData meter.CgroupData
+
+			// Store the columns from the database in the CgroupData's attributes
+			if err = subRows.Scan(
+				&cgroupData.Cgroup_Name,
+				&cgroupData.Kind,
+				&cgroupData.Upload,
+				&cgroupData.Download,
+				&cgroupData.Upload_Packets,
+				&cgroupData.Download_Packets,
+				&cgroupData.Accounting); err != nil {
+				return nil, err
+			}
+
+			// Store the CgroupData in the ActiveProcess.Cgroups map
+			activeProcess.Cgroups[cgroupData.Cgroup_Name] = &cgroupData
+		}
+
+		// Run a query to pick all applications from this active process
+		subQuery = "SELECT a.application_name, a.category, a.exe, a.upload, a.download, a.upload_packets, a.download_packets, a.accounting FROM application_data AS a WHERE a.update_time = ? AND a.active_process_name = ?"
+		subRows, err = db.Query(subQuery, activeProcess.Update_Time, activeProcess.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		// Iterate through all resulting rows
+		for subRows.Next() {
+			// Create a new ApplicationData for each row
+			var applicationData meter.ApplicationData
+
+			// Store the columns from the database in the ApplicationData's attributes
+			if err = subRows.Scan(
+				&applicationData.Application_Name,
+				&applicationData.Category,
+				&applicationData.Exe,
+				&applicationData.Upload,
+				&applicationData.Download,
+				&applicationData.Upload_Packets,
+				&applicationData.Download_Packets,
+				&applicationData.Accounting); err != nil {
+				return nil, err
+			}
+
+			// Store the ApplicationData in the ActiveProcess.Applications map
+			activeProcess.Applications[meter.ApplicationKey(applicationData.Application_Name, applicationData.Exe)] = &applicationData
+		}
+
+		// Reapply the current process and exe rules to the recorded applications
+		rules.Classify(&activeProcess)
+
 		// Append the ActiveProcess into the array
 		activeProcesses = append(activeProcesses, activeProcess)
 	}
@@ -332,23 +780,31 @@ func queryActiveProcesses(db *sql.DB, query string, args ...interface{}) (active
 	return activeProcesses, nil
 }
 
-func GetProcesses(db *sql.DB) (processData []ProcessData, err error) {
-	selectQuery := `SELECT pd.pid, pd.upload, pd.download FROM process_data AS pd`
+func GetProcesses(db *sql.DB) (processData []meter.ProcessData, err error) {
+	selectQuery := `SELECT pd.pid, pd.upload, pd.download, pd.upload_packets, pd.download_packets, pd.creation_time, pd.accounting FROM process_data AS pd`
 
 	return queryProcesses(db, selectQuery)
 }
 
-func GetProcessesByPid(db *sql.DB, pid int) (processData []ProcessData, err error) {
+func GetProcessesByPid(db *sql.DB, pid int) (processData []meter.ProcessData, err error) {
 	selectQuery := `
-	SELECT pd.pid, pd.upload, pd.download FROM process_data AS pd WHERE pd.pid = ?
+	SELECT pd.pid, pd.upload, pd.download, pd.upload_packets, pd.download_packets, pd.creation_time, pd.accounting FROM process_data AS pd WHERE pd.pid = ?
 	`
 
 	return queryProcesses(db, selectQuery, pid)
 }
 
-func GetProcessesByTime(db *sql.DB, initialDate, endDate int64) (processData []ProcessData, err error) {
+func GetProcessesByInstance(db *sql.DB, pid int, creationTime int64) (processData []meter.ProcessData, err error) {
+	selectQuery := `
+	SELECT pd.pid, pd.upload, pd.download, pd.upload_packets, pd.download_packets, pd.creation_time, pd.accounting FROM process_data AS pd WHERE pd.pid = ? AND pd.creation_time = ?
+	`
+
+	return queryProcesses(db, selectQuery, pid, creationTime)
+}
+
+func GetProcessesByTime(db *sql.DB, initialDate, endDate int64) (processData []meter.ProcessData, err error) {
 	selectQuery := `
-	SELECT pd.pid, pd.upload, pd.download 
+	SELECT pd.pid, pd.upload, pd.download, pd.upload_packets, pd.download_packets, pd.creation_time, pd.accounting 
 	FROM process_data AS pd 
 	INNER JOIN active_process AS ap ON pd.update_time = ap.update_time AND pd.active_process_name = ap.name
 	WHERE ap.update_time >= ? AND ap.update_time <= ?
@@ -357,9 +813,9 @@ func GetProcessesByTime(db *sql.DB, initialDate, endDate int64) (processData []P
 	return queryProcesses(db, selectQuery, initialDate, endDate)
 }
 
-func GetProcessesByPidAndTime(db *sql.DB, pid int, initialDate, endDate int64) (processData []ProcessData, err error) {
+func GetProcessesByPidAndTime(db *sql.DB, pid int, initialDate, endDate int64) (processData []meter.ProcessData, err error) {
 	selectQuery := `
-	SELECT pd.pid, pd.upload, pd.download 
+	SELECT pd.pid, pd.upload, pd.download, pd.upload_packets, pd.download_packets, pd.creation_time, pd.accounting 
 	FROM process_data AS pd 
 	INNER JOIN active_process AS ap ON pd.update_time = ap.update_time AND pd.active_process_name = ap.name
 	WHERE pd.pid = ? AND ap.update_time >= ? AND ap.update_time <= ?
@@ -368,8 +824,43 @@ func GetProcessesByPidAndTime(db *sql.DB, pid int, initialDate, endDate int64) (
 	return queryProcesses(db, selectQuery, pid, initialDate, endDate)
 }
 
+func GetProcessesByInstanceAndTime(db *sql.DB, pid int, creationTime int64, initialDate, endDate int64) (processData []meter.ProcessData, err error) {
+	selectQuery := `
+	SELECT pd.pid, pd.upload, pd.download, pd.upload_packets, pd.download_packets, pd.creation_time, pd.accounting
+	FROM process_data AS pd
+	INNER JOIN active_process AS ap ON pd.update_time = ap.update_time AND pd.active_process_name = ap.name
+	WHERE pd.pid = ? AND pd.creation_time = ? AND ap.update_time >= ? AND ap.update_time <= ?
+	`
+
+	return queryProcesses(db, selectQuery, pid, creationTime, initialDate, endDate)
+}
+
+// GetProcessesByMetadata returns the processes run from an executable and/or by a user. Empty filters match every process.
+func GetProcessesByMetadata(db *sql.DB, exe, user string) (processData []meter.ProcessData, err error) {
+	selectQuery := `
+	SELECT pd.pid, pd.upload, pd.download, pd.upload_packets, pd.download_packets, pd.creation_time, pd.accounting
+	FROM process_data AS pd
+	INNER JOIN process_metadata AS pm ON pd.pid = pm.pid AND pd.creation_time = pm.creation_time
+	WHERE (? = '' OR pm.exe = ?) AND (? = '' OR pm.username = ?)
+	`
+
+	return queryProcesses(db, selectQuery, exe, exe, user, user)
+}
+
+func GetProcessesByMetadataAndTime(db *sql.DB, exe, user string, initialDate, endDate int64) (processData []meter.ProcessData, err error) {
+	selectQuery := `
+	SELECT pd.pid, pd.upload, pd.download, pd.upload_packets, pd.download_packets, pd.creation_time, pd.accounting
+	FROM process_data AS pd
+	INNER JOIN process_metadata AS pm ON pd.pid = pm.pid AND pd.creation_time = pm.creation_time
+	INNER JOIN active_process AS ap ON pd.update_time = ap.update_time AND pd.active_process_name = ap.name
+	WHERE (? = '' OR pm.exe = ?) AND (? = '' OR pm.username = ?) AND ap.update_time >= ? AND ap.update_time <= ?
+	`
+
+	return queryProcesses(db, selectQuery, exe, exe, user, user, initialDate, endDate)
+}
+
 // queryProcesses is a helper function to execute queries related to Processes.
-func queryProcesses(db *sql.DB, query string, args ...interface{}) (processesData []ProcessData, err error) {
+func queryProcesses(db *sql.DB, query string, args ...interface{}) (processesData []meter.ProcessData, err error) {
 	var (
 		rows *sql.Rows
 	)
@@ -384,13 +875,17 @@ func queryProcesses(db *sql.DB, query string, args ...interface{}) (processesDat
 	// Iterate through all resulting rows
 	for rows.Next() {
 		// Create a new ProcessData for each row
-		var processData ProcessData
+		var processData meter.ProcessData
 
 		// Store the columns from the database in the ProcessData's attributes
 		if err = rows.Scan(
 			&processData.Pid,
 			&processData.Upload,
-			&processData.Download); err != nil {
+			&processData.Download,
+			&processData.Upload_Packets,
+			&processData.Download_Packets,
+			&processData.Creation_Time,
+			&processData.Accounting); err != nil {
 			return
 		}
 
@@ -402,52 +897,205 @@ func queryProcesses(db *sql.DB, query string, args ...interface{}) (processesDat
 		return nil, err
 	}
 
-	return processesData, nil
+	return processesData, nil
+}
+
+func GetProtocols(db *sql.DB) (protocolData []meter.ProtocolData, err error) {
+	selectQuery := `SELECT prot.protocol_name, prot.upload, prot.download, prot.upload_packets, prot.download_packets, prot.service, prot.accounting FROM protocol_data AS prot`
+
+	return queryProtocols(db, selectQuery)
+}
+
+func GetProtocolsByName(db *sql.DB, protocol string) (protocolData []meter.ProtocolData, err error) {
+	selectQuery := `
+	SELECT prot.protocol_name, prot.upload, prot.download, prot.upload_packets, prot.download_packets, prot.service, prot.accounting FROM protocol_data AS prot WHERE prot.protocol_name = ?
+	`
+
+	return queryProtocols(db, selectQuery, protocol)
+}
+
+func GetProtocolsByTime(db *sql.DB, initialDate, endDate int64) (protocolData []meter.ProtocolData, err error) {
+	selectQuery := `
+	SELECT prot.protocol_name, prot.upload, prot.download, prot.upload_packets, prot.download_packets, prot.service, prot.accounting
+	FROM protocol_data AS prot 
+	INNER JOIN active_process AS ap ON prot.update_time = ap.update_time AND prot.active_process_name = ap.name
+	WHERE ap.update_time >= ? AND ap.update_time <= ?
+	`
+
+	return queryProtocols(db, selectQuery, initialDate, endDate)
+}
+
+func GetProtocolsByNameAndTime(db *sql.DB, protocol string, initialDate, endDate int64) (protocolData []meter.ProtocolData, err error) {
+	selectQuery := `
+	SELECT prot.protocol_name, prot.upload, prot.download, prot.upload_packets, prot.download_packets, prot.service, prot.accounting
+	FROM protocol_data AS prot 
+	INNER JOIN active_process AS ap ON prot.update_time = ap.update_time AND prot.active_process_name = ap.name
+	WHERE prot.protocol_name = ? AND ap.update_time >= ? AND ap.update_time <= ?
+	`
+
+	return queryProtocols(db, selectQuery, protocol, initialDate, endDate)
+}
+
+// queryProtocols is a helper function to execute queries related to Protocols.
+func queryProtocols(db *sql.DB, query string, args ...interface{}) (protocolsData []meter.ProtocolData, err error) {
+	var (
+		rows *sql.Rows
+	)
+
+	// Run the query to select all protocols
+	rows, err = db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Iterate through all resulting rows
+	for rows.Next() {
+		// Create a new ProtocolData for each row
+		var protocolData meter.ProtocolData
+
+		// Store the columns from the database in the ProtocolData's attributes
+		if err = rows.Scan(
+			&protocolData.Protocol_Name,
+			&protocolData.Upload,
+			&protocolData.Download,
+			&protocolData.Upload_Packets,
+			&protocolData.Download_Packets,
+			&protocolData.Service,
+			&protocolData.Accounting); err != nil {
+			return
+		}
+
+		// Append the ProtocolData into the array
+		protocolsData = append(protocolsData, protocolData)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return protocolsData, nil
+}
+
+func GetHosts(db *sql.DB) (hostsData []meter.HostData, err error) {
+	selectQuery := `SELECT h.host_name, h.upload, h.download, h.upload_packets, h.download_packets, h.accounting FROM host_data AS h`
+
+	return queryHosts(db, selectQuery)
+}
+
+func GetHostsByName(db *sql.DB, protocol string) (hostsData []meter.HostData, err error) {
+	selectQuery := `
+	SELECT h.host_name, h.upload, h.download, h.upload_packets, h.download_packets, h.accounting FROM host_data AS h WHERE h.host_name = ?
+	`
+
+	return queryHosts(db, selectQuery, protocol)
+}
+
+func GetHostsByTime(db *sql.DB, initialDate, endDate int64) (hostsData []meter.HostData, err error) {
+	selectQuery := `
+	SELECT h.host_name, h.upload, h.download, h.upload_packets, h.download_packets, h.accounting
+	FROM host_data AS h 
+	INNER JOIN active_process AS ap ON h.update_time = ap.update_time AND h.active_process_name = ap.name
+	WHERE ap.update_time >= ? AND ap.update_time <= ?
+	`
+
+	return queryHosts(db, selectQuery, initialDate, endDate)
+}
+
+func GetHostsByNameAndTime(db *sql.DB, protocol string, initialDate, endDate int64) (hostsData []meter.HostData, err error) {
+	selectQuery := `
+	SELECT h.host_name, h.upload, h.download, h.upload_packets, h.download_packets, h.accounting
+	FROM host_data AS h 
+	INNER JOIN active_process AS ap ON h.update_time = ap.update_time AND h.active_process_name = ap.name
+	WHERE h.host_name = ? AND ap.update_time >= ? AND ap.update_time <= ?
+	`
+
+	return queryHosts(db, selectQuery, protocol, initialDate, endDate)
+}
+
+// queryHosts is a helper function to execute queries related to Hosts.
+func queryHosts(db *sql.DB, query string, args ...interface{}) (hostsData []meter.HostData, err error) {
+	var (
+		rows *sql.Rows
+	)
+
+	// Run the query to select all hosts
+	rows, err = db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Iterate through all resulting rows
+	for rows.Next() {
+		// Create a new HostData for each row
+		var hostData meter.HostData
+
+		// Store the columns from the database in the HostData's attributes
+		if err = rows.Scan(
+			&hostData.Host_Name,
+			&hostData.Upload,
+			&hostData.Download,
+			&hostData.Upload_Packets,
+			&hostData.Download_Packets,
+			&hostData.Accounting); err != nil {
+			return
+		}
+
+		// Append the HostData into the array
+		hostsData = append(hostsData, hostData)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return hostsData, nil
 }
 
-func GetProtocols(db *sql.DB) (protocolData []ProtocolData, err error) {
-	selectQuery := `SELECT prot.protocol_name, prot.upload, prot.download FROM protocol_data AS prot`
+func GetCgroups(db *sql.DB) (cgroupsData []meter.CgroupData, err error) {
+	selectQuery := `SELECT c.cgroup_name, c.kind, c.upload, c.download, c.upload_packets, c.download_packets, c.accounting FROM cgroup_data AS c`
 
-	return queryProtocols(db, selectQuery)
+	return queryCgroups(db, selectQuery)
 }
 
-func GetProtocolsByName(db *sql.DB, protocol string) (protocolData []ProtocolData, err error) {
+func GetCgroupsByName(db *sql.DB, name string) (cgroupsData []meter.CgroupData, err error) {
 	selectQuery := `
-	SELECT prot.protocol_name, prot.upload, prot.download FROM protocol_data AS prot WHERE prot.protocol_name = ?
+	SELECT c.cgroup_name, c.kind, c.upload, c.download, c.upload_packets, c.download_packets, c.accounting FROM cgroup_data AS c WHERE c.cgroup_name = ?
 	`
 
-	return queryProtocols(db, selectQuery, protocol)
+	return queryCgroups(db, selectQuery, name)
 }
 
-func GetProtocolsByTime(db *sql.DB, initialDate, endDate int64) (protocolData []ProtocolData, err error) {
+func GetCgroupsByTime(db *sql.DB, initialDate, endDate int64) (cgroupsData []meter.CgroupData, err error) {
 	selectQuery := `
-	SELECT prot.protocol_name, prot.upload, prot.download
-	FROM protocol_data AS prot 
-	INNER JOIN active_process AS ap ON prot.update_time = ap.update_time AND prot.active_process_name = ap.name
+	SELECT c.cgroup_name, c.kind, c.upload, c.download, c.upload_packets, c.download_packets, c.accounting
+	FROM cgroup_data AS c 
+	INNER JOIN active_process AS ap ON c.update_time = ap.update_time AND c.active_process_name = ap.name
 	WHERE ap.update_time >= ? AND ap.update_time <= ?
 	`
 
-	return queryProtocols(db, selectQuery, initialDate, endDate)
+	return queryCgroups(db, selectQuery, initialDate, endDate)
 }
 
-func GetProtocolsByNameAndTime(db *sql.DB, protocol string, initialDate, endDate int64) (protocolData []ProtocolData, err error) {
+func GetCgroupsByNameAndTime(db *sql.DB, name string, initialDate, endDate int64) (cgroupsData []meter.CgroupData, err error) {
 	selectQuery := `
-	SELECT prot.protocol_name, prot.upload, prot.download
-	FROM protocol_data AS prot 
-	INNER JOIN active_process AS ap ON prot.update_time = ap.update_time AND prot.active_process_name = ap.name
-	WHERE prot.protocol_name = ? AND ap.update_time >= ? AND ap.update_time <= ?
+	SELECT c.cgroup_name, c.kind, c.upload, c.download, c.upload_packets, c.download_packets, c.accounting
+	FROM cgroup_data AS c 
+	INNER JOIN active_process AS ap ON c.update_time = ap.update_time AND c.active_process_name = ap.name
+	WHERE c.cgroup_name = ? AND ap.update_time >= ? AND ap.update_time <= ?
 	`
 
-	return queryProtocols(db, selectQuery, protocol, initialDate, endDate)
+	return queryCgroups(db, selectQuery, name, initialDate, endDate)
 }
 
-// queryProtocols is a helper function to execute queries related to Protocols.
-func queryProtocols(db *sql.DB, query string, args ...interface{}) (protocolsData []ProtocolData, err error) {
+// queryCgroups is a helper function to execute queries related to Cgroups.
+func queryCgroups(db *sql.DB, query string, args ...interface{}) (cgroupsData []meter.CgroupData, err error) {
 	var (
 		rows *sql.Rows
 	)
 
-	// Run the query to select all protocols
+	// Run the query to select all cgroups
 	rows, err = db.Query(query, args...)
 	if err != nil {
 		return nil, err
@@ -456,71 +1104,75 @@ func queryProtocols(db *sql.DB, query string, args ...interface{}) (protocolsDat
 
 	// Iterate through all resulting rows
 	for rows.Next() {
-		// Create a new ProtocolData for each row
-		var protocolData ProtocolData
+		// Create a new CgroupData for each row
+		var cgroupData meter.CgroupData
 
-		// Store the columns from the database in the ProtocolData's attributes
+		// Store the columns from the database in the CgroupData's attributes
 		if err = rows.Scan(
-			&protocolData.Protocol_Name,
-			&protocolData.Upload,
-			&protocolData.Download); err != nil {
+			&cgroupData.Cgroup_Name,
+			&cgroupData.Kind,
+			&cgroupData.Upload,
+			&cgroupData.Download,
+			&cgroupData.Upload_Packets,
+			&cgroupData.Download_Packets,
+			&cgroupData.Accounting); err != nil {
 			return
 		}
 
-		// Append the ProtocolData into the array
-		protocolsData = append(protocolsData, protocolData)
+		// Append the CgroupData into the array
+		cgroupsData = append(cgroupsData, cgroupData)
 	}
 
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
-	return protocolsData, nil
+	return cgroupsData, nil
 }
 
-func GetHosts(db *sql.DB) (hostsData []HostData, err error) {
-	selectQuery := `SELECT h.host_name, h.upload, h.download FROM host_data AS h`
+func GetUsers(db *sql.DB) (usersData []meter.UserData, err error) {
+	selectQuery := `SELECT u.uid, u.username, u.upload, u.download, u.upload_packets, u.download_packets, u.accounting FROM user_data AS u`
 
-	return queryHosts(db, selectQuery)
+	return queryUsers(db, selectQuery)
 }
 
-func GetHostsByName(db *sql.DB, protocol string) (hostsData []HostData, err error) {
+func GetUsersByUid(db *sql.DB, uid int) (usersData []meter.UserData, err error) {
 	selectQuery := `
-	SELECT h.host_name, h.upload, h.download FROM host_data AS h WHERE h.host_name = ?
+	SELECT u.uid, u.username, u.upload, u.download, u.upload_packets, u.download_packets, u.accounting FROM user_data AS u WHERE u.uid = ?
 	`
 
-	return queryHosts(db, selectQuery, protocol)
+	return queryUsers(db, selectQuery, uid)
 }
 
-func GetHostsByTime(db *sql.DB, initialDate, endDate int64) (hostsData []HostData, err error) {
+func GetUsersByTime(db *sql.DB, initialDate, endDate int64) (usersData []meter.UserData, err error) {
 	selectQuery := `
-	SELECT h.host_name, h.upload, h.download
-	FROM host_data AS h 
-	INNER JOIN active_process AS ap ON h.update_time = ap.update_time AND h.active_process_name = ap.name
+	SELECT u.uid, u.username, u.upload, u.download, u.upload_packets, u.download_packets, u.accounting
+	FROM user_data AS u
+	INNER JOIN active_process AS ap ON u.update_time = ap.update_time AND u.active_process_name = ap.name
 	WHERE ap.update_time >= ? AND ap.update_time <= ?
 	`
 
-	return queryHosts(db, selectQuery, initialDate, endDate)
+	return queryUsers(db, selectQuery, initialDate, endDate)
 }
 
-func GetHostsByNameAndTime(db *sql.DB, protocol string, initialDate, endDate int64) (hostsData []HostData, err error) {
+func GetUsersByUidAndTime(db *sql.DB, uid int, initialDate, endDate int64) (usersData []meter.UserData, err error) {
 	selectQuery := `
-	SELECT h.host_name, h.upload, h.download
-	FROM host_data AS h 
-	INNER JOIN active_process AS ap ON h.update_time = ap.update_time AND h.active_process_name = ap.name
-	WHERE h.host_name = ? AND ap.update_time >= ? AND ap.update_time <= ?
+	SELECT u.uid, u.username, u.upload, u.download, u.upload_packets, u.download_packets, u.accounting
+	FROM user_data AS u
+	INNER JOIN active_process AS ap ON u.update_time = ap.update_time AND u.active_process_name = ap.name
+	WHERE u.uid = ? AND ap.update_time >= ? AND ap.update_time <= ?
 	`
 
-	return queryHosts(db, selectQuery, protocol, initialDate, endDate)
+	return queryUsers(db, selectQuery, uid, initialDate, endDate)
 }
 
-// queryHosts is a helper function to execute queries related to Hosts.
-func queryHosts(db *sql.DB, query string, args ...interface{}) (hostsData []HostData, err error) {
+// queryUsers is a helper function to execute queries related to Users.
+func queryUsers(db *sql.DB, query string, args ...interface{}) (usersData []meter.UserData, err error) {
 	var (
 		rows *sql.Rows
 	)
 
-	// Run the query to select all hosts
+	// Run the query to select all users
 	rows, err = db.Query(query, args...)
 	if err != nil {
 		return nil, err
@@ -529,259 +1181,662 @@ func queryHosts(db *sql.DB, query string, args ...interface{}) (hostsData []Host
 
 	// Iterate through all resulting rows
 	for rows.Next() {
-		// Create a new HostData for each row
-		var hostData HostData
+		// Create a new UserData for each row
+		var userData meter.UserData
 
-		// Store the columns from the database in the HostData's attributes
+		// Store the columns from the database in the UserData's attributes
 		if err = rows.Scan(
-			&hostData.Host_Name,
-			&hostData.Upload,
-			&hostData.Download); err != nil {
+			&userData.Uid,
+			&userData.Username,
+			&userData.Upload,
+			&userData.Download,
+			&userData.Upload_Packets,
+			&userData.Download_Packets,
+			&userData.Accounting); err != nil {
 			return
 		}
 
-		// Append the HostData into the array
-		hostsData = append(hostsData, hostData)
+		// Append the UserData into the array
+		usersData = append(usersData, userData)
 	}
 
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
-	return hostsData, nil
+	return usersData, nil
 }
 
-func GetTotalThroughput(db *sql.DB) (interface{}, error) {
+// GetTotalThroughput returns the total throughput of the traffic counted in an accounting mode, as bytes counted in different modes cannot be summed.
+func GetTotalThroughput(db *sql.DB, accounting string) (interface{}, error) {
 	selectQuery := `
 	SELECT SUM(upload), 
 	SUM(download), 
-	SUM(upload+download) 
+	SUM(upload+download),
+	SUM(upload_packets),
+	SUM(download_packets),
+	SUM(upload_packets+download_packets) 
 	FROM active_process
+	WHERE accounting = ?
 	`
 
-	return queryStatistics(db, selectQuery)
+	return queryStatistics(db, selectQuery, accounting)
 }
 
-func GetTotalThroughputByTime(db *sql.DB, initialDate, endDate int64) (interface{}, error) {
+func GetTotalThroughputByTime(db *sql.DB, accounting string, initialDate, endDate int64) (interface{}, error) {
 	selectQuery := `
 	SELECT SUM(upload), 
 	SUM(download), 
-	SUM(upload+download) 
+	SUM(upload+download),
+	SUM(upload_packets),
+	SUM(download_packets),
+	SUM(upload_packets+download_packets) 
 	FROM active_process
-	WHERE update_time >= ? AND update_time <= ?
+	WHERE update_time >= ? AND update_time <= ? AND accounting = ?
 	`
 
-	return queryStatistics(db, selectQuery, initialDate, endDate)
+	return queryStatistics(db, selectQuery, initialDate, endDate, accounting)
 }
 
-func GetActiveProcessesThroughputByEntry(db *sql.DB) (interface{}, error) {
+func GetActiveProcessesThroughputByEntry(db *sql.DB, accounting string) (interface{}, error) {
 	selectQuery := `
 	SELECT name,
 	SUM(upload), 
 	SUM(download), 
-	SUM(upload+download) 
+	SUM(upload+download),
+	SUM(upload_packets),
+	SUM(download_packets),
+	SUM(upload_packets+download_packets) 
 	FROM active_process
+	WHERE accounting = ?
 	GROUP BY name
 	`
 
-	return queryNamedStatistics(db, selectQuery)
+	return queryNamedStatistics(db, selectQuery, accounting)
 }
 
-func GetActiveProcessesThroughputByName(db *sql.DB, name string) (interface{}, error) {
+func GetActiveProcessesThroughputByName(db *sql.DB, accounting, name string) (interface{}, error) {
 	selectQuery := `
 	SELECT name,
 	SUM(upload), 
 	SUM(download), 
-	SUM(upload+download) 
+	SUM(upload+download),
+	SUM(upload_packets),
+	SUM(download_packets),
+	SUM(upload_packets+download_packets) 
 	FROM active_process
-	WHERE name = ?
+	WHERE name = ? AND accounting = ?
 	`
 
-	return queryNamedStatistics(db, selectQuery, name)
+	return queryNamedStatistics(db, selectQuery, name, accounting)
 }
 
-func GetActiveProcessesThroughputByEntryAndTime(db *sql.DB, initialDate, endDate int64) (interface{}, error) {
+func GetActiveProcessesThroughputByEntryAndTime(db *sql.DB, accounting string, initialDate, endDate int64) (interface{}, error) {
 	selectQuery := `
 	SELECT name,
 	SUM(upload), 
 	SUM(download), 
-	SUM(upload+download) 
+	SUM(upload+download),
+	SUM(upload_packets),
+	SUM(download_packets),
+	SUM(upload_packets+download_packets) 
 	FROM active_process
-	WHERE update_time >= ? AND update_time <= ?
+	WHERE update_time >= ? AND update_time <= ? AND accounting = ?
 	GROUP BY name
 	`
-	return queryNamedStatistics(db, selectQuery, initialDate, endDate)
+	return queryNamedStatistics(db, selectQuery, initialDate, endDate, accounting)
 }
 
-func GetActiveProcessesThroughputByNameAndTime(db *sql.DB, name string, initialDate, endDate int64) (interface{}, error) {
+func GetActiveProcessesThroughputByNameAndTime(db *sql.DB, accounting, name string, initialDate, endDate int64) (interface{}, error) {
 	selectQuery := `
 	SELECT name,
 	SUM(upload), 
 	SUM(download), 
-	SUM(upload+download) 
+	SUM(upload+download),
+	SUM(upload_packets),
+	SUM(download_packets),
+	SUM(upload_packets+download_packets) 
 	FROM active_process
-	WHERE name = ? AND update_time >= ? AND update_time <= ?
+	WHERE name = ? AND update_time >= ? AND update_time <= ? AND accounting = ?
+	`
+	return queryNamedStatistics(db, selectQuery, name, initialDate, endDate, accounting)
+}
+
+// GetActiveProcessesThroughputTree returns the throughput of processes nested under their top-level application ancestor.
+// Processes without metadata are their own application.
+func GetActiveProcessesThroughputTree(db *sql.DB, accounting string) (interface{}, error) {
+	selectQuery := `
+	SELECT COALESCE(NULLIF(pm.application, ''), p.active_process_name) AS application,
+	COALESCE(pm.name, p.active_process_name) AS process_name,
+	SUM(p.upload),
+	SUM(p.download),
+	SUM(p.upload+p.download),
+	SUM(p.upload_packets),
+	SUM(p.download_packets),
+	SUM(p.upload_packets+p.download_packets)
+	FROM process_data AS p
+	LEFT JOIN process_metadata AS pm ON p.pid = pm.pid AND p.creation_time = pm.creation_time
+	WHERE p.accounting = ?
+	GROUP BY application, process_name
+	`
+
+	return queryStatisticsTree(db, selectQuery, accounting)
+}
+
+func GetActiveProcessesThroughputTreeAndTime(db *sql.DB, accounting string, initialDate, endDate int64) (interface{}, error) {
+	selectQuery := `
+	SELECT COALESCE(NULLIF(pm.application, ''), p.active_process_name) AS application,
+	COALESCE(pm.name, p.active_process_name) AS process_name,
+	SUM(p.upload),
+	SUM(p.download),
+	SUM(p.upload+p.download),
+	SUM(p.upload_packets),
+	SUM(p.download_packets),
+	SUM(p.upload_packets+p.download_packets)
+	FROM process_data AS p
+	LEFT JOIN process_metadata AS pm ON p.pid = pm.pid AND p.creation_time = pm.creation_time
+	INNER JOIN active_process AS ap ON p.update_time = ap.update_time AND p.active_process_name = ap.name
+	WHERE ap.update_time >= ? AND ap.update_time <= ? AND p.accounting = ?
+	GROUP BY application, process_name
 	`
-	return queryNamedStatistics(db, selectQuery, name, initialDate, endDate)
+
+	return queryStatisticsTree(db, selectQuery, initialDate, endDate, accounting)
 }
 
-func GetProcessesThroughputByEntry(db *sql.DB) (interface{}, error) {
+func GetProcessesThroughputByEntry(db *sql.DB, accounting string) (interface{}, error) {
 	selectQuery := `
-	SELECT pid,
+	SELECT pid || '@' || creation_time,
 	SUM(upload), 
 	SUM(download), 
-	SUM(upload+download) 
+	SUM(upload+download),
+	SUM(upload_packets),
+	SUM(download_packets),
+	SUM(upload_packets+download_packets) 
 	FROM process_data
-	GROUP BY pid
+	WHERE accounting = ?
+	GROUP BY pid, creation_time
 	`
 
-	return queryNamedStatistics(db, selectQuery)
+	return queryNamedStatistics(db, selectQuery, accounting)
 }
 
-func GetProcessesThroughputByPid(db *sql.DB, pid string) (interface{}, error) {
+func GetProcessesThroughputByPid(db *sql.DB, accounting, pid string) (interface{}, error) {
 	selectQuery := `
-	SELECT pid,
+	SELECT pid || '@' || creation_time,
 	SUM(upload), 
 	SUM(download), 
-	SUM(upload+download) 
+	SUM(upload+download),
+	SUM(upload_packets),
+	SUM(download_packets),
+	SUM(upload_packets+download_packets) 
+	FROM process_data
+	WHERE pid = ? AND accounting = ?
+	GROUP BY pid, creation_time
+	`
+
+	return queryNamedStatistics(db, selectQuery, pid, accounting)
+}
+
+func GetProcessesThroughputByInstance(db *sql.DB, accounting, pid string, creationTime int64) (interface{}, error) {
+	selectQuery := `
+	SELECT pid || '@' || creation_time,
+	SUM(upload),
+	SUM(download),
+	SUM(upload+download),
+	SUM(upload_packets),
+	SUM(download_packets),
+	SUM(upload_packets+download_packets)
 	FROM process_data
-	WHERE pid = ?
+	WHERE pid = ? AND creation_time = ? AND accounting = ?
+	GROUP BY pid, creation_time
 	`
 
-	return queryNamedStatistics(db, selectQuery, pid)
+	return queryNamedStatistics(db, selectQuery, pid, creationTime, accounting)
 }
 
-func GetProcessesThroughputByEntryAndTime(db *sql.DB, initialDate, endDate int64) (interface{}, error) {
+func GetProcessesThroughputByEntryAndTime(db *sql.DB, accounting string, initialDate, endDate int64) (interface{}, error) {
 	selectQuery := `
-	SELECT p.pid,
+	SELECT p.pid || '@' || p.creation_time,
 	SUM(p.upload), 
 	SUM(p.download), 
-	SUM(p.upload+p.download) 
+	SUM(p.upload+p.download),
+	SUM(p.upload_packets),
+	SUM(p.download_packets),
+	SUM(p.upload_packets+p.download_packets) 
 	FROM process_data AS p
 	INNER JOIN active_process AS ap ON p.update_time = ap.update_time AND p.active_process_name = ap.name
-	WHERE ap.update_time >= ? AND ap.update_time <= ?
-	GROUP BY p.pid
+	WHERE ap.update_time >= ? AND ap.update_time <= ? AND p.accounting = ?
+	GROUP BY p.pid, p.creation_time
 	`
-	return queryNamedStatistics(db, selectQuery, initialDate, endDate)
+	return queryNamedStatistics(db, selectQuery, initialDate, endDate, accounting)
 }
 
-func GetProcessesThroughputByPidAndTime(db *sql.DB, pid string, initialDate, endDate int64) (interface{}, error) {
+func GetProcessesThroughputByPidAndTime(db *sql.DB, accounting, pid string, initialDate, endDate int64) (interface{}, error) {
 	selectQuery := `
-	SELECT p.pid,
+	SELECT p.pid || '@' || p.creation_time,
 	SUM(p.upload), 
 	SUM(p.download), 
-	SUM(p.upload+p.download)  
+	SUM(p.upload+p.download),
+	SUM(p.upload_packets),
+	SUM(p.download_packets),
+	SUM(p.upload_packets+p.download_packets)  
+	FROM process_data AS p
+	INNER JOIN active_process AS ap ON p.update_time = ap.update_time AND p.active_process_name = ap.name
+	WHERE p.pid = ? AND ap.update_time >= ? AND ap.update_time <= ? AND p.accounting = ?
+	GROUP BY p.pid, p.creation_time
+	`
+	return queryNamedStatistics(db, selectQuery, pid, initialDate, endDate, accounting)
+}
+
+func GetProcessesThroughputByInstanceAndTime(db *sql.DB, accounting, pid string, creationTime int64, initialDate, endDate int64) (interface{}, error) {
+	selectQuery := `
+	SELECT p.pid || '@' || p.creation_time,
+	SUM(p.upload),
+	SUM(p.download),
+	SUM(p.upload+p.download),
+	SUM(p.upload_packets),
+	SUM(p.download_packets),
+	SUM(p.upload_packets+p.download_packets)
 	FROM process_data AS p
 	INNER JOIN active_process AS ap ON p.update_time = ap.update_time AND p.active_process_name = ap.name
-	WHERE p.pid = ? AND ap.update_time >= ? AND ap.update_time <= ?
+	WHERE p.pid = ? AND p.creation_time = ? AND ap.update_time >= ? AND ap.update_time <= ? AND p.accounting = ?
+	GROUP BY p.pid, p.creation_time
 	`
-	return queryNamedStatistics(db, selectQuery, pid, initialDate, endDate)
+	return queryNamedStatistics(db, selectQuery, pid, creationTime, initialDate, endDate, accounting)
 }
 
-func GetProtocolsThroughputByEntry(db *sql.DB) (interface{}, error) {
+// metadataGroups maps the groups of GetProcessesThroughputByGroup to their columns. Processes without metadata fall back to their name or "unknown".
+var metadataGroups = map[string]string{
+	"exe":  "COALESCE(NULLIF(pm.exe, ''), p.active_process_name)",
+	"user": "COALESCE(NULLIF(pm.username, ''), 'unknown')",
+}
+
+// GetProcessesThroughputByGroup returns the throughput of processes grouped by a metadata column: "exe" or "user".
+func GetProcessesThroughputByGroup(db *sql.DB, accounting, group string) (interface{}, error) {
+	column, ok := metadataGroups[group]
+	if !ok {
+		return nil, errors.New("Incorrect group")
+	}
+
+	selectQuery := `
+	SELECT ` + column + ` AS group_name,
+	SUM(p.upload),
+	SUM(p.download),
+	SUM(p.upload+p.download),
+	SUM(p.upload_packets),
+	SUM(p.download_packets),
+	SUM(p.upload_packets+p.download_packets)
+	FROM process_data AS p
+	LEFT JOIN process_metadata AS pm ON p.pid = pm.pid AND p.creation_time = pm.creation_time
+	WHERE p.accounting = ?
+	GROUP BY group_name
+	`
+	return queryNamedStatistics(db, selectQuery, accounting)
+}
+
+func GetProcessesThroughputByGroupAndTime(db *sql.DB, accounting, group string, initialDate, endDate int64) (interface{}, error) {
+	column, ok := metadataGroups[group]
+	if !ok {
+		return nil, errors.New("Incorrect group")
+	}
+
+	selectQuery := `
+	SELECT ` + column + ` AS group_name,
+	SUM(p.upload),
+	SUM(p.download),
+	SUM(p.upload+p.download),
+	SUM(p.upload_packets),
+	SUM(p.download_packets),
+	SUM(p.upload_packets+p.download_packets)
+	FROM process_data AS p
+	LEFT JOIN process_metadata AS pm ON p.pid = pm.pid AND p.creation_time = pm.creation_time
+	INNER JOIN active_process AS ap ON p.update_time = ap.update_time AND p.active_process_name = ap.name
+	WHERE ap.update_time >= ? AND ap.update_time <= ? AND p.accounting = ?
+	GROUP BY group_name
+	`
+	return queryNamedStatistics(db, selectQuery, initialDate, endDate, accounting)
+}
+
+// GetProcessMetadata returns the stored process instances, run from an executable and/or by a user. Empty filters match every instance.
+func GetProcessMetadata(db *sql.DB, exe, user string) (metadata []meter.ProcessMetadata, err error) {
+	selectQuery := `
+	SELECT pid, creation_time, name, exe, cmdline, username, ppid, application
+	FROM process_metadata
+	WHERE (? = '' OR exe = ?) AND (? = '' OR username = ?)
+	ORDER BY creation_time
+	`
+
+	rows, err := db.Query(selectQuery, exe, exe, user, user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	metadata = make([]meter.ProcessMetadata, 0)
+	for rows.Next() {
+		var processMetadata meter.ProcessMetadata
+		if err = rows.Scan(
+			&processMetadata.Pid,
+			&processMetadata.Creation_Time,
+			&processMetadata.Name,
+			&processMetadata.Exe,
+			&processMetadata.Cmdline,
+			&processMetadata.Username,
+			&processMetadata.Ppid,
+			&processMetadata.Application); err != nil {
+			return nil, err
+		}
+
+		metadata = append(metadata, processMetadata)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return metadata, nil
+}
+
+func GetProtocolsThroughputByEntry(db *sql.DB, accounting string) (interface{}, error) {
 	selectQuery := `
 	SELECT protocol_name,
 	SUM(upload), 
 	SUM(download), 
-	SUM(upload+download) 
+	SUM(upload+download),
+	SUM(upload_packets),
+	SUM(download_packets),
+	SUM(upload_packets+download_packets) 
 	FROM protocol_data
+	WHERE accounting = ?
 	GROUP BY protocol_name
 	`
 
-	return queryNamedStatistics(db, selectQuery)
+	return queryNamedStatistics(db, selectQuery, accounting)
 }
 
-func GetProtocolsThroughputByName(db *sql.DB, name string) (interface{}, error) {
+func GetProtocolsThroughputByName(db *sql.DB, accounting, name string) (interface{}, error) {
 	selectQuery := `
 	SELECT protocol_name,
 	SUM(upload), 
 	SUM(download), 
-	SUM(upload+download) 
+	SUM(upload+download),
+	SUM(upload_packets),
+	SUM(download_packets),
+	SUM(upload_packets+download_packets) 
 	FROM protocol_data
-	WHERE protocol_name = ?
+	WHERE protocol_name = ? AND accounting = ?
 	`
 
-	return queryNamedStatistics(db, selectQuery, name)
+	return queryNamedStatistics(db, selectQuery, name, accounting)
 }
 
-func GetProtocolsThroughputByEntryAndTime(db *sql.DB, initialDate, endDate int64) (interface{}, error) {
+func GetProtocolsThroughputByEntryAndTime(db *sql.DB, accounting string, initialDate, endDate int64) (interface{}, error) {
 	selectQuery := `
 	SELECT p.protocol_name,
 	SUM(p.upload), 
 	SUM(p.download), 
-	SUM(p.upload+p.download) 
+	SUM(p.upload+p.download),
+	SUM(p.upload_packets),
+	SUM(p.download_packets),
+	SUM(p.upload_packets+p.download_packets) 
 	FROM protocol_data AS p
 	INNER JOIN active_process AS ap ON p.update_time = ap.update_time AND p.active_process_name = ap.name
-	WHERE ap.update_time >= ? AND ap.update_time <= ?
+	WHERE ap.update_time >= ? AND ap.update_time <= ? AND p.accounting = ?
 	GROUP BY p.protocol_name
 	`
-	return queryNamedStatistics(db, selectQuery, initialDate, endDate)
+	return queryNamedStatistics(db, selectQuery, initialDate, endDate, accounting)
 }
 
-func GetProtocolsThroughputByNameAndTime(db *sql.DB, pid string, initialDate, endDate int64) (interface{}, error) {
+func GetProtocolsThroughputByNameAndTime(db *sql.DB, accounting, pid string, initialDate, endDate int64) (interface{}, error) {
 	selectQuery := `
 	SELECT p.protocol_name,
 	SUM(p.upload), 
 	SUM(p.download), 
-	SUM(p.upload+p.download)  
+	SUM(p.upload+p.download),
+	SUM(p.upload_packets),
+	SUM(p.download_packets),
+	SUM(p.upload_packets+p.download_packets)  
+	FROM protocol_data AS p
+	INNER JOIN active_process AS ap ON p.update_time = ap.update_time AND p.active_process_name = ap.name
+	WHERE p.protocol_name = ? AND ap.update_time >= ? AND ap.update_time <= ? AND p.accounting = ?
+	`
+	return queryNamedStatistics(db, selectQuery, pid, initialDate, endDate, accounting)
+}
+
+// GetProtocolsThroughputByService groups the protocols by their service name. Protocols without one are kept by transport and port, or by bare port
+// if recorded before transports were told apart and not named by migrateLegacyProtocols.
+func GetProtocolsThroughputByService(db *sql.DB, accounting string) (interface{}, error) {
+	selectQuery := `
+	SELECT COALESCE(NULLIF(service, ''), protocol_name) AS service_name,
+	SUM(upload), 
+	SUM(download), 
+	SUM(upload+download),
+	SUM(upload_packets),
+	SUM(download_packets),
+	SUM(upload_packets+download_packets) 
+	FROM protocol_data
+	WHERE accounting = ?
+	GROUP BY service_name
+	`
+
+	return queryNamedStatistics(db, selectQuery, accounting)
+}
+
+func GetProtocolsThroughputByServiceAndTime(db *sql.DB, accounting string, initialDate, endDate int64) (interface{}, error) {
+	selectQuery := `
+	SELECT COALESCE(NULLIF(p.service, ''), p.protocol_name) AS service_name,
+	SUM(p.upload), 
+	SUM(p.download), 
+	SUM(p.upload+p.download),
+	SUM(p.upload_packets),
+	SUM(p.download_packets),
+	SUM(p.upload_packets+p.download_packets) 
 	FROM protocol_data AS p
 	INNER JOIN active_process AS ap ON p.update_time = ap.update_time AND p.active_process_name = ap.name
-	WHERE p.protocol_name = ? AND ap.update_time >= ? AND ap.update_time <= ?
+	WHERE ap.update_time >= ? AND ap.update_time <= ? AND p.accounting = ?
+	GROUP BY service_name
 	`
-	return queryNamedStatistics(db, selectQuery, pid, initialDate, endDate)
+	return queryNamedStatistics(db, selectQuery, initialDate, endDate, accounting)
 }
 
-func GetHostsThroughputByEntry(db *sql.DB) (interface{}, error) {
+func GetHostsThroughputByEntry(db *sql.DB, accounting string) (interface{}, error) {
 	selectQuery := `
 	SELECT host_name,
 	SUM(upload), 
 	SUM(download), 
-	SUM(upload+download) 
+	SUM(upload+download),
+	SUM(upload_packets),
+	SUM(download_packets),
+	SUM(upload_packets+download_packets) 
 	FROM host_data
+	WHERE accounting = ?
 	GROUP BY host_name
 	`
 
-	return queryNamedStatistics(db, selectQuery)
+	return queryNamedStatistics(db, selectQuery, accounting)
 }
 
-func GetHostsThroughputByName(db *sql.DB, name string) (interface{}, error) {
+func GetHostsThroughputByName(db *sql.DB, accounting, name string) (interface{}, error) {
 	selectQuery := `
 	SELECT host_name,
 	SUM(upload), 
 	SUM(download), 
-	SUM(upload+download) 
+	SUM(upload+download),
+	SUM(upload_packets),
+	SUM(download_packets),
+	SUM(upload_packets+download_packets) 
 	FROM host_data
-	WHERE host_name = ?
+	WHERE host_name = ? AND accounting = ?
 	`
 
-	return queryNamedStatistics(db, selectQuery, name)
+	return queryNamedStatistics(db, selectQuery, name, accounting)
 }
 
-func GetHostsThroughputByEntryAndTime(db *sql.DB, initialDate, endDate int64) (interface{}, error) {
+func GetHostsThroughputByEntryAndTime(db *sql.DB, accounting string, initialDate, endDate int64) (interface{}, error) {
 	selectQuery := `
 	SELECT h.host_name,
 	SUM(h.upload), 
 	SUM(h.download), 
-	SUM(h.upload+h.download) 
+	SUM(h.upload+h.download),
+	SUM(h.upload_packets),
+	SUM(h.download_packets),
+	SUM(h.upload_packets+h.download_packets) 
 	FROM host_data AS h
 	INNER JOIN active_process AS ap ON h.update_time = ap.update_time AND h.active_process_name = ap.name
-	WHERE ap.update_time >= ? AND ap.update_time <= ?
+	WHERE ap.update_time >= ? AND ap.update_time <= ? AND h.accounting = ?
 	GROUP BY h.host_name
 	`
-	return queryNamedStatistics(db, selectQuery, initialDate, endDate)
+	return queryNamedStatistics(db, selectQuery, initialDate, endDate, accounting)
 }
 
-func GetHostsThroughputByNameAndTime(db *sql.DB, pid string, initialDate, endDate int64) (interface{}, error) {
+func GetHostsThroughputByNameAndTime(db *sql.DB, accounting, pid string, initialDate, endDate int64) (interface{}, error) {
 	selectQuery := `
 	SELECT h.host_name,
 	SUM(h.upload), 
 	SUM(h.download), 
-	SUM(h.upload+h.download)  
+	SUM(h.upload+h.download),
+	SUM(h.upload_packets),
+	SUM(h.download_packets),
+	SUM(h.upload_packets+h.download_packets)  
 	FROM host_data AS h
 	INNER JOIN active_process AS ap ON h.update_time = ap.update_time AND h.active_process_name = ap.name
-	WHERE h.host_name = ? AND ap.update_time >= ? AND ap.update_time <= ?
+	WHERE h.host_name = ? AND ap.update_time >= ? AND ap.update_time <= ? AND h.accounting = ?
+	`
+	return queryNamedStatistics(db, selectQuery, pid, initialDate, endDate, accounting)
+}
+
+func GetCgroupsThroughputByEntry(db *sql.DB, accounting string) (interface{}, error) {
+	selectQuery := `
+	SELECT cgroup_name,
+	SUM(upload), 
+	SUM(download), 
+	SUM(upload+download),
+	SUM(upload_packets),
+	SUM(download_packets),
+	SUM(upload_packets+download_packets) 
+	FROM cgroup_data
+	WHERE accounting = ?
+	GROUP BY cgroup_name
+	`
+
+	return queryNamedStatistics(db, selectQuery, accounting)
+}
+
+func GetCgroupsThroughputByName(db *sql.DB, accounting, name string) (interface{}, error) {
+	selectQuery := `
+	SELECT cgroup_name,
+	SUM(upload), 
+	SUM(download), 
+	SUM(upload+download),
+	SUM(upload_packets),
+	SUM(download_packets),
+	SUM(upload_packets+download_packets) 
+	FROM cgroup_data
+	WHERE cgroup_name = ? AND accounting = ?
+	`
+
+	return queryNamedStatistics(db, selectQuery, name, accounting)
+}
+
+func GetCgroupsThroughputByEntryAndTime(db *sql.DB, accounting string, initialDate, endDate int64) (interface{}, error) {
+	selectQuery := `
+	SELECT c.cgroup_name,
+	SUM(c.upload), 
+	SUM(c.download), 
+	SUM(c.upload+c.download),
+	SUM(c.upload_packets),
+	SUM(c.download_packets),
+	SUM(c.upload_packets+c.download_packets) 
+	FROM cgroup_data AS c
+	INNER JOIN active_process AS ap ON c.update_time = ap.update_time AND c.active_process_name = ap.name
+	WHERE ap.update_time >= ? AND ap.update_time <= ? AND c.accounting = ?
+	GROUP BY c.cgroup_name
+	`
+	return queryNamedStatistics(db, selectQuery, initialDate, endDate, accounting)
+}
+
+func GetCgroupsThroughputByNameAndTime(db *sql.DB, accounting, name string, initialDate, endDate int64) (interface{}, error) {
+	selectQuery := `
+	SELECT c.cgroup_name,
+	SUM(c.upload), 
+	SUM(c.download), 
+	SUM(c.upload+c.download),
+	SUM(c.upload_packets),
+	SUM(c.download_packets),
+	SUM(c.upload_packets+c.download_packets)  
+	FROM cgroup_data AS c
+	INNER JOIN active_process AS ap ON c.update_time = ap.update_time AND c.active_process_name = ap.name
+	WHERE c.cgroup_name = ? AND ap.update_time >= ? AND ap.update_time <= ? AND c.accounting = ?
+	`
+	return queryNamedStatistics(db, selectQuery, name, initialDate, endDate, accounting)
+}
+
+func GetUsersThroughputByEntry(db *sql.DB, accounting string) (interface{}, error) {
+	selectQuery := `
+	SELECT username,
+	SUM(upload),
+	SUM(download),
+	SUM(upload+download),
+	SUM(upload_packets),
+	SUM(download_packets),
+	SUM(upload_packets+download_packets)
+	FROM user_data
+	WHERE accounting = ?
+	GROUP BY uid
+	`
+
+	return queryNamedStatistics(db, selectQuery, accounting)
+}
+
+func GetUsersThroughputByUid(db *sql.DB, accounting, uid string) (interface{}, error) {
+	selectQuery := `
+	SELECT username,
+	SUM(upload),
+	SUM(download),
+	SUM(upload+download),
+	SUM(upload_packets),
+	SUM(download_packets),
+	SUM(upload_packets+download_packets)
+	FROM user_data
+	WHERE uid = ? AND accounting = ?
+	GROUP BY uid
+	`
+
+	return queryNamedStatistics(db, selectQuery, uid, accounting)
+}
+
+func GetUsersThroughputByEntryAndTime(db *sql.DB, accounting string, initialDate, endDate int64) (interface{}, error) {
+	selectQuery := `
+	SELECT u.username,
+	SUM(u.upload),
+	SUM(u.download),
+	SUM(u.upload+u.download),
+	SUM(u.upload_packets),
+	SUM(u.download_packets),
+	SUM(u.upload_packets+u.download_packets)
+	FROM user_data AS u
+	INNER JOIN active_process AS ap ON u.update_time = ap.update_time AND u.active_process_name = ap.name
+	WHERE ap.update_time >= ? AND ap.update_time <= ? AND u.accounting = ?
+	GROUP BY u.uid
+	`
+	return queryNamedStatistics(db, selectQuery, initialDate, endDate, accounting)
+}
+
+func GetUsersThroughputByUidAndTime(db *sql.DB, accounting, uid string, initialDate, endDate int64) (interface{}, error) {
+	selectQuery := `
+	SELECT u.username,
+	SUM(u.upload),
+	SUM(u.download),
+	SUM(u.upload+u.download),
+	SUM(u.upload_packets),
+	SUM(u.download_packets),
+	SUM(u.upload_packets+u.download_packets)
+	FROM user_data AS u
+	INNER JOIN active_process AS ap ON u.update_time = ap.update_time AND u.active_process_name = ap.name
+	WHERE u.uid = ? AND ap.update_time >= ? AND ap.update_time <= ? AND u.accounting = ?
+	GROUP BY u.uid
 	`
-	return queryNamedStatistics(db, selectQuery, pid, initialDate, endDate)
+	return queryNamedStatistics(db, selectQuery, uid, initialDate, endDate, accounting)
 }
 
 func queryStatistics(db *sql.DB, query string, args ...interface{}) (interface{}, error) {
@@ -789,6 +1844,10 @@ func queryStatistics(db *sql.DB, query string, args ...interface{}) (interface{}
 		Total_upload   int64 `json:"total_upload"`
 		Total_download int64 `json:"total_download"`
 		Total          int64 `json:"total"`
+
+		Total_upload_packets   int64 `json:"total_upload_packets"`
+		Total_download_packets int64 `json:"total_download_packets"`
+		Total_packets          int64 `json:"total_packets"`
 	}
 
 	// Run the query to select all hosts
@@ -805,7 +1864,10 @@ func queryStatistics(db *sql.DB, query string, args ...interface{}) (interface{}
 		if err = rows.Scan(
 			&stats.Total_upload,
 			&stats.Total_download,
-			&stats.Total); err != nil {
+			&stats.Total,
+			&stats.Total_upload_packets,
+			&stats.Total_download_packets,
+			&stats.Total_packets); err != nil {
 			return stats, err
 		}
 	}
@@ -825,6 +1887,10 @@ func queryNamedStatistics(db *sql.DB, query string, args ...interface{}) (map[st
 		Total_upload   int64  `json:"total_upload"`
 		Total_download int64  `json:"total_download"`
 		Total          int64  `json:"total"`
+
+		Total_upload_packets   int64 `json:"total_upload_packets"`
+		Total_download_packets int64 `json:"total_download_packets"`
+		Total_packets          int64 `json:"total_packets"`
 	}
 
 	// Run the query to select all hosts
@@ -843,7 +1909,10 @@ func queryNamedStatistics(db *sql.DB, query string, args ...interface{}) (map[st
 			&statsEntry.Name,
 			&statsEntry.Total_upload,
 			&statsEntry.Total_download,
-			&statsEntry.Total); err != nil {
+			&statsEntry.Total,
+			&statsEntry.Total_upload_packets,
+			&statsEntry.Total_download_packets,
+			&statsEntry.Total_packets); err != nil {
 			return nil, err
 		}
 
@@ -857,6 +1926,211 @@ func queryNamedStatistics(db *sql.DB, query string, args ...interface{}) (map[st
 	return stats, nil
 }
 
+// queryStatisticsTree is a helper function to execute queries returning the statistics of children grouped by parent, such as processes by application.
+// The statistics of each parent are the sum of its children's.
+func queryStatisticsTree(db *sql.DB, query string, args ...interface{}) (map[string]interface{}, error) {
+	type Statistics struct {
+		Name           string `json:"name"`
+		Total_upload   int64  `json:"total_upload"`
+		Total_download int64  `json:"total_download"`
+		Total          int64  `json:"total"`
+
+		Total_upload_packets   int64 `json:"total_upload_packets"`
+		Total_download_packets int64 `json:"total_download_packets"`
+		Total_packets          int64 `json:"total_packets"`
+
+		Children map[string]*Statistics `json:"children,omitempty"`
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats map[string]interface{} = make(map[string]interface{})
+
+	// Iterate through all resulting rows, adding each child to its parent
+	for rows.Next() {
+		var (
+			parentName string
+			child      Statistics
+		)
+		if err = rows.Scan(
+			&parentName,
+			&child.Name,
+			&child.Total_upload,
+			&child.Total_download,
+			&child.Total,
+			&child.Total_upload_packets,
+			&child.Total_download_packets,
+			&child.Total_packets); err != nil {
+			return nil, err
+		}
+
+		if _, ok := stats[parentName]; !ok {
+			stats[parentName] = &Statistics{Name: parentName, Children: make(map[string]*Statistics)}
+		}
+		parent := stats[parentName].(*Statistics)
+
+		parent.Total_upload += child.Total_upload
+		parent.Total_download += child.Total_download
+		parent.Total += child.Total
+		parent.Total_upload_packets += child.Total_upload_packets
+		parent.Total_download_packets += child.Total_download_packets
+		parent.Total_packets += child.Total_packets
+		parent.Children[child.Name] = &child
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// applicationGroups are the groupings supported by GetApplicationsThroughputByGroup.
+var applicationGroups = map[string]bool{"application": true, "category": true}
+
+// GetApplicationsThroughputByGroup returns the throughput of the applications recorded by the application rules, by "application" or by "category".
+// The current process and exe rules are applied retroactively, as described by ApplicationRules.Classify; host rules only apply to the traffic captured while they exist.
+// Categories nest their applications; traffic without category is grouped under "uncategorized".
+func GetApplicationsThroughputByGroup(db *sql.DB, rules *meter.ApplicationRules, accounting, group string) (interface{}, error) {
+	selectQuery := `
+	SELECT a.active_process_name,
+	a.application_name,
+	a.category,
+	a.exe,
+	SUM(a.upload),
+	SUM(a.download),
+	SUM(a.upload+a.download),
+	SUM(a.upload_packets),
+	SUM(a.download_packets),
+	SUM(a.upload_packets+a.download_packets)
+	FROM application_data AS a
+	WHERE a.accounting = ?
+	GROUP BY a.active_process_name, a.application_name, a.category, a.exe
+	`
+	return queryApplicationStatistics(db, rules, group, selectQuery, accounting)
+}
+
+func GetApplicationsThroughputByGroupAndTime(db *sql.DB, rules *meter.ApplicationRules, accounting, group string, initialDate, endDate int64) (interface{}, error) {
+	selectQuery := `
+	SELECT a.active_process_name,
+	a.application_name,
+	a.category,
+	a.exe,
+	SUM(a.upload),
+	SUM(a.download),
+	SUM(a.upload+a.download),
+	SUM(a.upload_packets),
+	SUM(a.download_packets),
+	SUM(a.upload_packets+a.download_packets)
+	FROM application_data AS a
+	INNER JOIN active_process AS ap ON a.update_time = ap.update_time AND a.active_process_name = ap.name
+	WHERE ap.update_time >= ? AND ap.update_time <= ? AND a.accounting = ?
+	GROUP BY a.active_process_name, a.application_name, a.category, a.exe
+	`
+	return queryApplicationStatistics(db, rules, group, selectQuery, initialDate, endDate, accounting)
+}
+
+// queryApplicationStatistics is a helper function reapplying the process and exe rules given to the statistics of the recorded applications by active process and executable,
+// and summing them by application or category.
+func queryApplicationStatistics(db *sql.DB, rules *meter.ApplicationRules, group, query string, args ...interface{}) (map[string]interface{}, error) {
+	type Statistics struct {
+		Name           string `json:"name"`
+		Total_upload   int64  `json:"total_upload"`
+		Total_download int64  `json:"total_download"`
+		Total          int64  `json:"total"`
+
+		Total_upload_packets   int64 `json:"total_upload_packets"`
+		Total_download_packets int64 `json:"total_download_packets"`
+		Total_packets          int64 `json:"total_packets"`
+
+		Children map[string]*Statistics `json:"children,omitempty"`
+	}
+
+	if !applicationGroups[group] {
+		return nil, errors.New("Incorrect group")
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats map[string]interface{} = make(map[string]interface{})
+
+	// add sums the statistics of a recorded application into an entry of a group, creating it if needed
+	add := func(group map[string]*Statistics, name string, recorded *Statistics) *Statistics {
+		if _, ok := group[name]; !ok {
+			group[name] = &Statistics{Name: name}
+		}
+		entry := group[name]
+
+		entry.Total_upload += recorded.Total_upload
+		entry.Total_download += recorded.Total_download
+		entry.Total += recorded.Total
+		entry.Total_upload_packets += recorded.Total_upload_packets
+		entry.Total_download_packets += recorded.Total_download_packets
+		entry.Total_packets += recorded.Total_packets
+		return entry
+	}
+
+	entries := make(map[string]*Statistics)
+
+	// Iterate through all resulting rows, adding each recorded application to its current application, and to its category if grouped by category
+	for rows.Next() {
+		var (
+			processName, category, exe string
+			recorded                   Statistics
+		)
+		if err = rows.Scan(
+			&processName,
+			&recorded.Name,
+			&category,
+			&exe,
+			&recorded.Total_upload,
+			&recorded.Total_download,
+			&recorded.Total,
+			&recorded.Total_upload_packets,
+			&recorded.Total_download_packets,
+			&recorded.Total_packets); err != nil {
+			return nil, err
+		}
+
+		application := recorded.Name
+		if matched, matchedCategory, exact := rules.MatchProcess(processName, exe); exact {
+			application, category = matched, matchedCategory
+		}
+
+		if group == "application" {
+			add(entries, application, &recorded)
+			continue
+		}
+
+		if category == "" {
+			category = "uncategorized"
+		}
+		entry := add(entries, category, &recorded)
+		if entry.Children == nil {
+			entry.Children = make(map[string]*Statistics)
+		}
+		add(entry.Children, application, &recorded)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for name, entry := range entries {
+		stats[name] = entry
+	}
+
+	return stats, nil
+}
+
 // RemoveEntries removes all entries from all tables of the database. A timeframe can be used as argument to clear the data.
 func RemoveEntries(db *sql.DB, args ...interface{}) error {
 	var query string
@@ -899,9 +2173,12 @@ func RemoveEntries(db *sql.DB, args ...interface{}) error {
 
 func RollupDatabases(db *sql.DB, start, end time.Time, interval time.Duration) {
 	RollupActiveProcesses(db, start, end, interval)
-	RollupDataTables(db, "protocol_data", "protocol_name", start, end, interval)
-	RollupDataTables(db, "process_data", "pid", start, end, interval)
-	RollupDataTables(db, "host_data", "host_name", start, end, interval)
+	RollupDataTables(db, "protocol_data", "protocol_name", start, end, interval, "service", "accounting")
+	RollupDataTables(db, "process_data", "pid", start, end, interval, "creation_time", "accounting")
+	RollupDataTables(db, "host_data", "host_name", start, end, interval, "accounting")
+	RollupDataTables(db, "user_data", "uid", start, end, interval, "username", "accounting")
+	RollupDataTables(db, "cgroup_data", "cgroup_name", start, end, interval, "kind", "accounting")
+	RollupDataTables(db, "application_data", "application_name", start, end, interval, "category", "exe", "accounting")
 }
 
 func RollupActiveProcesses(db *sql.DB, start time.Time, end time.Time, interval time.Duration) (err error) {
@@ -915,19 +2192,19 @@ func RollupActiveProcesses(db *sql.DB, start time.Time, end time.Time, interval
 	}
 
 	// Prepare insert statements for new data
-	insertStatement, err := tx.Prepare(`INSERT INTO active_process (name, upload, download, update_time) VALUES (?, ?, ?, ?)`)
+	insertStatement, err := tx.Prepare(`INSERT INTO active_process (name, upload, download, update_time, accounting, upload_packets, download_packets) VALUES (?, ?, ?, ?, ?, ?, ?)`)
 	if err != nil {
 		tx.Rollback()
 		return err
 	}
 	defer insertStatement.Close()
 
-	// Get all data between start and finish with grouped by name and interval
+	// Get all data between start and finish with grouped by name, interval and accounting mode
 	rows, err := db.Query(`
-		SELECT name, SUM(upload), SUM(download), CAST(ROUND(update_time / ?, 1) * ? AS int64) AS avgUpdateTime
+		SELECT name, SUM(upload), SUM(download), CAST(ROUND(update_time / ?, 1) * ? AS int64) AS avgUpdateTime, accounting, SUM(upload_packets), SUM(download_packets)
 		FROM active_process 
 		WHERE update_time >= ? AND update_time < ? 
-		GROUP BY name, avgUpdateTime
+		GROUP BY name, avgUpdateTime, accounting
 		`, interval.Milliseconds(), interval.Milliseconds(), start.UnixMilli(), end.UnixMilli())
 	if err != nil {
 		tx.Rollback()
@@ -947,16 +2224,16 @@ func RollupActiveProcesses(db *sql.DB, start time.Time, end time.Time, interval
 
 	nRows := 0
 	for rows.Next() {
-		var name string
-		var totalUpload, totalDownload, minUpdateTime int64
+		var name, accounting string
+		var totalUpload, totalDownload, minUpdateTime, totalUploadPackets, totalDownloadPackets int64
 
-		err := rows.Scan(&name, &totalUpload, &totalDownload, &minUpdateTime)
+		err := rows.Scan(&name, &totalUpload, &totalDownload, &minUpdateTime, &accounting, &totalUploadPackets, &totalDownloadPackets)
 		if err != nil {
 			tx.Rollback()
 			log.Println(err)
 		}
 		nRows++
-		_, err = insertStatement.Exec(name, totalUpload, totalDownload, minUpdateTime)
+		_, err = insertStatement.Exec(name, totalUpload, totalDownload, minUpdateTime, accounting, totalUploadPackets, totalDownloadPackets)
 		if err != nil {
 			tx.Rollback()
 			log.Println(err)
@@ -975,7 +2252,9 @@ func RollupActiveProcesses(db *sql.DB, start time.Time, end time.Time, interval
 	return
 }
 
-func RollupDataTables(db *sql.DB, tableName, identifierName string, start time.Time, end time.Time, interval time.Duration) (err error) {
+// RollupDataTables merges the rows of a data table within the same interval, active process and identifier.
+// Extra identifiers are columns kept on the merged rows, such as the service of a protocol.
+func RollupDataTables(db *sql.DB, tableName, identifierName string, start time.Time, end time.Time, interval time.Duration, extraIdentifiers ...string) (err error) {
 	log.Println("Rolling up " + tableName + "...")
 
 	// Transaction for data manipulation
@@ -984,8 +2263,16 @@ func RollupDataTables(db *sql.DB, tableName, identifierName string, start time.T
 		log.Println(err)
 	}
 
+	// List the extra identifiers to be selected, grouped and inserted along with identifierName
+	extraColumns := ""
+	extraValues := ""
+	for _, extraIdentifier := range extraIdentifiers {
+		extraColumns += ", " + extraIdentifier
+		extraValues += ", ?"
+	}
+
 	// Prepare insert statements for new data
-	insertStatement, err := tx.Prepare(`INSERT INTO ` + tableName + ` (` + identifierName + `, upload, download, update_time, active_process_name) VALUES (?, ?, ?, ?, ?)`)
+	insertStatement, err := tx.Prepare(`INSERT INTO ` + tableName + ` (` + identifierName + `, upload, download, update_time, active_process_name, upload_packets, download_packets` + extraColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?` + extraValues + `)`)
 	if err != nil {
 		tx.Rollback()
 		return err
@@ -994,10 +2281,10 @@ func RollupDataTables(db *sql.DB, tableName, identifierName string, start time.T
 
 	// Get all data between start and finish with grouped by identifierName, interval and active_process_name
 	rows, err := db.Query(`
-		SELECT `+identifierName+`, SUM(upload), SUM(download), CAST(ROUND(update_time / ?, 1) * ? AS int64) AS avgUpdateTime, active_process_name
+		SELECT `+identifierName+`, SUM(upload), SUM(download), CAST(ROUND(update_time / ?, 1) * ? AS int64) AS avgUpdateTime, active_process_name, SUM(upload_packets), SUM(download_packets)`+extraColumns+`
 		FROM `+tableName+` 
 		WHERE update_time >= ? AND update_time < ? 
-		GROUP BY `+identifierName+`, avgUpdateTime, active_process_name
+		GROUP BY `+identifierName+`, avgUpdateTime, active_process_name`+extraColumns+`
 		`, interval.Milliseconds(), interval.Milliseconds(), start.UnixMilli(), end.UnixMilli())
 	if err != nil {
 		tx.Rollback()
@@ -1017,14 +2304,21 @@ func RollupDataTables(db *sql.DB, tableName, identifierName string, start time.T
 	nRows := 0
 	for rows.Next() {
 		var name, process_name string
-		var totalUpload, totalDownload, updateTime int64
+		var totalUpload, totalDownload, updateTime, totalUploadPackets, totalDownloadPackets int64
+
+		var extras = make([]interface{}, len(extraIdentifiers))
+
+		values := []interface{}{&name, &totalUpload, &totalDownload, &updateTime, &process_name, &totalUploadPackets, &totalDownloadPackets}
+		for i := range extras {
+			values = append(values, &extras[i])
+		}
 
-		err := rows.Scan(&name, &totalUpload, &totalDownload, &updateTime, &process_name)
+		err := rows.Scan(values...)
 		if err != nil {
 			tx.Rollback()
 			log.Println(err)
 		}
-		_, err = insertStatement.Exec(name, totalUpload, totalDownload, updateTime, process_name)
+		_, err = insertStatement.Exec(append([]interface{}{name, totalUpload, totalDownload, updateTime, process_name, totalUploadPackets, totalDownloadPackets}, extras...)...)
 		if err != nil {
 			tx.Rollback()
 			log.Println(err)
@@ -2,50 +2,41 @@ package main
 
 import (
 	"database/sql"
+	"flag"
 	"log"
-	"strings"
-	"sync"
+	"os"
 	"time"
 
-	"github.com/google/gopacket"
-	"github.com/google/gopacket/pcap"
+	"github.com/Viasat/Viasat-NetworkTrafficMeter/meter"
 )
 
-var (
-	connections2pid map[SocketConnectionPorts]SocketConnectionProcess = make(map[SocketConnectionPorts]SocketConnectionProcess)
-	bufferParser    map[string]*ActiveProcess                         = make(map[string]*ActiveProcess)
-	bufferDatabase  []map[string]*ActiveProcess                         = make([]map[string]*ActiveProcess, 0)
-)
+// DatabaseStorage saves the traffic flushed by the meter to the SQLite database.
+type DatabaseStorage struct {
+	db *sql.DB
+}
 
-// ManageParserBuffer sends the current activeProcesses map to ParseActiveProcesses every one second, and then resets the map.
-func ManageParserBuffer(bufferParserChan chan map[string]*ActiveProcess, bufferParserMutex, bufferDatabaseMutex *sync.RWMutex) {
-	var ticker = time.NewTicker(time.Second)
-	for {
-		select {
-		case <-ticker.C:
-			bufferParserChan <- bufferParser
-			bufferParserMutex.Lock()
-			bufferDatabaseMutex.Lock()
-			bufferParser = make(map[string]*ActiveProcess)
-			bufferDatabase = append(bufferDatabase, make(map[string]*ActiveProcess))
-			bufferDatabaseMutex.Unlock()
-			bufferParserMutex.Unlock()
-		}
+// SaveActiveProcesses saves the traffic of each second since the last flush to the database.
+func (storage DatabaseStorage) SaveActiveProcesses(buffer []map[string]*meter.ActiveProcess) error {
+	log.Println("Saving to database...")
+	if err := InsertActiveProcessWithRelatedData(storage.db, buffer); err != nil {
+		log.Println("Failed saving data to database: ", err)
+		return err
 	}
+	log.Println("Saving complete")
+	return nil
 }
 
-func ManageDatabaseBuffer(db *sql.DB, bufferDatabaseMutex *sync.RWMutex) {
-	var ticker = time.NewTicker(5 * time.Minute)
-	defer InsertActiveProcessWithRelatedData(db, bufferDatabase)
-	for {
-		select {
-		case <-ticker.C:
-			SaveBufferToDatabase(db, bufferDatabaseMutex)
-		}
+// SaveProcessMetadata saves the process instances resolved since the last flush to the database.
+func (storage DatabaseStorage) SaveProcessMetadata(metadata []*meter.ProcessMetadata) error {
+	if err := InsertProcessMetadata(storage.db, metadata); err != nil {
+		log.Println("Failed saving process metadata to database: ", err)
+		return err
 	}
+	return nil
 }
 
-func ManageRollupDatabase(db *sql.DB) {
+// ManageRollupDatabase rolls up the database on startup, then the latest data every 'interval' and the older data every week.
+func ManageRollupDatabase(db *sql.DB, interval time.Duration) {
 	var (
 		currentTime    = time.Now()
 		fiveMinutesAgo = currentTime.Add(-5 * time.Minute)
@@ -61,17 +52,18 @@ func ManageRollupDatabase(db *sql.DB) {
 	//Rollup the last month of data to be shown in daily intervals
 	RollupDatabases(db, oneMonthAgo, oneWeekAgo, dayInterval)
 
-	var hourTicker = time.NewTicker(time.Hour)
+	var rollupTicker = time.NewTicker(interval)
 	var weekTicker = time.NewTicker(time.Hour * 24 * 7)
 	for {
 		select {
-		case <-hourTicker.C:
+		case <-rollupTicker.C:
+			// Start where the previous rollup ended, so no data is left out when the interval is longer than an hour
 			var (
 				currentTime        = time.Now()
 				fiveMinutesAgo     = currentTime.Add(-5 * time.Minute)
-				oneHourAgo         = currentTime.Add(-1 * time.Hour).Truncate(time.Minute * 2)
+				previousRollup     = fiveMinutesAgo.Add(-interval).Truncate(hourInterval)
 			)
-			RollupDatabases(db, oneHourAgo, fiveMinutesAgo, hourInterval)
+			RollupDatabases(db, previousRollup, fiveMinutesAgo, hourInterval)
 			continue
 		case <-weekTicker.C:
 			var (
@@ -93,197 +85,74 @@ func ManageRollupDatabase(db *sql.DB) {
 	}
 }
 
-func SaveBufferToDatabase(db *sql.DB, bufferDatabaseMutex *sync.RWMutex) {
-	log.Println("Saving to database...")
-	bufferDatabaseMutex.Lock()
-	if err := InsertActiveProcessWithRelatedData(db, bufferDatabase); err != nil {
-		log.Println("Failed saving data to database: ", err)
-	} else {
-		log.Println("Saving complete")
-	}
-	bufferDatabase = make([]map[string]*ActiveProcess, 0)
-	bufferDatabase = append(bufferDatabase, make(map[string]*ActiveProcess))
-
-	bufferDatabaseMutex.Unlock()
-}
+func main() {
+	var (
+		db           *sql.DB      // db stores the database handle used in the webserver
+		trafficMeter *meter.Meter // trafficMeter captures the traffic served by the webserver and saved to the database
 
-// ManageHandle receives a network interface's name from the 'networkInterface' channel and returns a handle on the 'updatedHandle' channel if no errors occur.
-func ManageHandle(networkInterface chan string, updatedHandle chan *pcap.Handle) {
-	for iface := range networkInterface {
-		if handle, err := pcap.OpenLive(iface, 1600, true, pcap.BlockForever); err != nil {
-			log.Println(err)
-		} else {
-			updatedHandle <- handle
-		}
-	}
-}
+		err error // err stores any errors from function returns.
 
-// CreateHandle receives a network interface's name and returns a handle if no errors occur.
-func CreateHandle(networkInterface string) (*pcap.Handle, error) {
-	if handle, err := pcap.OpenLive(networkInterface, 1600, true, pcap.BlockForever); err != nil {
-		log.Println(err)
-		return nil, err
-	} else {
-		return handle, nil
-	}
-}
+		shutdownChan chan bool = make(chan bool) // channel used for shuting down the application
 
-// Compare current interfaces with new ones
-func CheckInterfaces(oldInterfaces []NetworkInterface, newInterfaces []NetworkInterface) (addedInterfaces []NetworkInterface, removedInterfaces []NetworkInterface) {
-	addedInterfaces = make([]NetworkInterface, 0)
-	removedInterfaces = make([]NetworkInterface, 0)
+		config Config // config stores the settings provided on the command line
+	)
 
-	for _, oldInterface := range oldInterfaces {
-		found := false
-		for _, newInterface := range newInterfaces {
-			if oldInterface.Name == newInterface.Name {
-				found = true
-				break
-			}
-		}
-		if !found {
-			removedInterfaces = append(removedInterfaces, oldInterface)
+	// Parse the command-line arguments
+	if config, err = ParseConfig(os.Args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return
 		}
+		log.Fatal(err)
 	}
 
-	for _, newInterface := range newInterfaces {
-		found := false
-		for _, oldInterface := range oldInterfaces {
-			if oldInterface.Name == newInterface.Name {
-				found = true
-				break
-			}
-		}
-		if !found {
-			addedInterfaces = append(addedInterfaces, newInterface)
-		}
+	// List the interfaces and exit
+	if config.Command == "devices" {
+		PrintInterfaceList()
+		return
 	}
 
-	return addedInterfaces, removedInterfaces
-}
-
-func main() {
-	var (
-		macs       []string // macs stores an array of this machine's MAC addresses.
-		db         *sql.DB  // db stores the database handle used in the webserver
-
-		stopSignal                           = make(map[string]chan bool)  // Channel to signal goroutines to stop
-		currentInterfaces []NetworkInterface = make([]NetworkInterface, 0) // list of available interfaces
-
-		err error // err stores any errors from function returns.
-
-		getConnectionsMutex = sync.RWMutex{} // getConnectionMutex is a mutex used to control read/write operations in the connections2pid map.
-		bufferParserMutex   = sync.RWMutex{} // bufferMutex is a mutex used to control read/write operations in the activeProcesses map.
-		bufferDatabaseMutex = sync.RWMutex{} // bufferMutex is a mutex used to control read/write operations in the activeProcesses map.
-
-		bufferParserChan chan map[string]*ActiveProcess = make(chan map[string]*ActiveProcess)
-		
-		shutdownChan chan bool = make(chan bool) // channel used for shuting down the application
-	)
+	// Load the application rules, used by the meter and the application queries, and the services naming the protocols
+	if config.Rules, err = meter.LoadApplicationRules(config.RulesPath); err != nil {
+		log.Fatal("Unable to load application rules: ", err)
+	}
+	config.Services = meter.LoadServices()
 
-	bufferDatabase = append(bufferDatabase, make(map[string]*ActiveProcess))
+	// Analyze a capture file and exit, if one was provided. Its traffic is not saved
+	if config.CaptureFile != "" {
+		if trafficMeter, err = meter.New(config.Config, meter.NewSocketResolver(), nil); err != nil {
+			log.Fatal(err)
+		}
 
-	// Set MAC addresses
-	if macs, err = GetMacAddresses(); err != nil {
-		log.Fatal("Unable to retrieve MAC addresses: ", err)
+		if summary, err := trafficMeter.AnalyzeCaptureFile(config.CaptureFile); err != nil {
+			log.Fatal("Unable to read capture file: ", err)
+		} else {
+			PrintCaptureSummary(summary)
+		}
+		return
 	}
 
 	// Start the database
-	if db, err = OpenDatabase(); err != nil {
+	if db, err = OpenDatabase(config.DatabasePath, config.Services); err != nil {
 		log.Fatal("Unable to open database: ", err)
 	}
 
-	// Starts the web server
-	go StartWebserver(db, &bufferDatabaseMutex, shutdownChan)
-
-	// Starts mapping processes in relation to their sockets.
-	go GetSocketConnections(1, &getConnectionsMutex)
-
-	// Sends the active processes within 1 second to the client
-	go ManageParserBuffer(bufferParserChan, &bufferParserMutex, &bufferDatabaseMutex)
-
-	// Send the active processes within 5 minutes to the database
-	go ManageDatabaseBuffer(db, &bufferDatabaseMutex)
-
-	// Rollup the databases every hour
-	go ManageRollupDatabase(db)
-
-	// Parse the active processes into JSON in intervals of 1 second.
-	go ParseActiveProcesses(bufferParserChan)
-
-	for {
-		select {
-		case <-shutdownChan:
-			SaveBufferToDatabase(db, &bufferDatabaseMutex)
-			for _, iface := range currentInterfaces {
-				if strings.Contains(iface.Description, "loopback") || strings.Contains(iface.Description, "tunnel") {
-					continue
-				}
-				log.Println("Closing interface: ", iface.Description)
-				close(stopSignal[iface.Name])
-			}
-			return
-		default:
-			// Gets interfaces
-			if ifaces, err := GetInterfaceList(); err != nil {
-				log.Fatal("Unable to retrieve interfaces")
-			} else {
-				addedInterfaces, removedInterfaces := CheckInterfaces(currentInterfaces, ifaces)
-				currentInterfaces = ifaces
-				if len(removedInterfaces) > 0 {
-					//Removes interfaces not found
-					for _, iface := range removedInterfaces {
-						log.Println("Removed interface: ", iface.Description)
-						close(stopSignal[iface.Name])
-					}
-				}
-				if len(addedInterfaces) > 0 {
-					// Loop through the new interfaces
-					for _, iface := range addedInterfaces {
-
-						// if iface.Description contains "loopback" or "tunnel" then continue
-						if strings.Contains(iface.Description, "loopback") || strings.Contains(iface.Description, "tunnel") {
-							continue
-						}
+	// Create the meter, resolving sockets on demand where supported and saving its traffic to the database
+	if trafficMeter, err = meter.New(config.Config, meter.NewSocketResolver(), DatabaseStorage{db: db}); err != nil {
+		log.Fatal(err)
+	}
 
-						// Create a handle for the interface.
-						if handle, err := CreateHandle(iface.Name); err != nil {
-							log.Println("Unable do handle interface: ", iface.Description)
-							continue
-						} else {
-							log.Println("Added interface: ", iface.Description)
+	// Start capturing on the selected interfaces
+	if err = trafficMeter.Start(); err != nil {
+		log.Fatal("Unable to start capturing: ", err)
+	}
 
-							// Create the stop signal channel for this interface
-							stopSignal[iface.Name] = make(chan bool)
+	// Starts the web server
+	go StartWebserver(db, trafficMeter, config.Rules, shutdownChan, config.ListenAddress, config.Verbose)
 
-							// Create the go routine for this interface
-							go func(handle *pcap.Handle, iface NetworkInterface, stopSignal chan bool) {
-								packetSource := gopacket.NewPacketSource(handle, handle.LinkType())
-								for {
-									select {
-									case <-stopSignal:
-										handle.Close()
-										return
-									default:
-										// Read packets from the packetSource
-										for packet := range packetSource.Packets() {
-											// Lock the activeProcesses map and process the packet.
-											bufferParserMutex.Lock()
-											bufferDatabaseMutex.Lock()
-											lastBufferDatabase := bufferDatabase[len(bufferDatabase)-1]
-											ProcessPacket(packet, macs, &getConnectionsMutex, bufferParser, lastBufferDatabase)
-											bufferParserMutex.Unlock()
-											bufferDatabaseMutex.Unlock()
-										}
-									}
-								}
-							}(handle, iface, stopSignal[iface.Name])
-						}
-					}
-				}
-			}
-		}
+	// Rollup the databases every rollup interval
+	go ManageRollupDatabase(db, config.RollupInterval)
 
-		time.Sleep(time.Second)
-	}
+	// Close the interfaces and save the remaining traffic once the application is shut down
+	<-shutdownChan
+	trafficMeter.Stop()
 }
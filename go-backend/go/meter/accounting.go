@@ -0,0 +1,63 @@
+package meter
+
+import (
+	"fmt"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Accounting modes, selecting which bytes of a packet are counted as traffic.
+const (
+	AccountingPayload = "payload" // AccountingPayload counts the application payload only: the payload of the transport layer, or of the ICMP message
+	AccountingIP      = "ip"      // AccountingIP counts the IP packet, including the IP and transport headers
+	AccountingWire    = "wire"    // AccountingWire counts the frame as seen on the wire, as the ISP does
+)
+
+// ValidateAccounting checks if an accounting mode is supported.
+func ValidateAccounting(mode string) error {
+	switch mode {
+	case AccountingPayload, AccountingIP, AccountingWire:
+		return nil
+	default:
+		return fmt.Errorf("unknown accounting mode %q", mode)
+	}
+}
+
+// PacketSize returns the number of bytes of a packet counted by the accounting mode.
+// Packets without payload count as zero bytes in AccountingPayload, and packets without IP layer count their link payload in AccountingIP.
+func PacketSize(packet gopacket.Packet, mode string) uint64 {
+	switch mode {
+	case AccountingIP:
+		// Use the lengths from the headers, as the packet may be truncated by the snapshot length
+		switch networkLayer := packet.NetworkLayer().(type) {
+		case *layers.IPv4:
+			return uint64(networkLayer.Length)
+		case *layers.IPv6:
+			return uint64(len(networkLayer.Contents)) + uint64(networkLayer.Length)
+		}
+
+		if linkLayer := packet.LinkLayer(); linkLayer != nil {
+			return uint64(len(linkLayer.LayerPayload()))
+		}
+		return uint64(len(packet.Data()))
+	case AccountingWire:
+		return uint64(packet.Metadata().Length)
+	default:
+		// Count the transport payload, as gopacket decodes some protocols, such as TLS and DNS, into application layers without payload
+		if transportLayer := packet.TransportLayer(); transportLayer != nil {
+			return uint64(len(transportLayer.LayerPayload()))
+		}
+		// Count the ICMP message after its header, as gopacket decodes some messages, such as ICMPv6 echoes, into layers without payload
+		if icmpLayer := packet.Layer(layers.LayerTypeICMPv4); icmpLayer != nil {
+			return uint64(len(icmpLayer.LayerPayload()))
+		}
+		if icmpLayer := packet.Layer(layers.LayerTypeICMPv6); icmpLayer != nil {
+			return uint64(len(icmpLayer.LayerPayload()))
+		}
+		if applicationLayer := packet.ApplicationLayer(); applicationLayer != nil {
+			return uint64(len(applicationLayer.Payload()))
+		}
+		return 0
+	}
+}
@@ -0,0 +1,231 @@
+package meter
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+)
+
+// NetworkInterface stores relevant information from devices listed by pcap.FindAllDevs()
+type NetworkInterface struct {
+	Index       int
+	Description string
+	Name        string
+	Loopback    bool // Loopback is set for the loopback interface, which is only captured on request
+	Tunnel      bool // Tunnel is set for VPN and tunnel interfaces, which are only captured on request
+
+	addresses []netip.Addr // addresses stores the IP addresses of the interface, to match it with the operating system's interfaces
+}
+
+const (
+	pcapIfLoopback = 0x1 // pcapIfLoopback is the PCAP_IF_LOOPBACK flag of pcap.Interface
+	dltRaw         = 12  // dltRaw is DLT_RAW on most platforms, which pcap may return instead of LinkTypeRaw
+	dltRawOpenBSD  = 14  // dltRawOpenBSD is DLT_RAW on OpenBSD
+)
+
+// tunnelPrefixes lists the name prefixes of common VPN and tunnel interfaces, for platforms whose descriptions do not tell them apart.
+var tunnelPrefixes = []string{"tun", "tap", "wg", "utun", "ppp", "ipsec", "gre", "gif", "sit", "vti", "zt", "tailscale"}
+
+// GetMacAddresses returns an array of physical hardware addresses for all devices listed in net.Interfaces().
+func GetMacAddresses() (macs []string, err error) {
+	if ifaces, err := net.Interfaces(); err != nil {
+		return macs, err
+	} else {
+		for _, device := range ifaces {
+			if device.HardwareAddr.String() != "" {
+				macs = append(macs, device.HardwareAddr.String())
+			}
+		}
+	}
+
+	return macs, nil
+}
+
+// GetLocalIPs returns the IP addresses assigned to all devices listed in net.Interfaces(), including loopback addresses.
+func GetLocalIPs() (ips []netip.Addr, err error) {
+	if ifaces, err := net.Interfaces(); err != nil {
+		return ips, err
+	} else {
+		for _, device := range ifaces {
+			addrs, err := device.Addrs()
+			if err != nil {
+				continue
+			}
+
+			for _, addr := range addrs {
+				if prefix, err := netip.ParsePrefix(addr.String()); err == nil {
+					ips = append(ips, prefix.Addr().Unmap())
+				}
+			}
+		}
+	}
+
+	return ips, nil
+}
+
+// GetInterface shows a list of network interfaces.
+func GetInterfaceList() (netDevices []NetworkInterface, err error) {
+	if devices, err := pcap.FindAllDevs(); err != nil {
+		return netDevices, err
+	} else {
+		for i, dev := range devices {
+			netDevices = append(netDevices, NetworkInterface{
+				Index:       i,
+				Description: dev.Description,
+				Name:        dev.Name,
+				Loopback:    dev.Flags&pcapIfLoopback != 0 || strings.Contains(strings.ToLower(dev.Description), "loopback"),
+				Tunnel:      IsTunnelInterface(dev.Name, dev.Description),
+				addresses:   GetDeviceAddresses(dev),
+			})
+		}
+	}
+	return netDevices, nil
+}
+
+// GetDeviceAddresses returns the IP addresses of a pcap device.
+func GetDeviceAddresses(dev pcap.Interface) (addresses []netip.Addr) {
+	for _, address := range dev.Addresses {
+		if addr, ok := netip.AddrFromSlice(address.IP); ok {
+			addresses = append(addresses, addr.Unmap())
+		}
+	}
+	return addresses
+}
+
+// GetSystemInterfaceName returns the operating system's name of a pcap device, as used by the kernel's interface counters.
+// Devices are matched by name, or by their IP addresses where pcap uses its own names, such as the NPF devices on Windows.
+func GetSystemInterfaceName(iface NetworkInterface) string {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return iface.Name
+	}
+
+	for _, device := range ifaces {
+		if device.Name == iface.Name {
+			return device.Name
+		}
+	}
+
+	for _, device := range ifaces {
+		addrs, err := device.Addrs()
+		if err != nil {
+			continue
+		}
+
+		for _, addr := range addrs {
+			prefix, err := netip.ParsePrefix(addr.String())
+			if err != nil {
+				continue
+			}
+
+			for _, address := range iface.addresses {
+				if prefix.Addr().Unmap() == address {
+					return device.Name
+				}
+			}
+		}
+	}
+
+	return iface.Name
+}
+
+// IsTunnelInterface reports whether an interface is a VPN or tunnel, by its description or the prefix of its name.
+func IsTunnelInterface(name, description string) bool {
+	if strings.Contains(strings.ToLower(description), "tunnel") {
+		return true
+	}
+
+	name = strings.ToLower(name)
+	for _, prefix := range tunnelPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Compare current interfaces with new ones
+func CheckInterfaces(oldInterfaces []NetworkInterface, newInterfaces []NetworkInterface) (addedInterfaces []NetworkInterface, removedInterfaces []NetworkInterface) {
+	addedInterfaces = make([]NetworkInterface, 0)
+	removedInterfaces = make([]NetworkInterface, 0)
+
+	for _, oldInterface := range oldInterfaces {
+		found := false
+		for _, newInterface := range newInterfaces {
+			if oldInterface.Name == newInterface.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			removedInterfaces = append(removedInterfaces, oldInterface)
+		}
+	}
+
+	for _, newInterface := range newInterfaces {
+		found := false
+		for _, oldInterface := range oldInterfaces {
+			if oldInterface.Name == newInterface.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			addedInterfaces = append(addedInterfaces, newInterface)
+		}
+	}
+
+	return addedInterfaces, removedInterfaces
+}
+
+// GetLinkType returns the link type used to decode a handle's packets.
+// Raw IP captures are reported by some platforms with their DLT value, which gopacket does not decode.
+func GetLinkType(handle *pcap.Handle) layers.LinkType {
+	switch linkType := handle.LinkType(); linkType {
+	case dltRaw, dltRawOpenBSD:
+		return layers.LinkTypeRaw
+	default:
+		return linkType
+	}
+}
+
+// GetIPs returns the source and destination addresses of a packet's network layer. IPv4-mapped IPv6 addresses are returned as IPv4.
+func GetIPs(networklayer gopacket.NetworkLayer) (netip.Addr, netip.Addr, error) {
+	srcIP, ok := netip.AddrFromSlice(networklayer.NetworkFlow().Src().Raw())
+	if !ok {
+		return netip.Addr{}, netip.Addr{}, errors.New("Invalid source address")
+	}
+
+	destIP, ok := netip.AddrFromSlice(networklayer.NetworkFlow().Dst().Raw())
+	if !ok {
+		return netip.Addr{}, netip.Addr{}, errors.New("Invalid destination address")
+	}
+
+	return srcIP.Unmap(), destIP.Unmap(), nil
+}
+
+func GetPorts(transportLayer gopacket.TransportLayer)(uint64, uint64, error){
+	var (
+		srcPort  uint64
+		destPort uint64
+		err      error
+	)
+	srcPortStr := transportLayer.TransportFlow().Src().String()
+	destPortStr := transportLayer.TransportFlow().Dst().String()
+
+	if srcPort, err = strconv.ParseUint(srcPortStr, 10, 32); err != nil {
+		return 0, 0, err
+	}
+	if destPort, err = strconv.ParseUint(destPortStr, 10, 32); err != nil {
+		return 0, 0, err
+	}
+
+	return srcPort, destPort, nil
+}
\ No newline at end of file
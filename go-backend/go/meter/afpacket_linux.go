@@ -0,0 +1,253 @@
+//go:build linux
+
+package meter
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/afpacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
+)
+
+// afpacketSupported reports whether AF_PACKET captures can be opened on this platform.
+const afpacketSupported = true
+
+// Settings of the AF_PACKET sockets.
+const (
+	afpacketSnapLength  = 1600                   // afpacketSnapLength is the number of bytes kept of each packet, as for the libpcap handles
+	afpacketBlockSize   = 1 << 20                // afpacketBlockSize is the size of the ring's blocks, which the kernel fills with packets
+	afpacketNumBlocks   = 8                      // afpacketNumBlocks is the number of blocks of each socket's ring, buffering 8 MiB of packets
+	afpacketPollTimeout = 100 * time.Millisecond // afpacketPollTimeout bounds the time a source takes to notice its capture was closed
+)
+
+// AFPacketCapture is the CaptureHandle of an interface captured with AF_PACKET sockets, each with its own memory-mapped ring.
+// With several sockets, the kernel spreads the interface's packets over them by flow, so each flow is read by a single goroutine.
+type AFPacketCapture struct {
+	iface    string
+	linkType layers.LinkType
+	sources  []CaptureSource
+	closed   atomic.Bool // closed is set by Close; each source closes its socket on its next read
+}
+
+// afpacketSource reads the packets of one AF_PACKET socket of a capture.
+type afpacketSource struct {
+	capture *AFPacketCapture
+	socket  *afpacket.TPacket
+}
+
+// OpenAFPacket opens an AF_PACKET capture of a network interface, with 'fanout' sockets, applying the BPF filter if one is provided.
+// The filter is attached to each socket before it joins the fanout group, so no packet is read unfiltered.
+func OpenAFPacket(networkInterface string, filter string, fanout int) (CaptureHandle, error) {
+	linkType, err := afpacketLinkType(networkInterface)
+	if err != nil {
+		return nil, err
+	}
+
+	// Always set a filter, so packets are truncated to the snapshot length as with the libpcap handles
+	capture := &AFPacketCapture{iface: networkInterface, linkType: linkType}
+	program, err := capture.compileProgram(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var fanoutGroup *afpacketFanoutGroup
+	if fanout > 1 {
+		if fanoutGroup, err = newAFPacketFanoutGroup(networkInterface); err != nil {
+			return nil, fmt.Errorf("unable to create AF_PACKET fanout group on %s: %w", networkInterface, err)
+		}
+		defer fanoutGroup.Close()
+	}
+
+	for i := 0; i < fanout; i++ {
+		socket, err := afpacket.NewTPacket(
+			afpacket.OptInterface(networkInterface),
+			afpacket.OptTPacketVersion(afpacket.TPacketVersion3),
+			afpacket.OptBlockSize(afpacketBlockSize),
+			afpacket.OptNumBlocks(afpacketNumBlocks),
+			afpacket.OptPollTimeout(afpacketPollTimeout),
+		)
+		if err == nil {
+			if err = socket.SetBPF(program); err == nil && fanoutGroup != nil {
+				err = socket.SetFanout(afpacket.FanoutHash, fanoutGroup.id)
+			}
+			if err != nil {
+				socket.Close()
+			}
+		}
+		if err != nil {
+			capture.closeSockets()
+			return nil, fmt.Errorf("unable to open AF_PACKET socket on %s: %w", networkInterface, err)
+		}
+
+		capture.sources = append(capture.sources, &afpacketSource{capture: capture, socket: socket})
+	}
+
+	return capture, nil
+}
+
+// afpacketFanoutGroup is a fanout group created for the sockets of a capture, held by a socket of its own until they all joined it.
+// Fanout group ids are shared by every process of the network namespace, so the kernel picks an id no other group uses.
+type afpacketFanoutGroup struct {
+	fd int
+	id uint16
+}
+
+// newAFPacketFanoutGroup creates a fanout group on an interface, with a unique id given by the kernel (PACKET_FANOUT_FLAG_UNIQUEID, Linux 4.20 or later).
+// The group is held by a socket that drops every packet, so the capture's sockets can join it; it must be closed once they have.
+func newAFPacketFanoutGroup(networkInterface string) (*afpacketFanoutGroup, error) {
+	ethernetAll := int(uint16(unix.ETH_P_ALL)<<8 | uint16(unix.ETH_P_ALL)>>8) // ethernetAll is ETH_P_ALL in network byte order
+
+	iface, err := net.InterfaceByName(networkInterface)
+	if err != nil {
+		return nil, err
+	}
+
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW, ethernetAll)
+	if err != nil {
+		return nil, err
+	}
+	group := &afpacketFanoutGroup{fd: fd}
+
+	// Drop the packets the group gives this socket, before binding it to the interface
+	drop := []unix.SockFilter{{Code: unix.BPF_RET | unix.BPF_K, K: 0}}
+	if err = unix.SetsockoptSockFprog(fd, unix.SOL_SOCKET, unix.SO_ATTACH_FILTER, &unix.SockFprog{Len: 1, Filter: &drop[0]}); err != nil {
+		group.Close()
+		return nil, err
+	}
+	if err = unix.Bind(fd, &unix.SockaddrLinklayer{Protocol: uint16(ethernetAll), Ifindex: iface.Index}); err != nil {
+		group.Close()
+		return nil, err
+	}
+
+	// Join a new group of id 0, which the kernel replaces by an unused id, then read that id back
+	if err = unix.SetsockoptInt(fd, unix.SOL_PACKET, unix.PACKET_FANOUT, (unix.PACKET_FANOUT_HASH|unix.PACKET_FANOUT_FLAG_UNIQUEID)<<16); err != nil {
+		group.Close()
+		return nil, err
+	}
+	var (
+		fanout int32
+		size   = uint32(unsafe.Sizeof(fanout))
+	)
+	if _, _, errno := unix.Syscall6(unix.SYS_GETSOCKOPT, uintptr(fd), unix.SOL_PACKET, unix.PACKET_FANOUT, uintptr(unsafe.Pointer(&fanout)), uintptr(unsafe.Pointer(&size)), 0); errno != 0 {
+		group.Close()
+		return nil, errno
+	}
+	group.id = uint16(fanout)
+
+	return group, nil
+}
+
+// Close leaves the fanout group, which remains as long as the capture's sockets are in it.
+func (group *afpacketFanoutGroup) Close() {
+	unix.Close(group.fd)
+}
+
+// afpacketLinkType returns the link type of the packets read from an interface's AF_PACKET sockets, given the interface's hardware type.
+func afpacketLinkType(networkInterface string) (layers.LinkType, error) {
+	content, err := os.ReadFile("/sys/class/net/" + networkInterface + "/type")
+	if err != nil {
+		return 0, err
+	}
+
+	hardwareType, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		return 0, err
+	}
+
+	switch hardwareType {
+	case unix.ARPHRD_ETHER, unix.ARPHRD_LOOPBACK:
+		return layers.LinkTypeEthernet, nil
+	case unix.ARPHRD_NONE, unix.ARPHRD_PPP, unix.ARPHRD_RAWIP, unix.ARPHRD_TUNNEL:
+		// Packets of interfaces without link header, such as VPN tunnels, start with their IP header
+		return layers.LinkTypeRaw, nil
+	default:
+		return 0, fmt.Errorf("%w: hardware type %d", errUnsupportedLinkType, hardwareType)
+	}
+}
+
+func (capture *AFPacketCapture) Sources() []CaptureSource {
+	return capture.sources
+}
+
+func (capture *AFPacketCapture) LinkType() layers.LinkType {
+	return capture.linkType
+}
+
+// Close stops the capture. The sockets are closed by their sources, once their reads return.
+func (capture *AFPacketCapture) Close() {
+	capture.closed.Store(true)
+}
+
+// CompileBPFFilter compiles a BPF expression for the capture's link type and snapshot length.
+func (capture *AFPacketCapture) CompileBPFFilter(expr string) ([]pcap.BPFInstruction, error) {
+	return pcap.CompileBPFFilter(bpfLinkType(capture.linkType), afpacketSnapLength, expr)
+}
+
+// compileProgram compiles a BPF expression into the program attached to the capture's sockets.
+func (capture *AFPacketCapture) compileProgram(expr string) ([]bpf.RawInstruction, error) {
+	instructions, err := capture.CompileBPFFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	program := make([]bpf.RawInstruction, 0, len(instructions))
+	for _, instruction := range instructions {
+		program = append(program, bpf.RawInstruction{Op: instruction.Code, Jt: instruction.Jt, Jf: instruction.Jf, K: instruction.K})
+	}
+
+	return program, nil
+}
+
+// SetBPFFilter compiles a BPF expression and attaches it to every socket of the capture.
+func (capture *AFPacketCapture) SetBPFFilter(expr string) error {
+	program, err := capture.compileProgram(expr)
+	if err != nil {
+		return err
+	}
+
+	for _, source := range capture.sources {
+		if err = source.(*afpacketSource).socket.SetBPF(program); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// closeSockets closes every socket of a capture that failed to open.
+func (capture *AFPacketCapture) closeSockets() {
+	for _, source := range capture.sources {
+		source.(*afpacketSource).socket.Close()
+	}
+}
+
+// ReadPacketData reads and copies the next packet, returning io.EOF once the capture is closed.
+func (source *afpacketSource) ReadPacketData() (data []byte, ci gopacket.CaptureInfo, err error) {
+	if source.capture.closed.Load() {
+		source.socket.Close()
+		return nil, ci, io.EOF
+	}
+	return source.socket.ReadPacketData()
+}
+
+// ZeroCopyReadPacketData reads the next packet without copying it, returning io.EOF once the capture is closed.
+// The data is only valid until the next read.
+func (source *afpacketSource) ZeroCopyReadPacketData() (data []byte, ci gopacket.CaptureInfo, err error) {
+	if source.capture.closed.Load() {
+		source.socket.Close()
+		return nil, ci, io.EOF
+	}
+	return source.socket.ZeroCopyReadPacketData()
+}
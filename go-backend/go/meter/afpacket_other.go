@@ -0,0 +1,13 @@
+//go:build !linux
+
+package meter
+
+import "errors"
+
+// afpacketSupported reports whether AF_PACKET captures can be opened on this platform.
+const afpacketSupported = false
+
+// OpenAFPacket is only supported on Linux; ValidateBackend rejects the AF_PACKET backend on other platforms.
+func OpenAFPacket(networkInterface string, filter string, fanout int) (CaptureHandle, error) {
+	return nil, errors.New("AF_PACKET captures are only supported on Linux")
+}
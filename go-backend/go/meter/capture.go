@@ -0,0 +1,89 @@
+package meter
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+)
+
+// Capture backends, selecting how the packets of an interface are read.
+const (
+	BackendPcap     = "pcap"     // BackendPcap reads packets from a libpcap handle, on every platform
+	BackendAFPacket = "afpacket" // BackendAFPacket reads packets from memory-mapped TPACKET_V3 rings, on Linux only
+)
+
+// maxFanout is the maximum number of sockets of an AF_PACKET capture, the default limit of a fanout group's members in the kernel.
+const maxFanout = 256
+
+// CaptureHandle is an open capture of an interface. Each of its sources is read by its own capture goroutine.
+type CaptureHandle interface {
+	FilterHandle
+	Sources() []CaptureSource // Sources returns the sources the interface's packets are spread over, decoded with the handle's link type
+	Close()                   // Close stops the capture; reading a source then returns io.EOF
+}
+
+// pcapCapture is the CaptureHandle of a libpcap handle, with a single source.
+type pcapCapture struct {
+	*pcap.Handle
+}
+
+// ValidateBackend checks if a capture backend is supported on this platform.
+func ValidateBackend(backend string) error {
+	switch backend {
+	case BackendPcap:
+		return nil
+	case BackendAFPacket:
+		if !afpacketSupported {
+			return fmt.Errorf("capture backend %q is only supported on Linux", backend)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown capture backend %q", backend)
+	}
+}
+
+// OpenCapture opens a capture of a network interface with the given backend, applying the BPF filter if one is provided.
+// AF_PACKET captures are spread over 'fanout' sockets; interfaces whose link type AF_PACKET captures cannot decode are captured with libpcap.
+func OpenCapture(networkInterface string, filter string, backend string, fanout int) (CaptureHandle, error) {
+	if backend == BackendAFPacket {
+		capture, err := OpenAFPacket(networkInterface, filter, fanout)
+		if !errors.Is(err, errUnsupportedLinkType) {
+			return capture, err
+		}
+		log.Println("AF_PACKET unavailable for interface ", networkInterface, ", using pcap: ", err)
+	}
+
+	handle, err := CreateHandle(networkInterface, filter)
+	if err != nil {
+		return nil, err
+	}
+	return pcapCapture{handle}, nil
+}
+
+// CreateHandle receives a network interface's name and returns a handle if no errors occur.
+// The BPF filter is applied to the handle if one is provided.
+func CreateHandle(networkInterface string, filter string) (*pcap.Handle, error) {
+	if handle, err := pcap.OpenLive(networkInterface, 1600, true, pcap.BlockForever); err != nil {
+		log.Println(err)
+		return nil, err
+	} else {
+		if filter != "" {
+			if err = handle.SetBPFFilter(filter); err != nil {
+				handle.Close()
+				return nil, err
+			}
+		}
+		return handle, nil
+	}
+}
+
+func (capture pcapCapture) Sources() []CaptureSource {
+	return []CaptureSource{capture.Handle}
+}
+
+func (capture pcapCapture) LinkType() layers.LinkType {
+	return GetLinkType(capture.Handle)
+}
@@ -0,0 +1,90 @@
+package meter
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Kinds of cgroup, prefixed to the cgroup names returned by ParseCgroup.
+const (
+	CgroupDocker     = "docker"     // CgroupDocker is a Docker container
+	CgroupContainerd = "containerd" // CgroupContainerd is a containerd container, such as a Kubernetes pod's
+	CgroupPod        = "pod"        // CgroupPod is a Kubernetes pod's container whose runtime is not named in its cgroup, with the cgroupfs driver
+	CgroupCrio       = "cri-o"      // CgroupCrio is a CRI-O container
+	CgroupPodman     = "podman"     // CgroupPodman is a Podman container
+	CgroupSystemd    = "systemd"    // CgroupSystemd is a systemd unit, for processes outside containers
+)
+
+// containerIdLength is the length of the container IDs in the cgroup names, matching the short IDs shown by docker and podman.
+const containerIdLength = 12
+
+// containerPatterns match the cgroup path components of the container runtimes, capturing the container ID.
+var containerPatterns = []struct {
+	kind    string
+	pattern *regexp.Regexp
+}{
+	{CgroupDocker, regexp.MustCompile(`^docker-([0-9a-f]{64})\.scope$`)},
+	{CgroupContainerd, regexp.MustCompile(`^cri-containerd-([0-9a-f]{64})\.scope$`)},
+	{CgroupContainerd, regexp.MustCompile(`:cri-containerd:([0-9a-f]{64})$`)},
+	{CgroupCrio, regexp.MustCompile(`^crio-([0-9a-f]{64})\.scope$`)},
+	{CgroupPodman, regexp.MustCompile(`^libpod-([0-9a-f]{64})\.scope$`)},
+	{CgroupPodman, regexp.MustCompile(`^libpod-([0-9a-f]{64})$`)},
+}
+
+// cgroupfsParents maps the parents of a container's cgroup with the cgroupfs driver, such as "/docker/<id>", to the container's kind.
+var cgroupfsParents = map[string]string{
+	"docker":   CgroupDocker,
+	"libpod":   CgroupPodman,
+	"kubepods": CgroupPod,
+}
+
+// containerId matches the cgroup path components named after a container ID, with the cgroupfs driver.
+var containerId = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// ParseCgroup returns the name of a process' container or systemd unit, given the contents of /proc/<pid>/cgroup.
+// Names are formatted as "<kind>/<id>", such as "docker/3f2a1b4c5d6e" or "systemd/nginx.service"; empty if neither is found.
+func ParseCgroup(content string) string {
+	var unit string
+
+	// Lines are formatted as "<hierarchy>:<controllers>:<path>"; cgroup v2 has a single "0::<path>" line
+	for _, line := range strings.Split(strings.TrimSpace(content), "\n") {
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+
+		components := strings.Split(strings.Trim(fields[2], "/"), "/")
+
+		// Containers are found in any hierarchy, from the innermost cgroup
+		for i := len(components) - 1; i >= 0; i-- {
+			for _, container := range containerPatterns {
+				if match := container.pattern.FindStringSubmatch(components[i]); match != nil {
+					return container.kind + "/" + match[1][:containerIdLength]
+				}
+			}
+
+			if i > 0 && containerId.MatchString(components[i]) {
+				for j := i - 1; j >= 0; j-- {
+					if kind, ok := cgroupfsParents[strings.SplitN(components[j], "-", 2)[0]]; ok {
+						return kind + "/" + components[i][:containerIdLength]
+					}
+				}
+			}
+		}
+
+		// The unit is the innermost service or scope of the systemd hierarchy, or of the unified hierarchy
+		if unit == "" && (fields[1] == "name=systemd" || fields[0] == "0") {
+			for i := len(components) - 1; i >= 0; i-- {
+				if strings.HasSuffix(components[i], ".service") || strings.HasSuffix(components[i], ".scope") {
+					unit = components[i]
+					break
+				}
+			}
+		}
+	}
+
+	if unit != "" {
+		return CgroupSystemd + "/" + unit
+	}
+	return ""
+}
@@ -0,0 +1,19 @@
+//go:build linux
+
+package meter
+
+import (
+	"os"
+	"strconv"
+)
+
+// ProcessCgroup returns the name of the container or systemd unit a process runs in, as returned by ParseCgroup.
+// Returns an empty string if the process has exited or its cgroup cannot be read.
+func ProcessCgroup(pid int32) string {
+	content, err := os.ReadFile("/proc/" + strconv.FormatInt(int64(pid), 10) + "/cgroup")
+	if err != nil {
+		return ""
+	}
+
+	return ParseCgroup(string(content))
+}
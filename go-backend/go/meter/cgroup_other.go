@@ -0,0 +1,8 @@
+//go:build !linux
+
+package meter
+
+// ProcessCgroup returns an empty string, as cgroups only exist on Linux.
+func ProcessCgroup(pid int32) string {
+	return ""
+}
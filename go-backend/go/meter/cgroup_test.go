@@ -0,0 +1,44 @@
+package meter
+
+import "testing"
+
+// cgroupTestId is a container ID, as found in the cgroup paths of the container runtimes.
+const cgroupTestId = "3f2a1b4c5d6e7f8091a2b3c4d5e6f708192a3b4c5d6e7f8091a2b3c4d5e6f708"
+
+func TestParseCgroup(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{"v2 systemd service", "0::/system.slice/nginx.service\n", "systemd/nginx.service"},
+		{"v2 user session", "0::/user.slice/user-1000.slice/session-2.scope\n", "systemd/session-2.scope"},
+		{"v2 user application", "0::/user.slice/user-1000.slice/user@1000.service/app.slice/app-firefox-1234.scope\n", "systemd/app-firefox-1234.scope"},
+		{"v2 user manager", "0::/user.slice/user-1000.slice/user@1000.service/init.scope\n", "systemd/init.scope"},
+		{"v2 root", "0::/\n", ""},
+		{"v1 systemd service", "12:memory:/system.slice/sshd.service\n1:name=systemd:/system.slice/sshd.service\n0::/system.slice/sshd.service\n", "systemd/sshd.service"},
+		{"v1 controllers only", "12:memory:/system.slice/sshd.service\n", ""},
+		{"v2 docker systemd driver", "0::/system.slice/docker-" + cgroupTestId + ".scope\n", "docker/3f2a1b4c5d6e"},
+		{"v1 docker cgroupfs driver", "12:memory:/docker/" + cgroupTestId + "\n1:name=systemd:/docker/" + cgroupTestId + "\n", "docker/3f2a1b4c5d6e"},
+		{"v2 docker cgroupfs driver", "0::/docker/" + cgroupTestId + "\n", "docker/3f2a1b4c5d6e"},
+		{"v2 podman", "0::/machine.slice/libpod-" + cgroupTestId + ".scope\n", "podman/3f2a1b4c5d6e"},
+		{"v2 rootless podman", "0::/user.slice/user-1000.slice/user@1000.service/user.slice/libpod-" + cgroupTestId + ".scope/container\n", "podman/3f2a1b4c5d6e"},
+		{"v1 podman cgroupfs driver", "12:memory:/libpod_parent/libpod-" + cgroupTestId + "\n", "podman/3f2a1b4c5d6e"},
+		{"v2 containerd systemd driver", "0::/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1a2b.slice/cri-containerd-" + cgroupTestId + ".scope\n", "containerd/3f2a1b4c5d6e"},
+		{"v2 containerd in systemd unit", "0::/system.slice/containerd.service/kubepods-besteffort-pod1a2b.slice:cri-containerd:" + cgroupTestId + "\n", "containerd/3f2a1b4c5d6e"},
+		{"v2 cri-o systemd driver", "0::/kubepods.slice/kubepods-pod1a2b.slice/crio-" + cgroupTestId + ".scope\n", "cri-o/3f2a1b4c5d6e"},
+		{"v2 docker in pod systemd driver", "0::/kubepods.slice/kubepods-pod1a2b.slice/docker-" + cgroupTestId + ".scope\n", "docker/3f2a1b4c5d6e"},
+		{"v1 pod cgroupfs driver", "12:memory:/kubepods/burstable/pod1a2b/" + cgroupTestId + "\n1:name=systemd:/kubepods/burstable/pod1a2b/" + cgroupTestId + "\n", "pod/3f2a1b4c5d6e"},
+		{"v2 pod cgroupfs driver", "0::/kubepods/besteffort/pod1a2b/" + cgroupTestId + "\n", "pod/3f2a1b4c5d6e"},
+		{"unknown parent", "0::/custom/" + cgroupTestId + "\n", ""},
+		{"empty", "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if cgroup := ParseCgroup(test.content); cgroup != test.expected {
+				t.Errorf("ParseCgroup(%q) = %q, expected %q", test.content, cgroup, test.expected)
+			}
+		})
+	}
+}
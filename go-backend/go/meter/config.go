@@ -0,0 +1,145 @@
+package meter
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket/layers"
+)
+
+// Config stores the settings of a Meter: the interfaces captured, how their packets are read and how their traffic is counted.
+type Config struct {
+	Interfaces        []string          // Interfaces lists the network interfaces to capture on. All interfaces are captured if empty
+	ExcludeInterfaces []string          // ExcludeInterfaces lists the network interfaces that must not be captured
+	Filter            string            // Filter is a BPF expression applied to every capture handle
+	InterfaceFilters  map[string]string // InterfaceFilters maps an interface name to a BPF expression overriding Filter
+	Decoder           string            // Decoder is the decoder used for every capture source ("gopacket" or "fast")
+	InterfaceDecoders map[string]string // InterfaceDecoders maps an interface name to a decoder overriding Decoder
+	Backend           string            // Backend is the capture backend used for every interface ("pcap" or "afpacket")
+	InterfaceBackends map[string]string // InterfaceBackends maps an interface name to a capture backend overriding Backend
+	Fanout            int               // Fanout is the number of AF_PACKET sockets, each read by its own goroutine, an interface is captured with
+	CaptureLoopback   bool              // CaptureLoopback enables capture on the loopback interface
+	CaptureTunnels    bool              // CaptureTunnels enables capture on VPN and tunnel interfaces
+	FlushInterval     time.Duration     // FlushInterval is the time between flushes of the traffic to the Storage
+	SocketTimeout     time.Duration     // SocketTimeout is the time a socket is kept in the socket tables after it is no longer found
+	Accounting        string            // Accounting is the mode used to count the bytes of a packet ("payload", "ip" or "wire")
+	Direction         string            // Direction is the strategy used to tell uploads from downloads ("auto", "ip" or "mac")
+	Aggregate         string            // Aggregate is the mode naming the ActiveProcess of a process ("process" or "application")
+	Rules             *ApplicationRules // Rules groups the traffic into applications; traffic is named after its process if nil
+	Services          *Services         // Services names the ports of the protocols; loaded by New if nil
+	Verbose           bool              // Verbose enables logging of discarded packets and debug information
+}
+
+// DefaultConfig returns the settings of a Meter capturing every physical interface with libpcap, counting application payloads.
+func DefaultConfig() Config {
+	return Config{
+		InterfaceFilters:  make(map[string]string),
+		Decoder:           DecoderGopacket,
+		InterfaceDecoders: make(map[string]string),
+		Backend:           BackendPcap,
+		InterfaceBackends: make(map[string]string),
+		Fanout:            1,
+		FlushInterval:     5 * time.Minute,
+		SocketTimeout:     30 * time.Second,
+		Accounting:        AccountingPayload,
+		Direction:         DirectionAuto,
+		Aggregate:         AggregateProcess,
+	}
+}
+
+// Validate checks the settings before any handle is opened, returning the first invalid one.
+func (config *Config) Validate() (err error) {
+	// The link types of the interfaces are only known once they are opened, so filters are checked for Ethernet
+	if err = ValidateFilter(layers.LinkTypeEthernet, config.Filter); err != nil {
+		return fmt.Errorf("invalid filter %q: %w", config.Filter, err)
+	}
+	for iface, filter := range config.InterfaceFilters {
+		if err = ValidateFilter(layers.LinkTypeEthernet, filter); err != nil {
+			return fmt.Errorf("invalid filter %q for interface %s: %w", filter, iface, err)
+		}
+	}
+
+	if err = ValidateDecoder(config.Decoder); err != nil {
+		return err
+	}
+	for iface, decoder := range config.InterfaceDecoders {
+		if err = ValidateDecoder(decoder); err != nil {
+			return fmt.Errorf("invalid decoder for interface %s: %w", iface, err)
+		}
+	}
+
+	if err = ValidateBackend(config.Backend); err != nil {
+		return err
+	}
+	for iface, backend := range config.InterfaceBackends {
+		if err = ValidateBackend(backend); err != nil {
+			return fmt.Errorf("invalid capture backend for interface %s: %w", iface, err)
+		}
+	}
+	if config.Fanout < 1 || config.Fanout > maxFanout {
+		return fmt.Errorf("fanout must be between 1 and %d", maxFanout)
+	}
+
+	if err = ValidateAccounting(config.Accounting); err != nil {
+		return err
+	}
+
+	if err = ValidateDirection(config.Direction); err != nil {
+		return err
+	}
+
+	if err = ValidateAggregation(config.Aggregate); err != nil {
+		return err
+	}
+
+	if config.FlushInterval <= 0 || config.SocketTimeout <= 0 {
+		return fmt.Errorf("intervals must be greater than zero")
+	}
+
+	return nil
+}
+
+// CaptureInterface reports whether the interface should be captured, according to the include and exclude lists.
+// Interfaces are matched by their exact name, or by a case-insensitive part of their description.
+// Loopback and tunnel interfaces are only captured if enabled by their flags, or included by name.
+func (config *Config) CaptureInterface(iface NetworkInterface) bool {
+	for _, excluded := range config.ExcludeInterfaces {
+		if matchInterface(iface, excluded) {
+			return false
+		}
+	}
+
+	if len(config.Interfaces) == 0 {
+		return (!iface.Loopback || config.CaptureLoopback) && (!iface.Tunnel || config.CaptureTunnels)
+	}
+
+	for _, included := range config.Interfaces {
+		if matchInterface(iface, included) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DecoderFor returns the decoder of an interface: its override if one exists, or the global decoder otherwise.
+func (config *Config) DecoderFor(iface string) string {
+	if decoder, ok := config.InterfaceDecoders[iface]; ok {
+		return decoder
+	}
+	return config.Decoder
+}
+
+// BackendFor returns the capture backend of an interface: its override if one exists, or the global backend otherwise.
+func (config *Config) BackendFor(iface string) string {
+	if backend, ok := config.InterfaceBackends[iface]; ok {
+		return backend
+	}
+	return config.Backend
+}
+
+// matchInterface reports whether the interface's name or description matches the given value.
+func matchInterface(iface NetworkInterface, value string) bool {
+	return iface.Name == value || (iface.Description != "" && strings.Contains(strings.ToLower(iface.Description), strings.ToLower(value)))
+}
@@ -0,0 +1,160 @@
+package meter
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	ps_net "github.com/shirou/gopsutil/v3/net"
+)
+
+// coverageInterval is the length of the window over which the kernel counters and the captured bytes are compared.
+const coverageInterval = 10 * time.Second
+
+// InterfaceCoverage compares the bytes the kernel counted on an interface with the bytes captured and attributed to processes, over the last window.
+// Bytes are counted on the wire, regardless of the accounting mode, to match the kernel counters.
+type InterfaceCoverage struct {
+	Interface         string  // Interface is the name of the capture device
+	System_Name       string  // System_Name is the name of the interface in the kernel counters
+	Kernel_Bytes      uint64  // Kernel_Bytes is the number of bytes received and sent, according to the kernel
+	Captured_Bytes    uint64  // Captured_Bytes is the number of bytes captured, attributed or not
+	Attributed_Bytes  uint64  // Attributed_Bytes is the number of bytes attributed to processes, including the pending flows resolved during the window
+	Unexplained_Bytes int64   // Unexplained_Bytes is the number of bytes counted by the kernel but not attributed to processes
+	Coverage          float64 // Coverage is the percentage of the kernel's bytes attributed to processes
+	Window_Start      int64   // Window_Start is the start of the window, in Unix milliseconds
+	Window_End        int64   // Window_End is the end of the window, in Unix milliseconds
+}
+
+// interfaceCounters stores the bytes of an interface in the current window.
+type interfaceCounters struct {
+	systemName  string
+	kernelBytes uint64 // kernelBytes is the kernel's counter at the start of the window
+	hasKernel   bool   // hasKernel is set once kernelBytes has been read
+	captured    uint64
+	attributed  uint64
+}
+
+// CoverageMonitor reconciles the bytes attributed by ProcessPacket with the kernel's interface counters.
+type CoverageMonitor struct {
+	mutex       sync.Mutex
+	interfaces  map[string]*interfaceCounters // interfaces stores the counters of the captured interfaces by name
+	latest      []InterfaceCoverage           // latest stores the coverage of the last complete window
+	windowStart time.Time
+}
+
+// NewCoverageMonitor creates a CoverageMonitor without interfaces.
+func NewCoverageMonitor() *CoverageMonitor {
+	return &CoverageMonitor{interfaces: make(map[string]*interfaceCounters), latest: make([]InterfaceCoverage, 0), windowStart: time.Now()}
+}
+
+// Register starts monitoring a captured interface. Its coverage is reported from the first complete window.
+func (monitor *CoverageMonitor) Register(iface NetworkInterface) {
+	systemName := GetSystemInterfaceName(iface)
+
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+
+	monitor.interfaces[iface.Name] = &interfaceCounters{systemName: systemName}
+}
+
+// Unregister stops monitoring an interface that is no longer captured.
+func (monitor *CoverageMonitor) Unregister(iface string) {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+
+	delete(monitor.interfaces, iface)
+}
+
+// AddBytes counts the bytes captured on an interface, and how many of them were attributed to a process.
+func (monitor *CoverageMonitor) AddBytes(iface string, captured, attributed uint64) {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+
+	if counters, ok := monitor.interfaces[iface]; ok {
+		counters.captured += captured
+		counters.attributed += attributed
+	}
+}
+
+// Update closes the current window, reading the kernel counters and computing the coverage of every interface.
+func (monitor *CoverageMonitor) Update() error {
+	ioCounters, err := ps_net.IOCounters(true)
+	if err != nil {
+		return err
+	}
+
+	kernelBytes := make(map[string]uint64)
+	for _, counter := range ioCounters {
+		kernelBytes[counter.Name] = counter.BytesRecv + counter.BytesSent
+	}
+
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+
+	var (
+		now      = time.Now()
+		coverage = make([]InterfaceCoverage, 0, len(monitor.interfaces))
+	)
+
+	for name, counters := range monitor.interfaces {
+		current, ok := kernelBytes[counters.systemName]
+		if !ok {
+			continue
+		}
+
+		// The first window of an interface starts when its counters are first read, or after they were reset
+		if counters.hasKernel && current >= counters.kernelBytes {
+			entry := InterfaceCoverage{
+				Interface:         name,
+				System_Name:       counters.systemName,
+				Kernel_Bytes:      current - counters.kernelBytes,
+				Captured_Bytes:    counters.captured,
+				Attributed_Bytes:  counters.attributed,
+				Unexplained_Bytes: int64(current-counters.kernelBytes) - int64(counters.attributed),
+				Window_Start:      monitor.windowStart.UnixMilli(),
+				Window_End:        now.UnixMilli(),
+			}
+			if entry.Kernel_Bytes > 0 {
+				entry.Coverage = float64(entry.Attributed_Bytes) / float64(entry.Kernel_Bytes) * 100
+			}
+			coverage = append(coverage, entry)
+		}
+
+		counters.kernelBytes = current
+		counters.hasKernel = true
+		counters.captured = 0
+		counters.attributed = 0
+	}
+
+	monitor.latest = coverage
+	monitor.windowStart = now
+
+	return nil
+}
+
+// Coverage returns the coverage of every interface over the last complete window.
+func (monitor *CoverageMonitor) Coverage() []InterfaceCoverage {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+
+	return append([]InterfaceCoverage{}, monitor.latest...)
+}
+
+// manageCoverage updates the meter's coverage every coverageInterval, until the meter is stopped.
+func (m *Meter) manageCoverage() {
+	defer m.wait.Done()
+
+	var ticker = time.NewTicker(coverageInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := m.coverage.Update(); err != nil {
+				log.Println("Unable to read interface counters: ", err)
+			}
+		case <-m.stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package meter
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Decoders, selecting how the packets of a capture source are decoded before ProcessPacket.
+const (
+	DecoderGopacket = "gopacket" // DecoderGopacket decodes every packet into a new gopacket.Packet, supporting every protocol known to gopacket
+	DecoderFast     = "fast"     // DecoderFast decodes packets into preallocated layers with a DecodingLayerParser, without allocating per packet
+)
+
+// PacketReader reads the next packet of a capture source, such as a gopacket.PacketSource or a FastPacketSource.
+type PacketReader interface {
+	NextPacket() (gopacket.Packet, error)
+}
+
+// CaptureSource is a source of packets that can be read with or without copying them, such as a pcap.Handle.
+type CaptureSource interface {
+	gopacket.PacketDataSource
+	gopacket.ZeroCopyPacketDataSource
+}
+
+// FastPacketSource reads packets without copying them, and decodes them with a FastDecoder.
+// Its packets are only valid until the next call to NextPacket, and must not be retained.
+type FastPacketSource struct {
+	source  gopacket.ZeroCopyPacketDataSource
+	decoder *FastDecoder
+}
+
+// FastDecoder decodes the Ethernet, 802.1Q, IPv4, IPv6, TCP, UDP, ICMP and ARP layers of packets into preallocated layers.
+// Decoding stops at the first unsupported layer, such as an application protocol, which ProcessPacket does not use.
+type FastDecoder struct {
+	ethernet   layers.Ethernet
+	dot1q      layers.Dot1Q
+	linuxSLL   layers.LinuxSLL
+	loopback   layers.Loopback
+	arp        layers.ARP
+	ipv4       layers.IPv4
+	ipv6       layers.IPv6
+	extensions layers.IPv6ExtensionSkipper
+	icmpv4     layers.ICMPv4
+	icmpv6     layers.ICMPv6
+	tcp        layers.TCP
+	udp        layers.UDP
+
+	linkType   layers.LinkType
+	parser     *gopacket.DecodingLayerParser // parser decodes from the link layer, or from IPv4 on raw IP captures
+	parserIPv6 *gopacket.DecodingLayerParser // parserIPv6 decodes from IPv6 on raw IP captures
+	decoded    []gopacket.LayerType          // decoded stores the types of the layers decoded from the last packet
+	packet     fastPacket                    // packet is the packet returned by Decode, reused for every packet
+}
+
+// fastPacket implements gopacket.Packet over the layers of a FastDecoder.
+type fastPacket struct {
+	data        []byte
+	metadata    gopacket.PacketMetadata
+	layers      []gopacket.Layer
+	link        gopacket.LinkLayer
+	network     gopacket.NetworkLayer
+	transport   gopacket.TransportLayer
+	application gopacket.ApplicationLayer
+	payload     gopacket.Payload // payload is the payload of the last decoded layer, returned as the application layer
+}
+
+// errUnsupportedLinkType is returned by NewFastDecoder for link types the FastDecoder cannot decode.
+var errUnsupportedLinkType = errors.New("unsupported link type")
+
+// ValidateDecoder checks if a decoder is supported.
+func ValidateDecoder(decoder string) error {
+	switch decoder {
+	case DecoderGopacket, DecoderFast:
+		return nil
+	default:
+		return fmt.Errorf("unknown decoder %q", decoder)
+	}
+}
+
+// NewPacketReader creates the PacketReader of a capture source using the given decoder.
+// The gopacket decoder is used for link types the FastDecoder does not support.
+func NewPacketReader(source CaptureSource, linkType layers.LinkType, decoder string) PacketReader {
+	if decoder == DecoderFast {
+		if fastDecoder, err := NewFastDecoder(linkType); err != nil {
+			log.Println("Fast decoder unavailable for link type ", linkType, ", using gopacket")
+		} else {
+			return &FastPacketSource{source: source, decoder: fastDecoder}
+		}
+	}
+
+	return gopacket.NewPacketSource(source, linkType)
+}
+
+// NextPacket reads and decodes the next packet. The packet is only valid until the next call.
+func (source *FastPacketSource) NextPacket() (gopacket.Packet, error) {
+	data, ci, err := source.source.ZeroCopyReadPacketData()
+	if err != nil {
+		return nil, err
+	}
+
+	return source.decoder.Decode(data, ci), nil
+}
+
+// NewFastDecoder creates a FastDecoder for the packets of a link type: Ethernet, Linux cooked captures, BSD loopback, or raw IP.
+func NewFastDecoder(linkType layers.LinkType) (*FastDecoder, error) {
+	var (
+		decoder = &FastDecoder{linkType: linkType, decoded: make([]gopacket.LayerType, 0, 8)}
+		first   gopacket.LayerType
+	)
+
+	switch linkType {
+	case layers.LinkTypeEthernet:
+		first = layers.LayerTypeEthernet
+	case layers.LinkTypeLinuxSLL:
+		first = layers.LayerTypeLinuxSLL
+	case layers.LinkTypeNull, layers.LinkTypeLoop:
+		first = layers.LayerTypeLoopback
+	case layers.LinkTypeRaw, layers.LinkTypeIPv4, layers.LinkTypeIPv6:
+		first = layers.LayerTypeIPv4
+	default:
+		return nil, errUnsupportedLinkType
+	}
+
+	decoders := []gopacket.DecodingLayer{
+		&decoder.ethernet, &decoder.dot1q, &decoder.linuxSLL, &decoder.loopback, &decoder.arp,
+		&decoder.ipv4, &decoder.ipv6, &decoder.extensions, &decoder.icmpv4, &decoder.icmpv6, &decoder.tcp, &decoder.udp,
+	}
+
+	decoder.parser = gopacket.NewDecodingLayerParser(first, decoders...)
+	decoder.parser.IgnoreUnsupported = true
+	decoder.parserIPv6 = gopacket.NewDecodingLayerParser(layers.LayerTypeIPv6, decoders...)
+	decoder.parserIPv6.IgnoreUnsupported = true
+
+	decoder.packet.layers = make([]gopacket.Layer, 0, 8)
+
+	return decoder, nil
+}
+
+// Decode decodes a packet's data into the decoder's layers. The returned packet is only valid until the next call.
+// Packets the DecodingLayerParser fails to decode, such as malformed ones, are decoded by gopacket instead.
+func (decoder *FastDecoder) Decode(data []byte, ci gopacket.CaptureInfo) gopacket.Packet {
+	parser := decoder.parser
+	if decoder.linkType == layers.LinkTypeRaw || decoder.linkType == layers.LinkTypeIPv6 {
+		if len(data) > 0 && data[0]>>4 == 6 {
+			parser = decoder.parserIPv6
+		}
+	}
+
+	if parser.DecodeLayers(data, &decoder.decoded) != nil {
+		packet := gopacket.NewPacket(data, decoder.linkType, gopacket.Default)
+		*packet.Metadata() = gopacket.PacketMetadata{CaptureInfo: ci}
+		return packet
+	}
+
+	packet := &decoder.packet
+	*packet = fastPacket{data: data, metadata: gopacket.PacketMetadata{CaptureInfo: ci, Truncated: parser.Truncated}, layers: packet.layers[:0]}
+
+	// The first link, network and transport layers are the packet's, as with gopacket
+	for _, layerType := range decoder.decoded {
+		var layer gopacket.Layer
+		switch layerType {
+		case layers.LayerTypeEthernet:
+			layer = &decoder.ethernet
+		case layers.LayerTypeDot1Q:
+			layer = &decoder.dot1q
+		case layers.LayerTypeLinuxSLL:
+			layer = &decoder.linuxSLL
+		case layers.LayerTypeLoopback:
+			layer = &decoder.loopback
+		case layers.LayerTypeARP:
+			layer = &decoder.arp
+		case layers.LayerTypeIPv4:
+			layer = &decoder.ipv4
+		case layers.LayerTypeIPv6:
+			layer = &decoder.ipv6
+		case layers.LayerTypeICMPv4:
+			layer = &decoder.icmpv4
+		case layers.LayerTypeICMPv6:
+			layer = &decoder.icmpv6
+		case layers.LayerTypeTCP:
+			layer = &decoder.tcp
+		case layers.LayerTypeUDP:
+			layer = &decoder.udp
+		default:
+			// IPv6 extension headers are skipped, as they are not layers of their own
+			continue
+		}
+		packet.layers = append(packet.layers, layer)
+
+		if linkLayer, ok := layer.(gopacket.LinkLayer); ok && packet.link == nil {
+			packet.link = linkLayer
+		}
+		if networkLayer, ok := layer.(gopacket.NetworkLayer); ok && packet.network == nil {
+			packet.network = networkLayer
+		}
+		if transportLayer, ok := layer.(gopacket.TransportLayer); ok && packet.transport == nil {
+			packet.transport = transportLayer
+		}
+	}
+
+	// The payload of the last layer is the application layer, as with the payloads gopacket does not decode further
+	if len(packet.layers) > 0 && len(packet.layers[len(packet.layers)-1].LayerPayload()) > 0 {
+		packet.payload = packet.layers[len(packet.layers)-1].LayerPayload()
+		packet.application = &packet.payload
+		packet.layers = append(packet.layers, &packet.payload)
+	}
+
+	return packet
+}
+
+func (packet *fastPacket) String() string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "PACKET: %d bytes\n", len(packet.data))
+	for i, layer := range packet.layers {
+		fmt.Fprintf(&builder, "- Layer %d (%02d bytes) = %s\n", i+1, len(layer.LayerContents()), gopacket.LayerString(layer))
+	}
+	return builder.String()
+}
+
+func (packet *fastPacket) Dump() string {
+	var builder strings.Builder
+	for i, layer := range packet.layers {
+		fmt.Fprintf(&builder, "-- Layer %d --\n%s", i+1, gopacket.LayerDump(layer))
+	}
+	return builder.String()
+}
+
+func (packet *fastPacket) Layers() []gopacket.Layer {
+	return packet.layers
+}
+
+func (packet *fastPacket) Layer(layerType gopacket.LayerType) gopacket.Layer {
+	for _, layer := range packet.layers {
+		if layer.LayerType() == layerType {
+			return layer
+		}
+	}
+	return nil
+}
+
+func (packet *fastPacket) LayerClass(layerClass gopacket.LayerClass) gopacket.Layer {
+	for _, layer := range packet.layers {
+		if layerClass.Contains(layer.LayerType()) {
+			return layer
+		}
+	}
+	return nil
+}
+
+func (packet *fastPacket) LinkLayer() gopacket.LinkLayer               { return packet.link }
+func (packet *fastPacket) NetworkLayer() gopacket.NetworkLayer         { return packet.network }
+func (packet *fastPacket) TransportLayer() gopacket.TransportLayer     { return packet.transport }
+func (packet *fastPacket) ApplicationLayer() gopacket.ApplicationLayer { return packet.application }
+func (packet *fastPacket) ErrorLayer() gopacket.ErrorLayer             { return nil }
+func (packet *fastPacket) Data() []byte                                { return packet.data }
+func (packet *fastPacket) Metadata() *gopacket.PacketMetadata          { return &packet.metadata }
+
+// ReadPackets reads the packets of a PacketReader until the source is closed or exhausted, passing each to 'process'.
+// Packets must not be retained by 'process', as a FastPacketSource reuses them.
+func ReadPackets(reader PacketReader, process func(packet gopacket.Packet)) {
+	for {
+		packet, err := reader.NextPacket()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return
+		} else if err != nil {
+			// Retry shortly on read errors, such as timeouts
+			time.Sleep(5 * time.Millisecond)
+			continue
+		}
+
+		process(packet)
+	}
+}
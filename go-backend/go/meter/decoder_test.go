@@ -0,0 +1,179 @@
+package meter
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// BenchmarkDecodeGopacket decodes the benchmark packets into new gopacket.Packets, as the gopacket decoder does.
+func BenchmarkDecodeGopacket(b *testing.B) {
+	packets, _ := setupBenchmark(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		packet := packets[i%len(packets)]
+		decoded := gopacket.NewPacket(packet.Data(), layers.LinkTypeEthernet, gopacket.Default)
+		PacketSize(decoded, AccountingPayload)
+	}
+	reportPacketRate(b)
+}
+
+// BenchmarkDecodeFast decodes the benchmark packets into the preallocated layers of a FastDecoder.
+func BenchmarkDecodeFast(b *testing.B) {
+	packets, _ := setupBenchmark(b)
+	decoder, err := NewFastDecoder(layers.LinkTypeEthernet)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		packet := packets[i%len(packets)]
+		decoded := decoder.Decode(packet.Data(), packet.Metadata().CaptureInfo)
+		PacketSize(decoded, AccountingPayload)
+	}
+	reportPacketRate(b)
+}
+
+// decoderTestFrame is a frame decoded by both decoders in TestDecodersAgree.
+type decoderTestFrame struct {
+	name     string
+	linkType layers.LinkType
+	layers   []gopacket.SerializableLayer
+}
+
+// decoderTestFrames returns a frame of every link type and protocol decoded by the FastDecoder.
+func decoderTestFrames() []decoderTestFrame {
+	var (
+		srcMAC = net.HardwareAddr{2, 0, 0, 0, 0, 1}
+		dstMAC = net.HardwareAddr{2, 0, 0, 0, 0, 2}
+		src4   = net.IP{192, 168, 1, 10}
+		dst4   = net.IP{93, 184, 216, 34}
+		src6   = net.ParseIP("2001:db8::10")
+		dst6   = net.ParseIP("2001:db8::20")
+		data   = gopacket.Payload(make([]byte, 100))
+	)
+
+	ipv4 := func(protocol layers.IPProtocol) *layers.IPv4 {
+		return &layers.IPv4{Version: 4, TTL: 64, Id: 1234, Protocol: protocol, SrcIP: src4, DstIP: dst4}
+	}
+	ipv6 := func(nextHeader layers.IPProtocol) *layers.IPv6 {
+		return &layers.IPv6{Version: 6, HopLimit: 64, NextHeader: nextHeader, SrcIP: src6, DstIP: dst6}
+	}
+	ethernet := func(ethernetType layers.EthernetType) *layers.Ethernet {
+		return &layers.Ethernet{SrcMAC: srcMAC, DstMAC: dstMAC, EthernetType: ethernetType}
+	}
+	tcp := func(network gopacket.NetworkLayer) *layers.TCP {
+		tcp := &layers.TCP{SrcPort: 40000, DstPort: 443, ACK: true, Window: 65535}
+		tcp.SetNetworkLayerForChecksum(network)
+		return tcp
+	}
+	udp := func(network gopacket.NetworkLayer, srcPort, dstPort layers.UDPPort) *layers.UDP {
+		udp := &layers.UDP{SrcPort: srcPort, DstPort: dstPort}
+		udp.SetNetworkLayerForChecksum(network)
+		return udp
+	}
+
+	tcp4, udp4, dns4, icmp4 := ipv4(layers.IPProtocolTCP), ipv4(layers.IPProtocolUDP), ipv4(layers.IPProtocolUDP), ipv4(layers.IPProtocolICMPv4)
+	tcp6, extension6, icmp6, raw6 := ipv6(layers.IPProtocolTCP), ipv6(layers.IPProtocolIPv6Destination), ipv6(layers.IPProtocolICMPv6), ipv6(layers.IPProtocolUDP)
+	rawTcp4, rawUdp4 := ipv4(layers.IPProtocolTCP), ipv4(layers.IPProtocolUDP)
+	icmpv6 := &layers.ICMPv6{TypeCode: layers.CreateICMPv6TypeCode(layers.ICMPv6TypeEchoRequest, 0)}
+	icmpv6.SetNetworkLayerForChecksum(icmp6)
+	destination := &layers.IPv6Destination{Options: []*layers.IPv6DestinationOption{{OptionType: 1, OptionData: make([]byte, 4)}}}
+	destination.NextHeader = layers.IPProtocolTCP
+
+	return []decoderTestFrame{
+		{"ethernet/ipv4/tcp", layers.LinkTypeEthernet, []gopacket.SerializableLayer{ethernet(layers.EthernetTypeIPv4), tcp4, tcp(tcp4), data}},
+		{"ethernet/ipv4/udp/dns", layers.LinkTypeEthernet, []gopacket.SerializableLayer{ethernet(layers.EthernetTypeIPv4), dns4, udp(dns4, 40000, 53), data}},
+		{"ethernet/vlan/ipv4/udp", layers.LinkTypeEthernet, []gopacket.SerializableLayer{ethernet(layers.EthernetTypeDot1Q), &layers.Dot1Q{VLANIdentifier: 10, Type: layers.EthernetTypeIPv4}, udp4, udp(udp4, 40000, 4000), data}},
+		{"ethernet/ipv6/tcp", layers.LinkTypeEthernet, []gopacket.SerializableLayer{ethernet(layers.EthernetTypeIPv6), tcp6, tcp(tcp6), data}},
+		{"ethernet/ipv6/destination/tcp", layers.LinkTypeEthernet, []gopacket.SerializableLayer{ethernet(layers.EthernetTypeIPv6), extension6, destination, tcp(extension6), data}},
+		{"ethernet/ipv4/icmp", layers.LinkTypeEthernet, []gopacket.SerializableLayer{ethernet(layers.EthernetTypeIPv4), icmp4, &layers.ICMPv4{TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeEchoRequest, 0), Id: 1, Seq: 1}, data}},
+		{"ethernet/ipv6/icmpv6", layers.LinkTypeEthernet, []gopacket.SerializableLayer{ethernet(layers.EthernetTypeIPv6), icmp6, icmpv6, data}},
+		{"ethernet/arp", layers.LinkTypeEthernet, []gopacket.SerializableLayer{ethernet(layers.EthernetTypeARP), &layers.ARP{
+			AddrType: layers.LinkTypeEthernet, Protocol: layers.EthernetTypeIPv4, HwAddressSize: 6, ProtAddressSize: 4, Operation: layers.ARPRequest,
+			SourceHwAddress: srcMAC, SourceProtAddress: src4, DstHwAddress: make([]byte, 6), DstProtAddress: dst4,
+		}}},
+		{"raw/ipv4/tcp", layers.LinkTypeRaw, []gopacket.SerializableLayer{rawTcp4, tcp(rawTcp4), data}},
+		{"raw/ipv4/udp", layers.LinkTypeRaw, []gopacket.SerializableLayer{rawUdp4, udp(rawUdp4, 40000, 4000), data}},
+		{"raw/ipv6/udp", layers.LinkTypeRaw, []gopacket.SerializableLayer{raw6, udp(raw6, 40000, 4000), data}},
+	}
+}
+
+// TestDecodersAgree decodes frames of every supported link type and protocol with both decoders, which must count and attribute them the same.
+func TestDecodersAgree(t *testing.T) {
+	for _, frame := range decoderTestFrames() {
+		t.Run(frame.name, func(t *testing.T) {
+			buffer := gopacket.NewSerializeBuffer()
+			if err := gopacket.SerializeLayers(buffer, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}, frame.layers...); err != nil {
+				t.Fatal(err)
+			}
+			data := buffer.Bytes()
+			ci := gopacket.CaptureInfo{CaptureLength: len(data), Length: len(data)}
+
+			expected := gopacket.NewPacket(data, frame.linkType, gopacket.Default)
+			*expected.Metadata() = gopacket.PacketMetadata{CaptureInfo: ci}
+			if errorLayer := expected.ErrorLayer(); errorLayer != nil {
+				t.Fatal("gopacket failed to decode the frame: ", errorLayer.Error())
+			}
+
+			decoder, err := NewFastDecoder(frame.linkType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual := decoder.Decode(data, ci)
+			if _, ok := actual.(*fastPacket); !ok {
+				t.Fatal("the fast decoder fell back to gopacket")
+			}
+
+			for _, mode := range []string{AccountingPayload, AccountingIP, AccountingWire} {
+				if expectedSize, actualSize := PacketSize(expected, mode), PacketSize(actual, mode); expectedSize != actualSize {
+					t.Errorf("%s size: expected %d, got %d", mode, expectedSize, actualSize)
+				}
+			}
+
+			if (expected.LinkLayer() == nil) != (actual.LinkLayer() == nil) {
+				t.Fatalf("link layer: expected %v, got %v", expected.LinkLayer(), actual.LinkLayer())
+			} else if expected.LinkLayer() != nil {
+				if expected.LinkLayer().LayerType() != actual.LinkLayer().LayerType() || expected.LinkLayer().LinkFlow() != actual.LinkLayer().LinkFlow() {
+					t.Errorf("link layer: expected %v, got %v", expected.LinkLayer().LinkFlow(), actual.LinkLayer().LinkFlow())
+				}
+			}
+
+			if (expected.NetworkLayer() == nil) != (actual.NetworkLayer() == nil) {
+				t.Fatalf("network layer: expected %v, got %v", expected.NetworkLayer(), actual.NetworkLayer())
+			} else if expected.NetworkLayer() != nil {
+				expectedSrc, expectedDst, expectedErr := GetIPs(expected.NetworkLayer())
+				actualSrc, actualDst, actualErr := GetIPs(actual.NetworkLayer())
+				if expectedSrc != actualSrc || expectedDst != actualDst || (expectedErr == nil) != (actualErr == nil) {
+					t.Errorf("addresses: expected %v > %v, got %v > %v", expectedSrc, expectedDst, actualSrc, actualDst)
+				}
+			}
+
+			if (expected.TransportLayer() == nil) != (actual.TransportLayer() == nil) {
+				t.Fatalf("transport layer: expected %v, got %v", expected.TransportLayer(), actual.TransportLayer())
+			} else if expected.TransportLayer() != nil {
+				expectedSrc, expectedDst, expectedErr := GetPorts(expected.TransportLayer())
+				actualSrc, actualDst, actualErr := GetPorts(actual.TransportLayer())
+				if expectedSrc != actualSrc || expectedDst != actualDst || (expectedErr == nil) != (actualErr == nil) {
+					t.Errorf("ports: expected %d > %d, got %d > %d", expectedSrc, expectedDst, actualSrc, actualDst)
+				}
+			}
+
+			if expected.TransportLayer() == nil && expected.NetworkLayer() != nil {
+				expectedProcess, expectedProtocol := GetNetworkProtocolName(expected)
+				actualProcess, actualProtocol := GetNetworkProtocolName(actual)
+				if expectedProcess != actualProcess || expectedProtocol != actualProtocol {
+					t.Errorf("protocol: expected %s/%s, got %s/%s", expectedProcess, expectedProtocol, actualProcess, actualProtocol)
+				}
+			} else if expected.NetworkLayer() == nil && GetLinkProtocolName(expected) != GetLinkProtocolName(actual) {
+				t.Errorf("protocol: expected %s, got %s", GetLinkProtocolName(expected), GetLinkProtocolName(actual))
+			}
+		})
+	}
+}
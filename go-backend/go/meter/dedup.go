@@ -0,0 +1,142 @@
+package meter
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	dedupWindow  = 200 * time.Millisecond // dedupWindow is the time a packet's fingerprint is kept, to recognize the same packet captured on another interface
+	dedupBuckets = 64                     // dedupBuckets is the number of buckets the fingerprints are spread over, each with its own lock
+)
+
+// dedupEntry stores the interface a packet was first captured on, and when.
+type dedupEntry struct {
+	iface string
+	seen  time.Time
+}
+
+// dedupBucket stores the fingerprints of the packets whose fingerprint falls in the bucket, so parallel captures rarely wait for each other.
+type dedupBucket struct {
+	mutex     sync.Mutex
+	seen      map[uint64]dedupEntry // seen maps a packet's fingerprint to the interface it was first captured on
+	lastPurge time.Time             // lastPurge is the time the fingerprints older than dedupWindow were last removed
+}
+
+// PacketDeduplicator recognizes IP packets captured unchanged on more than one interface, such as a TAP interface and the bridge it belongs to.
+// Packets are identified by their addresses, IPv4 identification and transport contents, which are kept when a packet is bridged or routed.
+// Copies whose addresses or contents change, such as the outer packets of a tunnel or translated packets, are not recognized;
+// the outer packets of the captured tunnels are recognized by TunnelUnderlay instead.
+// Packets are only fingerprinted while a loopback or tunnel interface is captured.
+type PacketDeduplicator struct {
+	mutex   sync.Mutex                // mutex controls read/write operations in virtual
+	buckets [dedupBuckets]dedupBucket // buckets stores the fingerprints by their value modulo dedupBuckets
+	virtual map[string]bool           // virtual stores the names of the captured loopback and tunnel interfaces
+	active  atomic.Bool               // active is set while virtual is not empty
+}
+
+// NewPacketDeduplicator creates an empty PacketDeduplicator, inactive until a loopback or tunnel interface is registered.
+func NewPacketDeduplicator() *PacketDeduplicator {
+	deduplicator := &PacketDeduplicator{virtual: make(map[string]bool)}
+	for i := range deduplicator.buckets {
+		deduplicator.buckets[i] = dedupBucket{seen: make(map[uint64]dedupEntry), lastPurge: time.Now()}
+	}
+	return deduplicator
+}
+
+// Register activates the deduplicator if the captured interface is a loopback or tunnel interface.
+func (deduplicator *PacketDeduplicator) Register(iface NetworkInterface) {
+	if !iface.Loopback && !iface.Tunnel {
+		return
+	}
+
+	deduplicator.mutex.Lock()
+	defer deduplicator.mutex.Unlock()
+
+	deduplicator.virtual[iface.Name] = true
+	deduplicator.active.Store(true)
+}
+
+// Unregister deactivates the deduplicator once no loopback or tunnel interface is captured, forgetting the fingerprints.
+func (deduplicator *PacketDeduplicator) Unregister(iface string) {
+	deduplicator.mutex.Lock()
+	defer deduplicator.mutex.Unlock()
+
+	delete(deduplicator.virtual, iface)
+	if len(deduplicator.virtual) == 0 {
+		deduplicator.active.Store(false)
+		for i := range deduplicator.buckets {
+			bucket := &deduplicator.buckets[i]
+			bucket.mutex.Lock()
+			bucket.seen = make(map[uint64]dedupEntry)
+			bucket.mutex.Unlock()
+		}
+	}
+}
+
+// Duplicate reports whether the packet was already captured on another interface within dedupWindow.
+// Packets repeated on the same interface are genuine retransmissions, and are never reported.
+func (deduplicator *PacketDeduplicator) Duplicate(iface string, packet gopacket.Packet) bool {
+	if !deduplicator.active.Load() {
+		return false
+	}
+
+	fingerprint, ok := PacketFingerprint(packet)
+	if !ok {
+		return false
+	}
+
+	bucket := &deduplicator.buckets[fingerprint%dedupBuckets]
+	bucket.mutex.Lock()
+	defer bucket.mutex.Unlock()
+
+	now := time.Now()
+	if now.Sub(bucket.lastPurge) > dedupWindow {
+		for key, entry := range bucket.seen {
+			if now.Sub(entry.seen) > dedupWindow {
+				delete(bucket.seen, key)
+			}
+		}
+		bucket.lastPurge = now
+	}
+
+	if entry, ok := bucket.seen[fingerprint]; ok && now.Sub(entry.seen) <= dedupWindow {
+		return entry.iface != iface
+	}
+
+	bucket.seen[fingerprint] = dedupEntry{iface: iface, seen: now}
+	return false
+}
+
+// PacketFingerprint hashes the fields of an IP packet that are not changed by forwarding, ignoring the TTL and checksum.
+func PacketFingerprint(packet gopacket.Packet) (uint64, bool) {
+	var (
+		hash = fnv.New64a()
+		id   [2]byte
+	)
+
+	switch networkLayer := packet.NetworkLayer().(type) {
+	case *layers.IPv4:
+		binary.BigEndian.PutUint16(id[:], networkLayer.Id)
+		hash.Write(networkLayer.SrcIP.To4())
+		hash.Write(networkLayer.DstIP.To4())
+		hash.Write(id[:])
+		hash.Write([]byte{byte(networkLayer.Protocol)})
+		hash.Write(networkLayer.Payload)
+	case *layers.IPv6:
+		hash.Write(networkLayer.SrcIP.To16())
+		hash.Write(networkLayer.DstIP.To16())
+		hash.Write([]byte{byte(networkLayer.NextHeader)})
+		hash.Write(networkLayer.Payload)
+	default:
+		return 0, false
+	}
+
+	return hash.Sum64(), true
+}
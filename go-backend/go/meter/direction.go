@@ -0,0 +1,115 @@
+package meter
+
+import (
+	"fmt"
+	"net/netip"
+	"sync/atomic"
+
+	"github.com/google/gopacket"
+)
+
+// Direction strategies, selecting how ProcessPacket decides whether a packet is an upload or a download.
+const (
+	DirectionAuto = "auto" // DirectionAuto uses the local IP addresses, falling back to the MAC addresses when neither address is local
+	DirectionIP   = "ip"   // DirectionIP only uses the local IP addresses
+	DirectionMAC  = "mac"  // DirectionMAC only uses the local MAC addresses, requiring an Ethernet-like link layer
+)
+
+// localState stores the addresses loaded by a Refresh. It is replaced as a whole, so packets are matched without locking.
+type localState struct {
+	macs map[string]bool     // macs stores the hardware addresses of every interface
+	ips  map[netip.Addr]bool // ips stores the IP addresses of every interface
+}
+
+// LocalAddresses stores the MAC and IP addresses of this machine, used to find the direction of a packet.
+type LocalAddresses struct {
+	Strategy string                     // Strategy is the direction strategy: DirectionAuto, DirectionIP or DirectionMAC
+	state    atomic.Pointer[localState] // state stores the addresses of the last Refresh
+}
+
+// NewLocalAddresses creates an empty LocalAddresses using the given strategy. Refresh must be called to load the addresses.
+func NewLocalAddresses(strategy string) *LocalAddresses {
+	local := &LocalAddresses{Strategy: strategy}
+	local.state.Store(&localState{macs: make(map[string]bool), ips: make(map[netip.Addr]bool)})
+	return local
+}
+
+// ValidateDirection checks if a direction strategy is supported.
+func ValidateDirection(strategy string) error {
+	switch strategy {
+	case DirectionAuto, DirectionIP, DirectionMAC:
+		return nil
+	default:
+		return fmt.Errorf("unknown direction strategy %q", strategy)
+	}
+}
+
+// Refresh reloads the MAC and IP addresses of every interface, so addresses assigned since the last call are recognized.
+func (local *LocalAddresses) Refresh() error {
+	var (
+		macs = make(map[string]bool)
+		ips  = make(map[netip.Addr]bool)
+	)
+
+	if addresses, err := GetMacAddresses(); err != nil {
+		return err
+	} else {
+		for _, mac := range addresses {
+			macs[mac] = true
+		}
+	}
+
+	if addresses, err := GetLocalIPs(); err != nil {
+		return err
+	} else {
+		for _, ip := range addresses {
+			ips[ip] = true
+		}
+	}
+
+	local.state.Store(&localState{macs: macs, ips: ips})
+
+	return nil
+}
+
+// IsUpload reports whether a packet was sent by this machine, according to the strategy.
+// Returns false as its second value if the strategy cannot decide: between two local addresses, such as on loopback, whose direction
+// is the one of their socket, between two remote addresses with DirectionIP, or with DirectionMAC on a packet without link layer.
+func (local *LocalAddresses) IsUpload(linkLayer gopacket.LinkLayer, srcIP, dstIP netip.Addr) (isUpload bool, ok bool) {
+	state := local.state.Load()
+
+	// The IP addresses decide, unless both or neither belong to this machine
+	if local.Strategy != DirectionMAC {
+		srcLocal, dstLocal := state.ips[srcIP], state.ips[dstIP]
+		if srcLocal != dstLocal {
+			return srcLocal, true
+		}
+
+		// The MAC addresses cannot tell traffic between two local addresses apart, as loopback has no hardware address
+		if srcLocal || local.Strategy == DirectionIP {
+			return false, false
+		}
+	}
+
+	if linkLayer == nil {
+		return false, false
+	}
+
+	// A packet is an upload if its source MAC address belongs to this machine
+	return state.macs[linkLayer.LinkFlow().Src().String()], true
+}
+
+// IsLocal reports whether an IP address belongs to this machine.
+func (local *LocalAddresses) IsLocal(ip netip.Addr) bool {
+	return local.state.Load().ips[ip]
+}
+
+// IsLinkUpload reports whether a packet without IP layer, such as ARP, was sent by this machine.
+// The MAC addresses are used regardless of the strategy, as there are no IP addresses to match.
+func (local *LocalAddresses) IsLinkUpload(linkLayer gopacket.LinkLayer) (isUpload bool, ok bool) {
+	if linkLayer == nil {
+		return false, false
+	}
+
+	return local.state.Load().macs[linkLayer.LinkFlow().Src().String()], true
+}
@@ -0,0 +1,196 @@
+package meter
+
+import (
+	"log"
+	"runtime"
+	"sync"
+
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+)
+
+// CaptureFilters stores the BPF filters applied to the capture handles: a global filter, and per-interface overrides.
+// Changes are applied to the open handles, so packets are filtered in the kernel before reaching ProcessPacket.
+type CaptureFilters struct {
+	mutex      sync.RWMutex
+	Global     string                     // Global is applied to every interface without an override
+	Interfaces map[string]string          // Interfaces maps an interface name to the filter overriding the global one
+	handles    map[string]FilterHandle    // handles stores the open capture handles by interface name
+	linkTypes  map[string]layers.LinkType // linkTypes stores the link type of every interface opened since startup, to validate its filters while it is closed
+}
+
+// FilterHandle is an open capture handle whose BPF filter can be changed while capturing, such as a pcap.Handle or an AFPacketCapture.
+type FilterHandle interface {
+	CompileBPFFilter(expr string) ([]pcap.BPFInstruction, error)
+	SetBPFFilter(expr string) error
+	LinkType() layers.LinkType // LinkType returns the link type of the handle's packets, which its filters are compiled for
+}
+
+// NewCaptureFilters creates a CaptureFilters with the given global filter and per-interface overrides.
+func NewCaptureFilters(global string, interfaces map[string]string) *CaptureFilters {
+	filters := &CaptureFilters{Global: global, Interfaces: make(map[string]string), handles: make(map[string]FilterHandle), linkTypes: make(map[string]layers.LinkType)}
+
+	for iface, filter := range interfaces {
+		filters.Interfaces[iface] = filter
+	}
+
+	return filters
+}
+
+// ValidateFilter checks if a BPF expression compiles for captures of the given link type.
+func ValidateFilter(linkType layers.LinkType, filter string) (err error) {
+	if filter == "" {
+		return nil
+	}
+
+	_, err = pcap.CompileBPFFilter(bpfLinkType(linkType), 1600, filter)
+	return err
+}
+
+// bpfLinkType returns the link type libpcap compiles filters for, given the link type of a capture.
+// LinkTypeRaw is the value used in capture files, which libpcap only compiles for as DLT_RAW.
+func bpfLinkType(linkType layers.LinkType) layers.LinkType {
+	if linkType != layers.LinkTypeRaw {
+		return linkType
+	} else if runtime.GOOS == "openbsd" {
+		return dltRawOpenBSD
+	}
+	return dltRaw
+}
+
+// FilterFor returns the filter of an interface: its override if one exists, or the global filter otherwise.
+func (filters *CaptureFilters) FilterFor(iface string) string {
+	filters.mutex.RLock()
+	defer filters.mutex.RUnlock()
+
+	return filters.filterFor(iface)
+}
+
+// filterFor returns the filter of an interface. The caller must hold the mutex.
+func (filters *CaptureFilters) filterFor(iface string) string {
+	if filter, ok := filters.Interfaces[iface]; ok {
+		return filter
+	}
+	return filters.Global
+}
+
+// Filters returns a copy of the global filter and the per-interface overrides.
+func (filters *CaptureFilters) Filters() (global string, interfaces map[string]string) {
+	filters.mutex.RLock()
+	defer filters.mutex.RUnlock()
+
+	interfaces = make(map[string]string)
+	for iface, filter := range filters.Interfaces {
+		interfaces[iface] = filter
+	}
+
+	return filters.Global, interfaces
+}
+
+// Register stores an open handle, so later filter changes are applied to it.
+// The handle's link type is kept once it is closed, to validate the interface's filters until it is opened again.
+func (filters *CaptureFilters) Register(iface string, handle FilterHandle) {
+	filters.mutex.Lock()
+	defer filters.mutex.Unlock()
+
+	filters.handles[iface] = handle
+	filters.linkTypes[iface] = handle.LinkType()
+}
+
+// Unregister removes the handle of a closed interface.
+func (filters *CaptureFilters) Unregister(iface string) {
+	filters.mutex.Lock()
+	defer filters.mutex.Unlock()
+
+	delete(filters.handles, iface)
+}
+
+// SetGlobal replaces the global filter, applying it to every open handle without an override.
+func (filters *CaptureFilters) SetGlobal(filter string) error {
+	filters.mutex.Lock()
+	defer filters.mutex.Unlock()
+
+	// Find the interfaces affected by the global filter
+	affected := make([]string, 0)
+	for iface := range filters.linkTypes {
+		if _, ok := filters.Interfaces[iface]; !ok {
+			affected = append(affected, iface)
+		}
+	}
+
+	if err := filters.applyFilter(affected, filter); err != nil {
+		return err
+	}
+
+	filters.Global = filter
+	return nil
+}
+
+// SetInterface overrides the global filter for an interface, applying it to the interface's handle if it is open.
+func (filters *CaptureFilters) SetInterface(iface string, filter string) error {
+	filters.mutex.Lock()
+	defer filters.mutex.Unlock()
+
+	if err := filters.applyFilter([]string{iface}, filter); err != nil {
+		return err
+	}
+
+	filters.Interfaces[iface] = filter
+	return nil
+}
+
+// RemoveInterface removes an interface's override, applying the global filter to its handle if it is open.
+func (filters *CaptureFilters) RemoveInterface(iface string) error {
+	filters.mutex.Lock()
+	defer filters.mutex.Unlock()
+
+	if err := filters.applyFilter([]string{iface}, filters.Global); err != nil {
+		return err
+	}
+
+	delete(filters.Interfaces, iface)
+	return nil
+}
+
+// applyFilter validates a filter for the link type of each interface, then sets it on their open handles. The caller must hold the mutex.
+// Interfaces never opened are validated for Ethernet. Should a handle fail to set the filter, the handles already set are restored to their
+// current filter, so a failure leaves all handles unchanged.
+func (filters *CaptureFilters) applyFilter(ifaces []string, filter string) error {
+	linkTypes := make(map[layers.LinkType]bool)
+	for _, iface := range ifaces {
+		if linkType, ok := filters.linkTypes[iface]; ok {
+			linkTypes[linkType] = true
+		} else {
+			linkTypes[layers.LinkTypeEthernet] = true
+		}
+	}
+	if len(linkTypes) == 0 {
+		linkTypes[layers.LinkTypeEthernet] = true
+	}
+
+	for linkType := range linkTypes {
+		if err := ValidateFilter(linkType, filter); err != nil {
+			return err
+		}
+	}
+
+	applied := make([]string, 0, len(ifaces))
+	for _, iface := range ifaces {
+		handle, ok := filters.handles[iface]
+		if !ok {
+			continue
+		}
+
+		if err := handle.SetBPFFilter(filter); err != nil {
+			for _, previous := range applied {
+				if err := filters.handles[previous].SetBPFFilter(filters.filterFor(previous)); err != nil {
+					log.Println("Unable to restore the filter of interface ", previous, ": ", err)
+				}
+			}
+			return err
+		}
+		applied = append(applied, iface)
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+package meter
+
+import (
+	"sync"
+	"time"
+
+	ps_host "github.com/shirou/gopsutil/v3/host"
+	ps_process "github.com/shirou/gopsutil/v3/process"
+)
+
+// ProcessMetadata stores the details of a process instance, captured when it is first resolved as the owner of a socket.
+// Fields that cannot be read, such as the executable of a process owned by another user, are left empty.
+type ProcessMetadata struct {
+	Pid           int32
+	Creation_Time int64  // Creation_Time is the time the process was created, in Unix milliseconds
+	Name          string // Name is the name of the process, as used by ActiveProcess
+	Exe           string // Exe is the path of the process' executable
+	Cmdline       string // Cmdline is the command line of the process, with its arguments separated by spaces
+	Username      string // Username is the name of the user owning the process
+	Ppid          int32  // Ppid is the PID of the parent process
+	Application   string // Application is the name of the process' top-level application ancestor, as returned by ApplicationAncestor; empty in the process aggregation mode
+}
+
+// maxProcessMetadata limits the number of process instances remembered by RecordProcessMetadata.
+// Once reached, the cache is cleared; instances resolved again are stored again, which the database ignores.
+const maxProcessMetadata = 4096
+
+// ProcessTable records the metadata of the process instances owning sockets, and names their traffic according to the aggregation mode.
+type ProcessTable struct {
+	mutex           sync.Mutex                  // mutex controls read/write operations in processMetadata, processesByPid and unsavedMetadata
+	aggregation     string                      // aggregation is the aggregation mode used by GetProcessData
+	processMetadata map[string]*ProcessMetadata // processMetadata stores the known process instances by ProcessInstanceKey
+	processesByPid  map[int32]*ProcessMetadata  // processesByPid stores the last known instance of each PID, including the ancestors read by ApplicationAncestor
+	unsavedMetadata []*ProcessMetadata          // unsavedMetadata stores the process instances not yet saved to the storage
+	usernamesMutex  sync.Mutex                  // usernamesMutex controls read/write operations in usernames
+	usernames       map[int32]string            // usernames caches the names of the UIDs looked up by Username
+}
+
+// NewProcessTable creates an empty ProcessTable naming traffic according to the given aggregation mode.
+func NewProcessTable(aggregation string) *ProcessTable {
+	return &ProcessTable{aggregation: aggregation, processMetadata: make(map[string]*ProcessMetadata), processesByPid: make(map[int32]*ProcessMetadata), unsavedMetadata: make([]*ProcessMetadata, 0), usernames: make(map[int32]string)}
+}
+
+// GetProcessData retrieves a process' name and creation time given its PID, recording its metadata on the first call.
+// The name is the one of the process' application ancestor in the AggregateApplication mode.
+func (table *ProcessTable) GetProcessData(pid int32) (createTime int64, procName string, err error) {
+	// Check if process exists for the given pid
+	if process, err := ps_process.NewProcess(pid); err != nil {
+		return 0, "", err
+	} else {
+		// Get process creation time; otherwise, treat it as a system process and use boot time instead.
+		if createTime, err = process.CreateTime(); err != nil {
+			if bootTime, err := ps_host.BootTime(); err != nil {
+				return 0, "", err
+			} else {
+				createTime = int64(bootTime) * 1000
+			}
+		}
+
+		// Check if process name can be retrieved
+		if procName, err = process.Name(); err != nil {
+			return 0, "", err
+		} else {
+			// Attribute the traffic of helper processes to their application, in the application aggregation mode
+			if metadata := table.RecordProcessMetadata(process, createTime, procName); table.aggregation == AggregateApplication && metadata.Application != "" {
+				procName = metadata.Application
+			}
+			return createTime, procName, nil
+		}
+	}
+}
+
+// Owner returns the owner of the sockets of a process and user, including the process' cgroup and executable.
+func (table *ProcessTable) Owner(pid int32, uid int32) (SocketConnectionProcess, error) {
+	creationTime, processName, err := table.GetProcessData(pid)
+	if err != nil {
+		return SocketConnectionProcess{}, err
+	}
+
+	return SocketConnectionProcess{name: processName, pid: pid, creationTime: creationTime, uid: uid, cgroup: ProcessCgroup(pid), exe: table.LookupProcessExe(pid, creationTime), lastSeen: time.Now()}, nil
+}
+
+// RecordProcessMetadata captures the metadata of a process instance, unless it is already known. Returns the instance's metadata.
+// The instance's application ancestor is only looked up in the AggregateApplication mode.
+func (table *ProcessTable) RecordProcessMetadata(process *ps_process.Process, creationTime int64, name string) ProcessMetadata {
+	key := ProcessInstanceKey(process.Pid, creationTime)
+
+	table.mutex.Lock()
+	known, ok := table.processMetadata[key]
+	table.mutex.Unlock()
+	if ok {
+		return *known
+	}
+
+	metadata := &ProcessMetadata{Pid: process.Pid, Creation_Time: creationTime, Name: name}
+
+	// The process may have exited or belong to another user, so errors leave the fields empty
+	metadata.Exe, _ = process.Exe()
+	metadata.Cmdline, _ = process.Cmdline()
+	metadata.Username, _ = process.Username()
+	metadata.Ppid, _ = process.Ppid()
+	if table.aggregation == AggregateApplication {
+		metadata.Application = table.ApplicationAncestor(metadata)
+	}
+
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+
+	if len(table.processMetadata) >= maxProcessMetadata {
+		table.processMetadata = make(map[string]*ProcessMetadata)
+	}
+	table.processMetadata[key] = metadata
+	table.rememberPid(metadata)
+	table.unsavedMetadata = append(table.unsavedMetadata, metadata)
+
+	return *metadata
+}
+
+// rememberPid stores a process instance as the last known instance of its PID. The caller must hold the mutex.
+func (table *ProcessTable) rememberPid(metadata *ProcessMetadata) {
+	if len(table.processesByPid) >= maxProcessMetadata {
+		table.processesByPid = make(map[int32]*ProcessMetadata)
+	}
+	table.processesByPid[metadata.Pid] = metadata
+}
+
+// TakeUnsavedMetadata returns the process instances captured since the last call, to be saved to the storage.
+func (table *ProcessTable) TakeUnsavedMetadata() []*ProcessMetadata {
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+
+	metadata := table.unsavedMetadata
+	table.unsavedMetadata = make([]*ProcessMetadata, 0)
+
+	return metadata
+}
+
+// LookupProcessExe returns the executable of a process instance recorded by RecordProcessMetadata, or an empty string if it is not known.
+func (table *ProcessTable) LookupProcessExe(pid int32, creationTime int64) string {
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+
+	if metadata, ok := table.processMetadata[ProcessInstanceKey(pid, creationTime)]; ok {
+		return metadata.Exe
+	}
+	return ""
+}
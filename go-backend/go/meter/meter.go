@@ -0,0 +1,432 @@
+// Package meter captures the network traffic of this machine and attributes it to the processes owning its sockets.
+// A Meter keeps all of its state, so it can be embedded in other programs: the traffic is published every second to the
+// subscribers of the meter, and handed every flush interval to a Storage, such as a database.
+package meter
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Storage saves the traffic aggregated by a Meter.
+type Storage interface {
+	// SaveActiveProcesses saves the traffic of each second since the last flush, oldest first.
+	SaveActiveProcesses(buffer []map[string]*ActiveProcess) error
+	// SaveProcessMetadata saves the process instances resolved since the last flush.
+	SaveProcessMetadata(metadata []*ProcessMetadata) error
+}
+
+// Snapshot stores the traffic captured by a Meter over one second.
+type Snapshot struct {
+	Time             time.Time                 // Time is the end of the second
+	Active_Processes map[string]*ActiveProcess // Active_Processes is shared by every subscriber, and must not be modified
+}
+
+// Meter captures the packets of the selected interfaces, attributes them to processes and aggregates their traffic.
+type Meter struct {
+	config   Config
+	resolver SocketResolver // resolver finds the sockets missing from the socket table on demand; nil to rely on the socket scans alone
+	storage  Storage        // storage saves the flushed traffic; nil to discard it
+
+	sockets      *SocketTable
+	processes    *ProcessTable
+	pending      *PendingTable
+	local        *LocalAddresses
+	filters      *CaptureFilters
+	rules        *ApplicationRules
+	services     *Services
+	coverage     *CoverageMonitor
+	shards       *AggregationShards
+	deduplicator *PacketDeduplicator
+	underlay     *TunnelUnderlay
+
+	bufferMutex    sync.Mutex                  // bufferMutex controls read/write operations in bufferParser and bufferDatabase
+	bufferParser   map[string]*ActiveProcess   // bufferParser stores the traffic of the current second, published to the subscribers
+	bufferDatabase []map[string]*ActiveProcess // bufferDatabase stores the traffic of each second since the last flush
+	flushMutex     sync.Mutex                  // flushMutex serializes the flushes, so the storage saves one buffer at a time
+
+	subscribersMutex sync.Mutex                        // subscribersMutex controls read/write operations in subscribers
+	subscribers      map[<-chan Snapshot]chan Snapshot // subscribers maps the channels returned by Subscribe to their sending side
+
+	stateMutex sync.Mutex     // stateMutex controls read/write operations in started and stopped
+	started    bool           // started is set by Start
+	stopped    bool           // stopped is set by Stop
+	stop       chan struct{}  // stop is closed by Stop, ending every goroutine of the meter
+	wait       sync.WaitGroup // wait tracks the goroutines of the meter, including the capture goroutines
+}
+
+// New creates a Meter with the given settings, finding sockets on demand through the resolver and saving the traffic to the storage.
+// The resolver of this platform is returned by NewSocketResolver. Either may be nil, to poll sockets only or to discard the traffic once flushed.
+func New(config Config, resolver SocketResolver, storage Storage) (*Meter, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	m := &Meter{
+		config:         config,
+		resolver:       resolver,
+		storage:        storage,
+		sockets:        NewSocketTable(),
+		processes:      NewProcessTable(config.Aggregate),
+		pending:        NewPendingTable(),
+		local:          NewLocalAddresses(config.Direction),
+		filters:        NewCaptureFilters(config.Filter, config.InterfaceFilters),
+		rules:          config.Rules,
+		services:       config.Services,
+		coverage:       NewCoverageMonitor(),
+		deduplicator:   NewPacketDeduplicator(),
+		underlay:       NewTunnelUnderlay(),
+		bufferParser:   make(map[string]*ActiveProcess),
+		bufferDatabase: []map[string]*ActiveProcess{make(map[string]*ActiveProcess)},
+		subscribers:    make(map[<-chan Snapshot]chan Snapshot),
+		stop:           make(chan struct{}),
+	}
+	m.shards = NewAggregationShards(m.coverage)
+
+	if m.rules == nil {
+		m.rules = NewApplicationRules("")
+	}
+	if m.services == nil {
+		m.services = LoadServices()
+	}
+
+	return m, nil
+}
+
+// Start loads the local addresses and starts capturing. Interfaces are opened as they appear, and closed as they disappear.
+// A Meter can only be started once.
+func (m *Meter) Start() error {
+	m.stateMutex.Lock()
+	defer m.stateMutex.Unlock()
+
+	if m.started {
+		return errors.New("meter already started")
+	}
+
+	// Set MAC and IP addresses
+	if err := m.local.Refresh(); err != nil {
+		return err
+	}
+	m.started = true
+
+	// Sockets missing from the socket table are resolved on demand where supported, so they can be polled less often
+	socketInterval := time.Second
+	if m.resolver != nil {
+		socketInterval = 5 * time.Second
+	}
+
+	m.wait.Add(5)
+	go m.manageSockets(socketInterval)
+	go m.manageBuffers()
+	go m.manageStorage()
+	go m.manageCoverage()
+	go m.manageInterfaces()
+
+	return nil
+}
+
+// Stop closes every capture and waits for the meter's goroutines, then flushes the remaining traffic and closes the subscriptions.
+// Returns the error of the last flush, if any.
+func (m *Meter) Stop() error {
+	m.stateMutex.Lock()
+	if !m.started || m.stopped {
+		m.stateMutex.Unlock()
+		return nil
+	}
+	m.stopped = true
+	m.stateMutex.Unlock()
+
+	close(m.stop)
+	m.wait.Wait()
+
+	// Merge the traffic captured since the last tick, so it is flushed
+	m.bufferMutex.Lock()
+	m.shards.Merge(m.bufferParser, m.bufferDatabase[len(m.bufferDatabase)-1])
+	m.bufferMutex.Unlock()
+
+	err := m.Flush()
+
+	m.subscribersMutex.Lock()
+	defer m.subscribersMutex.Unlock()
+
+	for subscription, subscriber := range m.subscribers {
+		close(subscriber)
+		delete(m.subscribers, subscription)
+	}
+
+	return err
+}
+
+// Subscribe returns a channel receiving a Snapshot of the traffic every second, until Unsubscribe or Stop is called.
+// Snapshots are skipped while the subscriber has not received the previous one.
+func (m *Meter) Subscribe() <-chan Snapshot {
+	subscriber := make(chan Snapshot, 1)
+
+	m.subscribersMutex.Lock()
+	defer m.subscribersMutex.Unlock()
+
+	m.subscribers[subscriber] = subscriber
+	return subscriber
+}
+
+// Unsubscribe stops sending snapshots to a channel returned by Subscribe, and closes it.
+func (m *Meter) Unsubscribe(subscription <-chan Snapshot) {
+	m.subscribersMutex.Lock()
+	defer m.subscribersMutex.Unlock()
+
+	if subscriber, ok := m.subscribers[subscription]; ok {
+		close(subscriber)
+		delete(m.subscribers, subscription)
+	}
+}
+
+// Flush hands the traffic of each second since the last flush, and the process instances resolved since, to the storage.
+// The traffic is discarded if the meter has no storage. Returns the first error of the storage.
+func (m *Meter) Flush() error {
+	m.flushMutex.Lock()
+	defer m.flushMutex.Unlock()
+
+	m.bufferMutex.Lock()
+	buffer := m.bufferDatabase
+	m.bufferDatabase = []map[string]*ActiveProcess{make(map[string]*ActiveProcess)}
+	m.bufferMutex.Unlock()
+
+	// Save the metadata of the process instances resolved since the last flush, even if the traffic could not be saved
+	metadata := m.processes.TakeUnsavedMetadata()
+	if m.storage == nil {
+		return nil
+	}
+
+	err := m.storage.SaveActiveProcesses(buffer)
+	if metadataErr := m.storage.SaveProcessMetadata(metadata); err == nil {
+		err = metadataErr
+	}
+
+	return err
+}
+
+// Filters returns the capture filters of the meter, whose changes are applied to the open captures.
+func (m *Meter) Filters() *CaptureFilters {
+	return m.filters
+}
+
+// Accounting returns the accounting mode the meter counts traffic in.
+func (m *Meter) Accounting() string {
+	return m.config.Accounting
+}
+
+// Rules returns the application rules of the meter.
+func (m *Meter) Rules() *ApplicationRules {
+	return m.rules
+}
+
+// Services returns the services table naming the ports of the meter's protocols.
+func (m *Meter) Services() *Services {
+	return m.services
+}
+
+// Coverage returns the coverage of every captured interface over the last complete window.
+func (m *Meter) Coverage() []InterfaceCoverage {
+	return m.coverage.Coverage()
+}
+
+// SocketTableStats returns the current size of the meter's socket tables.
+func (m *Meter) SocketTableStats() SocketTableStats {
+	return m.sockets.Stats()
+}
+
+// PendingStats returns the current size of the meter's pending table.
+func (m *Meter) PendingStats() PendingStats {
+	return m.pending.Stats()
+}
+
+// manageBuffers publishes the traffic of each second to the subscribers, until the meter is stopped.
+// The shards of the capture goroutines are merged into the buffers, and pending flows whose socket has since been found are attributed, before the traffic is published.
+func (m *Meter) manageBuffers() {
+	defer m.wait.Done()
+
+	var ticker = time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			// Look up the pending flows before taking the buffers' mutex, as the resolver may take a while
+			resolved := m.ResolvePendingFlows()
+
+			m.bufferMutex.Lock()
+			m.shards.Merge(m.bufferParser, m.bufferDatabase[len(m.bufferDatabase)-1])
+			m.AttributeResolvedFlows(resolved, m.bufferParser, m.bufferDatabase[len(m.bufferDatabase)-1])
+			activeProcesses := m.bufferParser
+			m.bufferParser = make(map[string]*ActiveProcess)
+			m.bufferDatabase = append(m.bufferDatabase, make(map[string]*ActiveProcess))
+			m.bufferMutex.Unlock()
+
+			m.publish(Snapshot{Time: now, Active_Processes: activeProcesses})
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// publish sends a snapshot to every subscriber ready to receive it.
+func (m *Meter) publish(snapshot Snapshot) {
+	m.subscribersMutex.Lock()
+	defer m.subscribersMutex.Unlock()
+
+	for _, subscriber := range m.subscribers {
+		select {
+		case subscriber <- snapshot:
+		default:
+		}
+	}
+}
+
+// manageStorage flushes the traffic to the storage every flush interval, until the meter is stopped.
+func (m *Meter) manageStorage() {
+	defer m.wait.Done()
+
+	var ticker = time.NewTicker(m.config.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.Flush()
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// manageInterfaces opens a capture on every selected interface once it appears, and closes it once it disappears, until the meter is stopped.
+func (m *Meter) manageInterfaces() {
+	defer m.wait.Done()
+
+	var (
+		captures          = make(map[string]CaptureHandle) // captures stores the open captures by interface name
+		currentInterfaces = make([]NetworkInterface, 0)    // currentInterfaces lists the interfaces found by the last check
+
+		ticker = time.NewTicker(time.Second)
+	)
+	defer ticker.Stop()
+
+	for {
+		// Gets interfaces
+		if ifaces, err := GetInterfaceList(); err != nil {
+			log.Println("Unable to retrieve interfaces: ", err)
+		} else {
+			addedInterfaces, removedInterfaces := CheckInterfaces(currentInterfaces, ifaces)
+			currentInterfaces = ifaces
+
+			// Reload the local addresses, as the interfaces or their addresses may have changed
+			if err := m.local.Refresh(); err != nil {
+				log.Println("Unable to retrieve local addresses: ", err)
+			}
+
+			// Removes interfaces not found
+			for _, iface := range removedInterfaces {
+				log.Println("Removed interface: ", iface.Description)
+				if capture, ok := captures[iface.Name]; ok {
+					m.closeCapture(iface.Name, capture)
+					delete(captures, iface.Name)
+				}
+			}
+
+			// Loop through the new interfaces
+			for _, iface := range addedInterfaces {
+				// Skip interfaces not selected by the settings, including loopback and tunnel interfaces unless enabled
+				if !m.config.CaptureInterface(iface) {
+					continue
+				}
+
+				if capture, err := m.openCapture(iface); err != nil {
+					log.Println("Unable do handle interface: ", iface.Description)
+				} else {
+					log.Println("Added interface: ", iface.Description)
+					captures[iface.Name] = capture
+				}
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-m.stop:
+			for name, capture := range captures {
+				log.Println("Closing interface: ", name)
+				m.closeCapture(name, capture)
+			}
+			return
+		}
+	}
+}
+
+// openCapture creates a capture for an interface with its backend, and starts a capture goroutine for each of its sources.
+func (m *Meter) openCapture(iface NetworkInterface) (CaptureHandle, error) {
+	capture, err := OpenCapture(iface.Name, m.filters.FilterFor(iface.Name), m.config.BackendFor(iface.Name), m.config.Fanout)
+	if err != nil {
+		return nil, err
+	}
+
+	// Register the capture, so filter changes are applied to it
+	m.filters.Register(iface.Name, capture)
+
+	// Compare the traffic captured on the interface with its kernel counters
+	m.coverage.Register(iface)
+
+	// The same packets may be captured on loopback and tunnel interfaces and on the other interfaces
+	m.deduplicator.Register(iface)
+	m.underlay.Register(iface)
+
+	// Each source is aggregated into its own shard
+	for _, source := range capture.Sources() {
+		m.wait.Add(1)
+		go m.readSource(source, capture.LinkType(), iface.Name, m.shards.Register(iface.Name))
+	}
+
+	return capture, nil
+}
+
+// closeCapture closes the capture of an interface, which ends the capture goroutines of its sources.
+// The traffic left in their shards is kept until the next merge.
+func (m *Meter) closeCapture(iface string, capture CaptureHandle) {
+	m.filters.Unregister(iface)
+	m.coverage.Unregister(iface)
+	m.deduplicator.Unregister(iface)
+	m.underlay.Unregister(iface)
+	m.shards.Unregister(iface)
+	capture.Close()
+}
+
+// readSource decodes the packets of a capture source with its interface's decoder, aggregating them into the source's shard until the capture is closed.
+func (m *Meter) readSource(source CaptureSource, linkType layers.LinkType, iface string, shard *AggregationShard) {
+	defer m.wait.Done()
+
+	reader := NewPacketReader(source, linkType, m.config.DecoderFor(iface))
+	ReadPackets(reader, func(packet gopacket.Packet) {
+		// Skip packets already counted on another interface
+		if m.deduplicator.Duplicate(iface, packet) {
+			return
+		}
+
+		// Skip the outer packets of the captured tunnels, whose traffic is attributed on the tunnel interface
+		if m.underlay.Outer(iface, packet, m.local) {
+			shard.SkipPacket(packet)
+			return
+		}
+
+		shard.ProcessPacket(packet, m)
+	})
+}
+
+// logVerbose logs its arguments only when the meter is in verbose mode.
+func (m *Meter) logVerbose(v ...interface{}) {
+	if m.config.Verbose {
+		log.Println(v...)
+	}
+}
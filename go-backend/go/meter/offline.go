@@ -0,0 +1,66 @@
+package meter
+
+import (
+	"log"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/pcap"
+)
+
+// CaptureSummary stores the result of analyzing a capture file, including the aggregated ActiveProcesses.
+type CaptureSummary struct {
+	File             string
+	Accounting       string // Accounting is the accounting mode the traffic was counted in
+	Packets          uint64
+	Attributed       uint64
+	First_Packet     time.Time
+	Last_Packet      time.Time
+	Active_Processes map[string]*ActiveProcess
+}
+
+// AnalyzeCaptureFile reads every packet from a pcap/pcapng file and processes it as if it were captured live, instead of starting the meter.
+// The current sockets are mapped first, so captures taken on this machine can be attributed to its processes.
+func (m *Meter) AnalyzeCaptureFile(path string) (summary *CaptureSummary, err error) {
+	var (
+		handle *pcap.Handle
+
+		// activeProcessesDatabase is required by ProcessPacket, but is not saved when analyzing a file
+		activeProcessesDatabase = make(map[string]*ActiveProcess)
+	)
+
+	if err = m.local.Refresh(); err != nil {
+		return nil, err
+	}
+
+	if err = m.UpdateSocketConnections(); err != nil {
+		log.Println("Unable to retrieve socket connections: ", err)
+	}
+
+	// Open the capture file
+	if handle, err = pcap.OpenOffline(path); err != nil {
+		return nil, err
+	}
+	defer handle.Close()
+
+	summary = &CaptureSummary{File: path, Accounting: m.config.Accounting, Active_Processes: make(map[string]*ActiveProcess)}
+
+	// Read packets until the end of the file
+	ReadPackets(NewPacketReader(handle, GetLinkType(handle), m.config.Decoder), func(packet gopacket.Packet) {
+		timestamp := packet.Metadata().Timestamp
+		if summary.Packets == 0 {
+			summary.First_Packet = timestamp
+		}
+		summary.Last_Packet = timestamp
+		summary.Packets++
+
+		if m.ProcessPacket(packet, "", summary.Active_Processes, activeProcessesDatabase) {
+			summary.Attributed++
+		}
+	})
+
+	// Attribute the flows whose socket was found after their first packets
+	summary.Attributed += m.AttributeResolvedFlows(m.ResolvePendingFlows(), summary.Active_Processes, activeProcessesDatabase)
+
+	return summary, nil
+}
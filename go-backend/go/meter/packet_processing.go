@@ -0,0 +1,772 @@
+package meter
+
+import (
+	"log"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	ps_net "github.com/shirou/gopsutil/v3/net"
+)
+
+// ActiveProcess stores all relevant information of a process generating network traffic, including the subprocesses, protocols used and external hosts.
+type ActiveProcess struct {
+	Name             string
+	Update_Time      int64
+	Accounting       string // Accounting is the accounting mode used to count Upload and Download
+	Upload           uint64
+	Download         uint64
+	Upload_Packets   uint64                  // Upload_Packets is the number of packets counted in Upload
+	Download_Packets uint64                  // Download_Packets is the number of packets counted in Download
+	Processes        map[string]*ProcessData // Processes stores the process instances by ProcessInstanceKey, as PIDs may be reused
+	Protocols        map[string]*ProtocolData
+	Hosts            map[string]*HostData
+	Users            map[int32]*UserData         // Users stores the traffic of the process by the UID owning its sockets
+	Cgroups          map[string]*CgroupData      // Cgroups stores the traffic of the process by the container or systemd unit it runs in
+	Applications     map[string]*ApplicationData // Applications stores the traffic of the process by the application matched by the application rules and the executable matched, by ApplicationKey
+}
+
+// ProcessData stores a Process' ID, its individual network consumption as well as time of creation and last update.
+// A process instance is identified by both its PID and creation time.
+type ProcessData struct {
+	Pid              int32
+	Creation_Time    int64  // Creation_Time is the time the process was created, in Unix milliseconds
+	Accounting       string // Accounting is the accounting mode of the ActiveProcess the traffic was counted in
+	Upload           uint64
+	Download         uint64
+	Upload_Packets   uint64
+	Download_Packets uint64
+}
+
+// ProtocolData stores the port number along with its well-known protocol name (if it has one) and its individual network consumption.
+type ProtocolData struct {
+	Protocol_Name    string // Protocol_Name is the transport and port of the service, such as "tcp/443"; traffic stored before transports were told apart has a bare port, such as "443"
+	Service          string // Service is the name of the port in the services table, such as "https"; empty if it has none
+	Accounting       string // Accounting is the accounting mode of the ActiveProcess the traffic was counted in
+	Upload           uint64
+	Download         uint64
+	Upload_Packets   uint64
+	Download_Packets uint64
+}
+
+// HostData stores the IP address of an external host communicating with the associated process, as well as its individual network consumption.
+type HostData struct {
+	Host_Name        string
+	Accounting       string // Accounting is the accounting mode of the ActiveProcess the traffic was counted in
+	Upload           uint64
+	Download         uint64
+	Upload_Packets   uint64
+	Download_Packets uint64
+}
+
+// UserData stores the UID and name of the user owning the sockets of the associated process, as well as its individual network consumption.
+type UserData struct {
+	Uid              int32
+	Username         string // Username is the name of the user, or the UID if it has no name
+	Accounting       string // Accounting is the accounting mode of the ActiveProcess the traffic was counted in
+	Upload           uint64
+	Download         uint64
+	Upload_Packets   uint64
+	Download_Packets uint64
+}
+
+// CgroupData stores the container or systemd unit the associated process runs in, as well as its individual network consumption.
+type CgroupData struct {
+	Cgroup_Name      string // Cgroup_Name is the kind and ID of the cgroup, such as "docker/3f2a1b4c5d6e" or "systemd/nginx.service"
+	Kind             string // Kind is the kind of the cgroup, such as "docker" or "systemd"
+	Accounting       string // Accounting is the accounting mode of the ActiveProcess the traffic was counted in
+	Upload           uint64
+	Download         uint64
+	Upload_Packets   uint64
+	Download_Packets uint64
+}
+
+// ApplicationData stores an application and category matched by the application rules, as well as its individual network consumption.
+// Traffic not matched by any rule is accounted to the process' own name, without category.
+type ApplicationData struct {
+	Application_Name string // Application_Name is the name of the application, such as "Zoom"
+	Category         string // Category is the category of the application, such as "Video conferencing"; empty if it has none
+	Exe              string // Exe is the executable of the process instances the traffic was matched with, empty if unknown, so exe rules can be reapplied to stored traffic
+	Accounting       string // Accounting is the accounting mode of the ActiveProcess the traffic was counted in
+	Upload           uint64
+	Download         uint64
+	Upload_Packets   uint64
+	Download_Packets uint64
+}
+
+// Pseudo-processes, accounting the traffic that cannot be attributed to a process.
+const (
+	UnattributedProcess = "unattributed" // UnattributedProcess accounts IP traffic whose socket was not found
+	IcmpProcess         = "icmp"         // IcmpProcess accounts ICMP and ICMPv6 traffic
+	LinkProcess         = "arp/link"     // LinkProcess accounts traffic without IP layer, such as ARP
+)
+
+// SocketConnectionTuple serves as a tuple for storing the transport protocol, along with the local and remote addresses and ports.
+// This is used as a key for mapping PIDs to the connected socket used by the process
+type SocketConnectionTuple struct {
+	Protocol       layers.IPProtocol
+	Local_Address  netip.Addr
+	Local_Port     uint16
+	Remote_Address netip.Addr
+	Remote_Port    uint16
+}
+
+// SocketLocalPort serves as a tuple for storing the transport protocol and the local address port.
+// This is used as a key for mapping PIDs to unconnected UDP sockets, which have no remote address
+type SocketLocalPort struct {
+	Protocol   layers.IPProtocol
+	Local_Port uint16
+}
+
+// SocketConnectionProcess stores relevant process information, along with the last time its socket was found.
+type SocketConnectionProcess struct {
+	name         string
+	pid          int32
+	creationTime int64
+	uid          int32  // uid is the user owning the socket, or unknownUid
+	cgroup       string // cgroup is the container or systemd unit of the process, as returned by ProcessCgroup; empty if unknown
+	exe          string // exe is the path of the process' executable; empty if unknown
+	lastSeen     time.Time
+}
+
+// SocketTableStats stores the size of the socket tables, for diagnostics.
+type SocketTableStats struct {
+	Connections int    // Connections is the number of entries in connections2pid
+	Udp_Ports   int    // Udp_Ports is the number of unconnected UDP sockets in ports2pid
+	Listening   int    // Listening is the number of local ports with a listening socket
+	Unresolved  int    // Unresolved is the number of tuples the resolver recently failed to find
+	Evicted     uint64 // Evicted is the number of entries removed since startup, for not being found by the socket scan
+	Last_Scan   int64  // Last_Scan is the time of the last socket scan, in Unix milliseconds
+}
+
+// socketState stores the sockets of a SocketTable. It is replaced as a whole on every change, so packets are looked up without locking.
+type socketState struct {
+	connections2pid map[SocketConnectionTuple]SocketConnectionProcess // connections2pid maps connected sockets to their process
+	ports2pid       map[SocketLocalPort]SocketConnectionProcess       // ports2pid maps unconnected UDP sockets to their process, by local port
+	listeningPorts  map[SocketLocalPort]time.Time                     // listeningPorts stores the local ports of server sockets, and when they were last found
+}
+
+// SocketTable maps the sockets found by the socket scans and the resolver to the processes owning them.
+// The sockets are read from a socketState replaced by the scans, evictions and resolver, so capture goroutines never wait for them.
+type SocketTable struct {
+	mutex            sync.Mutex                          // mutex serializes the changes of the state, and controls read/write operations in the other fields
+	state            atomic.Pointer[socketState]         // state stores the current sockets; neither the state nor its maps are modified
+	unresolved       map[SocketConnectionTuple]time.Time // unresolved stores the tuples the resolver failed to find, and when
+	scannedProcesses map[int32]SocketConnectionProcess   // scannedProcesses caches the process data of the PIDs found by the last socket scan
+	stats            SocketTableStats                    // stats stores the eviction count and time of the last scan
+}
+
+// NewSocketTable creates an empty SocketTable.
+func NewSocketTable() *SocketTable {
+	table := &SocketTable{
+		unresolved:       make(map[SocketConnectionTuple]time.Time),
+		scannedProcesses: make(map[int32]SocketConnectionProcess),
+	}
+	table.state.Store(&socketState{
+		connections2pid: make(map[SocketConnectionTuple]SocketConnectionProcess),
+		ports2pid:       make(map[SocketLocalPort]SocketConnectionProcess),
+		listeningPorts:  make(map[SocketLocalPort]time.Time),
+	})
+	return table
+}
+
+// mergeMaps returns a new map holding the entries of 'base', replaced or completed by the entries of 'updates'.
+func mergeMaps[K comparable, V any](base, updates map[K]V) map[K]V {
+	merged := make(map[K]V, len(base)+len(updates))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range updates {
+		merged[key] = value
+	}
+	return merged
+}
+
+// manageSockets retrieves the system-wide socket connections made by active processes every 'interval', until the meter is stopped.
+// Entries not found by the scans for longer than the socket timeout are evicted.
+func (m *Meter) manageSockets(interval time.Duration) {
+	defer m.wait.Done()
+
+	var ticker = time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// Update the connections2pid map, and log any errors
+		if err := m.UpdateSocketConnections(); err != nil {
+			log.Println("Unable to retrieve socket connections: ", err)
+		}
+
+		// Remove the sockets that were closed, and allow the resolver to retry the sockets it failed to find
+		m.sockets.EvictSocketConnections(m.config.SocketTimeout)
+		m.sockets.ExpireUnresolved()
+
+		// Find the outer flows of the captured tunnels, whose sockets may have changed
+		m.underlay.Refresh(m.sockets)
+
+		select {
+		case <-ticker.C:
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// UpdateSocketConnections retrieves the system-wide socket connections made by active processes and stores them in the socket table.
+// Process data is only retrieved for PIDs not seen on the previous call.
+func (m *Meter) UpdateSocketConnections() error {
+	var (
+		connections             []ps_net.ConnectionStat // connections stores the scoket connections list from ps_net.Connections
+		socketConnectionTuple   SocketConnectionTuple   // socketConnectionTuple stores the protocol, local and remote addresses as keys for the connections2pid map
+		socketConnectionProcess SocketConnectionProcess // socketConnectionProcess stores the relevant process information pertaining to that key
+
+		pid        int32
+		protocol   layers.IPProtocol
+		localAddr  netip.Addr
+		remoteAddr netip.Addr
+		ok         bool
+		err        error
+
+		table           = m.sockets
+		connections2pid = make(map[SocketConnectionTuple]SocketConnectionProcess) // connections2pid stores the connected sockets found by this scan
+		ports2pid       = make(map[SocketLocalPort]SocketConnectionProcess)       // ports2pid stores the unconnected UDP sockets found by this scan
+		listeningPorts  = make(map[SocketLocalPort]time.Time)                     // listeningPorts stores the ports of the server sockets found by this scan
+	)
+
+	// Get system-wide socket connections
+	if connections, err = ps_net.Connections("all"); err != nil {
+		return err
+	}
+
+	// Keep the process data of the PIDs found on this call only
+	table.mutex.Lock()
+	previousProcesses := table.scannedProcesses
+	table.mutex.Unlock()
+	scannedProcesses := make(map[int32]SocketConnectionProcess)
+	scanTime := time.Now()
+
+	// Map valid connections as {SocketConnectionTuple : PID}
+	for _, conn := range connections {
+
+		// Get this connection's PID
+		pid = conn.Pid
+
+		// Skip this iteration if the socket is neither TCP nor UDP
+		if protocol, ok = GetSocketProtocol(conn.Type); !ok {
+			continue
+		}
+
+		// Skip this iteration if the local IP doesn't exist
+		if localAddr, err = netip.ParseAddr(conn.Laddr.IP); err != nil {
+			continue
+		}
+
+		// Remember the ports of server sockets, which tell the service side of their connections
+		if IsListeningSocket(m.services, protocol, conn) {
+			listeningPorts[SocketLocalPort{Protocol: protocol, Local_Port: uint16(conn.Laddr.Port)}] = scanTime
+		}
+
+		// Get the process name and creation time, unless known from the previous call; skip this iteration should any errors occur
+		if socketConnectionProcess, ok = scannedProcesses[pid]; !ok {
+			if socketConnectionProcess, ok = previousProcesses[pid]; !ok {
+				if socketConnectionProcess, err = m.processes.Owner(pid, unknownUid); err != nil {
+					continue
+				}
+			}
+			scannedProcesses[pid] = socketConnectionProcess
+		}
+		socketConnectionProcess.uid = SocketOwner(conn)
+		socketConnectionProcess.lastSeen = scanTime
+
+		// Sockets without a remote address are either listening (TCP) or unconnected (UDP).
+		// Unconnected UDP sockets can send to any host, so they are mapped by their local port only
+		if remoteAddr, err = netip.ParseAddr(conn.Raddr.IP); err != nil || remoteAddr.IsUnspecified() || conn.Raddr.Port == 0 {
+			if protocol == layers.IPProtocolUDP {
+				ports2pid[SocketLocalPort{Protocol: protocol, Local_Port: uint16(conn.Laddr.Port)}] = socketConnectionProcess
+			}
+			continue
+		}
+
+		// Add the process information as an entry in the map, using the protocol, addresses and ports as the key
+		socketConnectionTuple = SocketConnectionTuple{
+			Protocol:       protocol,
+			Local_Address:  localAddr.Unmap(),
+			Local_Port:     uint16(conn.Laddr.Port),
+			Remote_Address: remoteAddr.Unmap(),
+			Remote_Port:    uint16(conn.Raddr.Port),
+		}
+
+		// Store this information in the connections2pid map
+		connections2pid[socketConnectionTuple] = socketConnectionProcess
+	}
+
+	// Replace the state once, adding the sockets found to those not evicted yet
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+
+	current := table.state.Load()
+	table.state.Store(&socketState{
+		connections2pid: mergeMaps(current.connections2pid, connections2pid),
+		ports2pid:       mergeMaps(current.ports2pid, ports2pid),
+		listeningPorts:  mergeMaps(current.listeningPorts, listeningPorts),
+	})
+	table.scannedProcesses = scannedProcesses
+	table.stats.Last_Scan = scanTime.UnixMilli()
+
+	return nil
+}
+
+// AddConnections adds connected sockets to the socket table, such as those found by the resolver, replacing the state once.
+func (table *SocketTable) AddConnections(connections map[SocketConnectionTuple]SocketConnectionProcess) {
+	if len(connections) == 0 {
+		return
+	}
+
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+
+	current := table.state.Load()
+	table.state.Store(&socketState{
+		connections2pid: mergeMaps(current.connections2pid, connections),
+		ports2pid:       current.ports2pid,
+		listeningPorts:  current.listeningPorts,
+	})
+	for tuple := range connections {
+		delete(table.unresolved, tuple)
+	}
+}
+
+// EvictSocketConnections removes the entries of connections2pid and ports2pid not found by a socket scan for longer than 'timeout'.
+// This frees closed sockets, and prevents a later reuse of their ports being attributed to their old process.
+func (table *SocketTable) EvictSocketConnections(timeout time.Duration) {
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+
+	var (
+		current = table.state.Load()
+		updated = &socketState{
+			connections2pid: make(map[SocketConnectionTuple]SocketConnectionProcess, len(current.connections2pid)),
+			ports2pid:       make(map[SocketLocalPort]SocketConnectionProcess, len(current.ports2pid)),
+			listeningPorts:  make(map[SocketLocalPort]time.Time, len(current.listeningPorts)),
+		}
+	)
+
+	for tuple, connection := range current.connections2pid {
+		if time.Since(connection.lastSeen) > timeout {
+			table.stats.Evicted++
+		} else {
+			updated.connections2pid[tuple] = connection
+		}
+	}
+
+	for localPort, connection := range current.ports2pid {
+		if time.Since(connection.lastSeen) > timeout {
+			table.stats.Evicted++
+		} else {
+			updated.ports2pid[localPort] = connection
+		}
+	}
+
+	for localPort, lastSeen := range current.listeningPorts {
+		if time.Since(lastSeen) <= timeout {
+			updated.listeningPorts[localPort] = lastSeen
+		}
+	}
+
+	table.state.Store(updated)
+}
+
+// IsListeningSocket reports whether a socket is waiting for connections: a listening TCP socket, or an unconnected UDP socket bound to a port named in 'services'.
+// Unconnected UDP sockets on other ports are usually clients, bound to an ephemeral port.
+func IsListeningSocket(services *Services, protocol layers.IPProtocol, conn ps_net.ConnectionStat) bool {
+	switch protocol {
+	case layers.IPProtocolTCP:
+		return conn.Status == "LISTEN"
+	case layers.IPProtocolUDP:
+		return conn.Raddr.Port == 0 && (conn.Laddr.Port < 1024 || services.Lookup(ProtocolName(protocol, uint16(conn.Laddr.Port))) != "")
+	default:
+		return false
+	}
+}
+
+// IsListeningPort reports whether a local port has a listening socket, making the local machine the server of its connections.
+func (table *SocketTable) IsListeningPort(localPort SocketLocalPort) bool {
+	_, ok := table.state.Load().listeningPorts[localPort]
+	return ok
+}
+
+// Stats returns the current size of the socket tables.
+func (table *SocketTable) Stats() SocketTableStats {
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+
+	state := table.state.Load()
+	stats := table.stats
+	stats.Connections = len(state.connections2pid)
+	stats.Udp_Ports = len(state.ports2pid)
+	stats.Listening = len(state.listeningPorts)
+	stats.Unresolved = len(table.unresolved)
+
+	return stats
+}
+
+// GetSocketProtocol returns the transport protocol of a socket type (SOCK_STREAM or SOCK_DGRAM).
+func GetSocketProtocol(socketType uint32) (layers.IPProtocol, bool) {
+	switch socketType {
+	case syscall.SOCK_STREAM:
+		return layers.IPProtocolTCP, true
+	case syscall.SOCK_DGRAM:
+		return layers.IPProtocolUDP, true
+	default:
+		return 0, false
+	}
+}
+
+// GetTransportProtocol returns the transport protocol of a packet's transport layer, if it can be mapped to a socket.
+func GetTransportProtocol(transportLayer gopacket.TransportLayer) (layers.IPProtocol, bool) {
+	switch transportLayer.LayerType() {
+	case layers.LayerTypeTCP:
+		return layers.IPProtocolTCP, true
+	case layers.LayerTypeUDP:
+		return layers.IPProtocolUDP, true
+	default:
+		return 0, false
+	}
+}
+
+// ProcessPacket relates packet information to its related process.
+// It stores the process information in an existing or new ActiveProcess and updates the ActiveProcesses map directly.
+// No packet is discarded: packets that cannot be attributed to a process, including malformed ones, are accounted to a pseudo-process,
+// as downloads if their direction is not found. iface is the interface the packet was captured on, empty for capture files: the bytes of
+// pending flows are counted as attributed in its coverage once their socket is found. Returns true if the packet was attributed to a process.
+func (m *Meter) ProcessPacket(packet gopacket.Packet, iface string, activeProcessesParser, activeProcessesDatabase map[string]*ActiveProcess) bool {
+	var (
+		key, invertedKey SocketConnectionTuple         // key and invertedKey stores the protocol, local and remote addresses (or the inverse) as keys to the connections2pid map.
+		localPort        SocketLocalPort               // localPort stores the protocol and local port as a key to the ports2pid map, for unconnected UDP sockets.
+		isUpload         bool                  = false // Initializes a flag to indicate whether the packet flow is an upload or download.
+
+		size             uint64
+		owner            SocketConnectionProcess
+		protocol         layers.IPProtocol
+		srcIP, dstIP     netip.Addr
+		srcPort, dstPort uint64
+		processName      string
+		hostIP           string
+		protocolName     string
+
+		networkLayer   gopacket.NetworkLayer
+		transportLayer gopacket.TransportLayer
+		linkLayer      gopacket.LinkLayer
+
+		ok bool
+	)
+
+	// Get the packet size, according to the accounting mode
+	size = PacketSize(packet, m.config.Accounting)
+	linkLayer = packet.LinkLayer()
+
+	// Account the traffic without IP layer, such as ARP, to the link pseudo-process
+	if networkLayer = packet.NetworkLayer(); networkLayer == nil {
+		if isUpload, ok = m.local.IsLinkUpload(linkLayer); !ok {
+			m.logVerbose("Network Layer not found")
+			m.AttributePseudoProcess(activeProcessesParser, activeProcessesDatabase, UnattributedProcess, "", GetLinkProtocolName(packet), false, size)
+			return false
+		}
+
+		if isUpload {
+			hostIP = linkLayer.LinkFlow().Dst().String()
+		} else {
+			hostIP = linkLayer.LinkFlow().Src().String()
+		}
+
+		m.AttributePseudoProcess(activeProcessesParser, activeProcessesDatabase, LinkProcess, hostIP, GetLinkProtocolName(packet), isUpload, size)
+		return false
+	}
+
+	// Get the source and destination IP addresses
+	var err error
+	if srcIP, dstIP, err = GetIPs(networkLayer); err != nil {
+		m.logVerbose("Error getting IPs: ", err)
+		_, protocolName = GetNetworkProtocolName(packet)
+		m.AttributePseudoProcess(activeProcessesParser, activeProcessesDatabase, UnattributedProcess, "", protocolName, false, size)
+		return false
+	}
+
+	// Check if the packet is an upload or download. The link layer is missing on loopback, tunnel and cooked captures.
+	// Packets whose direction is not found by the addresses, such as between two local addresses, are seen as downloads unless their socket is found
+	isUpload, directionFound := m.local.IsUpload(linkLayer, srcIP, dstIP)
+	hostIP = GetHostIP(srcIP, dstIP, isUpload)
+
+	// Account the traffic of transports without sockets, such as ICMP, to a pseudo-process
+	transportLayer = packet.TransportLayer()
+	if transportLayer != nil {
+		protocol, ok = GetTransportProtocol(transportLayer)
+	}
+	if transportLayer == nil || !ok {
+		processName, protocolName = GetNetworkProtocolName(packet)
+		m.logVerbose("Transport protocol ", protocolName, " accounted to ", processName)
+
+		m.AttributePseudoProcess(activeProcessesParser, activeProcessesDatabase, processName, hostIP, protocolName, isUpload, size)
+		return false
+	}
+
+	// Get the source and destination ports
+	if srcPort, dstPort, err = GetPorts(transportLayer); err != nil {
+		m.logVerbose("Error getting ports: ", err)
+		m.AttributePseudoProcess(activeProcessesParser, activeProcessesDatabase, UnattributedProcess, hostIP, strings.ToLower(protocol.String()), isUpload, size)
+		return false
+	}
+
+	key = SocketConnectionTuple{Protocol: protocol, Local_Address: srcIP, Local_Port: uint16(srcPort), Remote_Address: dstIP, Remote_Port: uint16(dstPort)}
+	invertedKey = SocketConnectionTuple{Protocol: protocol, Local_Address: dstIP, Local_Port: uint16(dstPort), Remote_Address: srcIP, Remote_Port: uint16(srcPort)}
+
+	// The direction of packets not found by the addresses is the one of their socket: an upload if the socket found sends the packet
+	if !directionFound {
+		if owner, isUpload, ok = m.LookupSocketDirection(key, invertedKey); ok {
+			hostIP = GetHostIP(srcIP, dstIP, isUpload)
+		}
+	}
+	protocolName, localPort = m.FlowProtocol(key, isUpload)
+
+	// Check if the process exist as a socket connection, unless it was found along with the direction. If not, hold the packet until its socket is found.
+	if directionFound {
+		owner, ok = m.LookupSocketProcess(key, invertedKey, localPort)
+	}
+	if !ok {
+		m.logVerbose("Packet pending attribution")
+		if !directionFound {
+			ok = m.pending.AddPendingFlow(PendingFlow{key: key, invertedKey: invertedKey, undirected: true, hostIP: hostIP, protocolName: protocolName, download: size, downloadPackets: 1}, iface, uint64(packet.Metadata().Length))
+		} else if isUpload {
+			ok = m.pending.AddPendingFlow(PendingFlow{key: key, invertedKey: invertedKey, localPort: localPort, hostIP: hostIP, protocolName: protocolName, upload: size, uploadPackets: 1}, iface, uint64(packet.Metadata().Length))
+		} else {
+			ok = m.pending.AddPendingFlow(PendingFlow{key: invertedKey, invertedKey: key, localPort: localPort, hostIP: hostIP, protocolName: protocolName, download: size, downloadPackets: 1}, iface, uint64(packet.Metadata().Length))
+		}
+
+		// Account the packet as unattributed should the pending table be full
+		if !ok {
+			m.logVerbose("Pending table full")
+			m.AttributePseudoProcess(activeProcessesParser, activeProcessesDatabase, UnattributedProcess, hostIP, protocolName, isUpload, size)
+		}
+		return false
+	}
+
+	if isUpload {
+		m.AttributeTraffic(activeProcessesParser, activeProcessesDatabase, owner, hostIP, protocolName, 0, size, 0, 1)
+	} else {
+		m.AttributeTraffic(activeProcessesParser, activeProcessesDatabase, owner, hostIP, protocolName, size, 0, 1, 0)
+	}
+
+	return true
+}
+
+// GetHostIP returns the address of the remote host of a packet: its destination for uploads, and its source for downloads.
+func GetHostIP(srcIP, dstIP netip.Addr, isUpload bool) string {
+	if isUpload {
+		return dstIP.String()
+	}
+	return srcIP.String()
+}
+
+// FlowProtocol returns the protocol name and local port of a packet, given its tuple as seen from its source and its direction.
+// The traffic of local servers is labelled by their listening port, as the remote port is an ephemeral client port.
+func (m *Meter) FlowProtocol(key SocketConnectionTuple, isUpload bool) (protocolName string, localPort SocketLocalPort) {
+	if isUpload {
+		protocolName = ProtocolName(key.Protocol, key.Remote_Port)
+		localPort = SocketLocalPort{Protocol: key.Protocol, Local_Port: key.Local_Port}
+	} else {
+		protocolName = ProtocolName(key.Protocol, key.Local_Port)
+		localPort = SocketLocalPort{Protocol: key.Protocol, Local_Port: key.Remote_Port}
+	}
+
+	if m.sockets.IsListeningPort(localPort) {
+		protocolName = ProtocolName(key.Protocol, localPort.Local_Port)
+	}
+
+	return protocolName, localPort
+}
+
+// AttributePseudoProcess adds the traffic of a single packet to a pseudo-process, which has no PID.
+func (m *Meter) AttributePseudoProcess(activeProcessesParser, activeProcessesDatabase map[string]*ActiveProcess, processName, hostIP, protocolName string, isUpload bool, size uint64) {
+	owner := PseudoProcess(processName)
+	if isUpload {
+		m.AttributeTraffic(activeProcessesParser, activeProcessesDatabase, owner, hostIP, protocolName, 0, size, 0, 1)
+	} else {
+		m.AttributeTraffic(activeProcessesParser, activeProcessesDatabase, owner, hostIP, protocolName, size, 0, 1, 0)
+	}
+}
+
+// PseudoProcess returns the owner of the traffic accounted to a pseudo-process, which has no PID, user nor cgroup.
+func PseudoProcess(processName string) SocketConnectionProcess {
+	return SocketConnectionProcess{name: processName, uid: unknownUid}
+}
+
+// GetNetworkProtocolName returns the pseudo-process and protocol name of an IP packet without TCP or UDP layer.
+// ICMP and ICMPv6, including IPv6 neighbor discovery, are accounted to IcmpProcess; other protocols to UnattributedProcess.
+func GetNetworkProtocolName(packet gopacket.Packet) (processName string, protocolName string) {
+	if packet.Layer(layers.LayerTypeICMPv4) != nil {
+		return IcmpProcess, "icmp"
+	}
+	if packet.Layer(layers.LayerTypeICMPv6) != nil {
+		return IcmpProcess, "icmpv6"
+	}
+
+	switch networkLayer := packet.NetworkLayer().(type) {
+	case *layers.IPv4:
+		return UnattributedProcess, strings.ToLower(networkLayer.Protocol.String())
+	case *layers.IPv6:
+		return UnattributedProcess, strings.ToLower(networkLayer.NextHeader.String())
+	default:
+		return UnattributedProcess, strings.ToLower(packet.NetworkLayer().LayerType().String())
+	}
+}
+
+// GetLinkProtocolName returns the protocol name of a packet without IP layer, such as "arp".
+func GetLinkProtocolName(packet gopacket.Packet) string {
+	if ethernet, ok := packet.Layer(layers.LayerTypeEthernet).(*layers.Ethernet); ok {
+		return strings.ToLower(ethernet.EthernetType.String())
+	}
+	if linkLayer := packet.LinkLayer(); linkLayer != nil {
+		return strings.ToLower(linkLayer.LayerType().String())
+	}
+	return "link"
+}
+
+// AttributeTraffic adds the traffic of a socket's owner to the ActiveProcess with its name, in both the parser and database maps.
+// Traffic with an unknownUid is not accounted to any user, and traffic without cgroup to any cgroup.
+func (m *Meter) AttributeTraffic(activeProcessesParser, activeProcessesDatabase map[string]*ActiveProcess, owner SocketConnectionProcess, hostIP, protocolName string, download, upload, downloadPackets, uploadPackets uint64) {
+	var (
+		activeProcess   *ActiveProcess
+		activeProcessDB *ActiveProcess
+		processName     = owner.name
+	)
+
+	// Create a new ActiveProcess object for this process if one does not exist in the activeProcesses map
+	if _, ok := activeProcessesParser[processName]; !ok {
+		activeProcess = m.CreateActiveProcess(processName)
+		activeProcessesParser[processName] = activeProcess
+	}
+
+	// Create a new ActiveProcess object for this process if one does not exist in the activeProcesses map
+	if _, ok := activeProcessesDatabase[processName]; !ok {
+		activeProcessDB = m.CreateActiveProcess(processName)
+		activeProcessesDatabase[processName] = activeProcessDB
+	}
+
+	// Get the ActiveProcess information for this process
+	activeProcess = activeProcessesParser[processName]
+	activeProcessDB = activeProcessesDatabase[processName]
+
+	// Match the application rules once for both maps
+	application, category := m.rules.Match(processName, owner.exe, hostIP)
+
+	// Update the ActiveProcess according to packet flow
+	m.UpdateActiveProcess(activeProcess, owner, hostIP, protocolName, application, category, download, upload, downloadPackets, uploadPackets)
+	m.UpdateActiveProcess(activeProcessDB, owner, hostIP, protocolName, application, category, download, upload, downloadPackets, uploadPackets)
+}
+
+// CreateActiveProcess creates a new ActiveProcess object counted in the meter's accounting mode, making empty maps where applicable. Returns a pointer to the new ActiveProcess
+func (m *Meter) CreateActiveProcess(name string) (activeProcess *ActiveProcess) {
+	activeProcess = &ActiveProcess{Name: name, Accounting: m.config.Accounting}
+
+	activeProcess.Processes = make(map[string]*ProcessData)
+	activeProcess.Protocols = make(map[string]*ProtocolData)
+	activeProcess.Hosts = make(map[string]*HostData)
+	activeProcess.Users = make(map[int32]*UserData)
+	activeProcess.Cgroups = make(map[string]*CgroupData)
+	activeProcess.Applications = make(map[string]*ApplicationData)
+
+	return activeProcess
+}
+
+// UpdateActiveProcess updates an activeProcess with information extracted from the packet. This function updates the connection directly by reference.
+// The application and category are the ones matched by the application rules for the traffic.
+func (m *Meter) UpdateActiveProcess(activeProcess *ActiveProcess, owner SocketConnectionProcess, host string, protocol string, application string, category string, download uint64, upload uint64, downloadPackets uint64, uploadPackets uint64) {
+	// Create a new entry in the Processes map if the process instance is not found
+	processKey := ProcessInstanceKey(owner.pid, owner.creationTime)
+	if _, ok := activeProcess.Processes[processKey]; !ok {
+		activeProcess.Processes[processKey] = &ProcessData{Pid: owner.pid, Creation_Time: owner.creationTime, Accounting: activeProcess.Accounting}
+	}
+
+	// Create a new entry in the Protocols map if the protocol is not found
+	if _, ok := activeProcess.Protocols[protocol]; !ok {
+		activeProcess.Protocols[protocol] = &ProtocolData{Protocol_Name: protocol, Service: m.services.Lookup(protocol), Accounting: activeProcess.Accounting}
+	}
+
+	// Create a new entry in the Hosts map if the host is not found
+	if _, ok := activeProcess.Hosts[host]; !ok {
+		activeProcess.Hosts[host] = &HostData{Host_Name: host, Accounting: activeProcess.Accounting}
+	}
+
+	// Update all network statistics as well as the time this connection was updated
+	activeProcess.Download += download
+	activeProcess.Upload += upload
+	activeProcess.Download_Packets += downloadPackets
+	activeProcess.Upload_Packets += uploadPackets
+	activeProcess.Update_Time = time.Now().UnixMilli()
+
+	activeProcess.Processes[processKey].Download += download
+	activeProcess.Processes[processKey].Upload += upload
+	activeProcess.Processes[processKey].Download_Packets += downloadPackets
+	activeProcess.Processes[processKey].Upload_Packets += uploadPackets
+
+	activeProcess.Protocols[protocol].Download += download
+	activeProcess.Protocols[protocol].Upload += upload
+	activeProcess.Protocols[protocol].Download_Packets += downloadPackets
+	activeProcess.Protocols[protocol].Upload_Packets += uploadPackets
+
+	activeProcess.Hosts[host].Download += download
+	activeProcess.Hosts[host].Upload += upload
+	activeProcess.Hosts[host].Download_Packets += downloadPackets
+	activeProcess.Hosts[host].Upload_Packets += uploadPackets
+
+	// Account the traffic to the user owning the socket, if known
+	if owner.uid != unknownUid {
+		if _, ok := activeProcess.Users[owner.uid]; !ok {
+			activeProcess.Users[owner.uid] = &UserData{Uid: owner.uid, Username: m.processes.Username(owner.uid), Accounting: activeProcess.Accounting}
+		}
+
+		activeProcess.Users[owner.uid].Download += download
+		activeProcess.Users[owner.uid].Upload += upload
+		activeProcess.Users[owner.uid].Download_Packets += downloadPackets
+		activeProcess.Users[owner.uid].Upload_Packets += uploadPackets
+	}
+
+	// Account the traffic to the container or systemd unit of the process, if known
+	if owner.cgroup != "" {
+		if _, ok := activeProcess.Cgroups[owner.cgroup]; !ok {
+			kind, _, _ := strings.Cut(owner.cgroup, "/")
+			activeProcess.Cgroups[owner.cgroup] = &CgroupData{Cgroup_Name: owner.cgroup, Kind: kind, Accounting: activeProcess.Accounting}
+		}
+
+		activeProcess.Cgroups[owner.cgroup].Download += download
+		activeProcess.Cgroups[owner.cgroup].Upload += upload
+		activeProcess.Cgroups[owner.cgroup].Download_Packets += downloadPackets
+		activeProcess.Cgroups[owner.cgroup].Upload_Packets += uploadPackets
+	}
+
+	// Account the traffic to the application matched by the application rules, along with the executable it was matched with
+	applicationKey := ApplicationKey(application, owner.exe)
+	if _, ok := activeProcess.Applications[applicationKey]; !ok {
+		activeProcess.Applications[applicationKey] = &ApplicationData{Application_Name: application, Category: category, Exe: owner.exe, Accounting: activeProcess.Accounting}
+	}
+
+	activeProcess.Applications[applicationKey].Download += download
+	activeProcess.Applications[applicationKey].Upload += upload
+	activeProcess.Applications[applicationKey].Download_Packets += downloadPackets
+	activeProcess.Applications[applicationKey].Upload_Packets += uploadPackets
+}
+
+// ApplicationKey returns the key of an application in ActiveProcess.Applications, formatted as "<application>@<executable>".
+func ApplicationKey(application, exe string) string {
+	return application + "@" + exe
+}
+
+// ProcessInstanceKey returns the key of a process instance in ActiveProcess.Processes, formatted as "<pid>@<creation time>".
+func ProcessInstanceKey(pid int32, creationTime int64) string {
+	return strconv.FormatInt(int64(pid), 10) + "@" + strconv.FormatInt(creationTime, 10)
+}
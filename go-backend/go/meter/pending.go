@@ -0,0 +1,180 @@
+package meter
+
+import (
+	"sync"
+	"time"
+)
+
+// PendingFlow stores the traffic of a flow whose socket was not found yet, so it can be attributed once its process is known.
+type PendingFlow struct {
+	key             SocketConnectionTuple // key is the flow's tuple, as seen from the local machine; from the packets' source if undirected
+	invertedKey     SocketConnectionTuple // invertedKey is the flow's tuple, as seen from the remote host; from the packets' destination if undirected
+	localPort       SocketLocalPort       // localPort is the flow's key to the ports2pid map, for unconnected UDP sockets
+	undirected      bool                  // undirected is set if the local addresses cannot tell the direction of the packets, counted as downloads until their socket is found
+	hostIP          string
+	protocolName    string
+	upload          uint64
+	download        uint64
+	uploadPackets   uint64
+	downloadPackets uint64
+	captured        map[string]uint64 // captured stores the bytes captured on each interface, counted as attributed in their coverage once the flow is resolved
+	firstSeen       time.Time
+}
+
+// PendingStats stores the size of the pending table, for diagnostics.
+type PendingStats struct {
+	Flows    int    // Flows is the number of flows waiting for their socket to be found
+	Resolved uint64 // Resolved is the number of flows attributed late since startup
+	Expired  uint64 // Expired is the number of flows accounted as unattributed since startup, for not being found within pendingTimeout
+}
+
+const (
+	pendingTimeout  = 10 * time.Second // pendingTimeout is the time a flow is kept in the pending table before its traffic is unattributed
+	maxPendingFlows = 4096             // maxPendingFlows limits the size of the pending table; traffic of further flows is unattributed
+)
+
+// PendingTable stores the flows whose socket was not found yet, by their local tuple.
+type PendingTable struct {
+	mutex sync.Mutex                             // mutex controls read/write operations in flows and stats
+	flows map[SocketConnectionTuple]*PendingFlow // flows stores the unattributed flows by their local tuple
+	stats PendingStats                           // stats stores the resolved and expired counts of the table
+}
+
+// NewPendingTable creates an empty PendingTable.
+func NewPendingTable() *PendingTable {
+	return &PendingTable{flows: make(map[SocketConnectionTuple]*PendingFlow)}
+}
+
+// AddPendingFlow adds the traffic of an unattributed packet, given as a flow of a single packet, to its flow in the pending table,
+// along with its captured length on its interface. Returns false if the flow is new and the table is full.
+func (table *PendingTable) AddPendingFlow(packet PendingFlow, iface string, captured uint64) bool {
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+
+	flow, ok := table.flows[packet.key]
+	if !ok {
+		if len(table.flows) >= maxPendingFlows {
+			return false
+		}
+
+		flow = &PendingFlow{key: packet.key, invertedKey: packet.invertedKey, localPort: packet.localPort, undirected: packet.undirected, hostIP: packet.hostIP,
+			protocolName: packet.protocolName, captured: make(map[string]uint64, 1), firstSeen: time.Now()}
+		table.flows[packet.key] = flow
+	}
+
+	flow.upload += packet.upload
+	flow.download += packet.download
+	flow.uploadPackets += packet.uploadPackets
+	flow.downloadPackets += packet.downloadPackets
+	if iface != "" {
+		flow.captured[iface] += captured
+	}
+
+	return true
+}
+
+// ResolvedFlow stores a flow removed from the pending table by ResolvePendingFlows, and the owner its traffic is attributed to.
+type ResolvedFlow struct {
+	PendingFlow
+	owner      SocketConnectionProcess
+	attributed bool // attributed is set if the flow's socket was found; expired flows are owned by UnattributedProcess
+}
+
+// pendingOwner stores the owner found for a pending flow by ResolvePendingFlows, and the direction found for undirected flows.
+type pendingOwner struct {
+	connection SocketConnectionProcess
+	isUpload   bool
+}
+
+// ResolvePendingFlows looks up the socket of every pending flow, asking the resolver about those not in the socket table, and removes the flows found
+// from the pending table, along with the flows still unattributed after pendingTimeout. No lock is held during the lookups, which may query the resolver;
+// the sockets it finds are added to the socket table at once.
+// The traffic of undirected flows is turned into uploads if their socket sends their packets. Returns the removed flows, whose traffic is added to
+// the buffers by AttributeResolvedFlows.
+func (m *Meter) ResolvePendingFlows() []ResolvedFlow {
+	var (
+		table    = m.pending
+		owners   = make(map[SocketConnectionTuple]pendingOwner)
+		sockets  = make(map[SocketConnectionTuple]SocketConnectionProcess)
+		resolved = make([]ResolvedFlow, 0)
+	)
+
+	// Copy the flows, so capture goroutines can add to the pending table during the lookups
+	table.mutex.Lock()
+	flows := make([]PendingFlow, 0, len(table.flows))
+	for _, flow := range table.flows {
+		flows = append(flows, *flow)
+	}
+	table.mutex.Unlock()
+
+	for _, flow := range flows {
+		if flow.undirected {
+			if connection, isUpload, ok := m.ResolveSocketDirection(flow.key, flow.invertedKey, sockets); ok {
+				owners[flow.key] = pendingOwner{connection: connection, isUpload: isUpload}
+			}
+		} else if connection, ok := m.ResolveSocketProcess(flow.key, flow.invertedKey, flow.localPort, sockets); ok {
+			owners[flow.key] = pendingOwner{connection: connection}
+		}
+	}
+	m.sockets.AddConnections(sockets)
+
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+
+	// Remove the flows found or expired, including the traffic added to them during the lookups
+	for _, copied := range flows {
+		flow, ok := table.flows[copied.key]
+		if !ok {
+			continue
+		}
+
+		if owner, ok := owners[flow.key]; ok {
+			resolvedFlow := ResolvedFlow{PendingFlow: *flow, owner: owner.connection, attributed: true}
+			if flow.undirected && owner.isUpload {
+				resolvedFlow.upload, resolvedFlow.download = flow.download, 0
+				resolvedFlow.uploadPackets, resolvedFlow.downloadPackets = flow.downloadPackets, 0
+				resolvedFlow.hostIP = GetHostIP(flow.key.Local_Address, flow.key.Remote_Address, true)
+				resolvedFlow.protocolName, _ = m.FlowProtocol(flow.key, true)
+			}
+			resolved = append(resolved, resolvedFlow)
+			table.stats.Resolved++
+		} else if time.Since(flow.firstSeen) > pendingTimeout {
+			m.logVerbose("Pending flow unattributed: ", flow.key.Local_Address, flow.key.Local_Port, flow.key.Remote_Address, flow.key.Remote_Port)
+			resolved = append(resolved, ResolvedFlow{PendingFlow: *flow, owner: PseudoProcess(UnattributedProcess)})
+			table.stats.Expired++
+		} else {
+			continue
+		}
+
+		delete(table.flows, flow.key)
+	}
+
+	return resolved
+}
+
+// AttributeResolvedFlows adds the traffic of the flows returned by ResolvePendingFlows to their owners, in both the parser and database maps,
+// and counts the captured bytes of the flows found as attributed in the coverage of their interfaces. Returns the number of packets attributed to processes.
+func (m *Meter) AttributeResolvedFlows(flows []ResolvedFlow, activeProcessesParser, activeProcessesDatabase map[string]*ActiveProcess) (packets uint64) {
+	for _, flow := range flows {
+		m.AttributeTraffic(activeProcessesParser, activeProcessesDatabase, flow.owner, flow.hostIP, flow.protocolName, flow.download, flow.upload, flow.downloadPackets, flow.uploadPackets)
+		if flow.attributed {
+			packets += flow.uploadPackets + flow.downloadPackets
+			for iface, captured := range flow.captured {
+				m.coverage.AddBytes(iface, 0, captured)
+			}
+		}
+	}
+
+	return packets
+}
+
+// Stats returns the current size of the pending table.
+func (table *PendingTable) Stats() PendingStats {
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+
+	stats := table.stats
+	stats.Flows = len(table.flows)
+
+	return stats
+}
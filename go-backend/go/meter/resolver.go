@@ -0,0 +1,160 @@
+package meter
+
+import (
+	"time"
+)
+
+// SocketResolver finds the process owning a socket on demand, when the socket of a pending flow is not found in the connections2pid map.
+// Platforms without a resolver rely on the socket scans alone, which poll every socket through gopsutil.
+type SocketResolver interface {
+	// Resolve returns the PID of the process owning the socket identified by the tuple, as seen from the local machine, and the UID owning the socket.
+	Resolve(tuple SocketConnectionTuple) (pid int32, uid int32, ok bool)
+}
+
+const (
+	unresolvedTimeout = time.Second // unresolvedTimeout is the time before the resolver is asked again about a tuple it failed to find
+	maxUnresolved     = 4096        // maxUnresolved limits the size of the unresolved map; it is cleared once reached, so tuples are at worst retried early
+)
+
+// LookupSocketProcess finds the process owning a socket in the socket table, given the packet's tuple in both directions and its local port.
+// The resolver is never asked and no lock is taken, so capture goroutines never wait: the flows of sockets not found are held in the pending table,
+// and resolved by ResolveSocketProcess.
+func (m *Meter) LookupSocketProcess(key, invertedKey SocketConnectionTuple, localPort SocketLocalPort) (SocketConnectionProcess, bool) {
+	state := m.sockets.state.Load()
+
+	if connection, ok := state.connections2pid[key]; ok {
+		return connection, true
+	} else if connection, ok := state.connections2pid[invertedKey]; ok {
+		return connection, true
+	}
+
+	// Fall back to the local port for unconnected UDP sockets
+	connection, ok := state.ports2pid[localPort]
+	return connection, ok
+}
+
+// LookupSocketDirection finds the process owning a socket of a packet whose direction the local addresses cannot tell, such as between two local addresses.
+// The packet is an upload if it is sent by the socket found, that is if the socket matches 'key', the packet's tuple as seen from its source.
+// Both ends of a connection between two local sockets are found, so their packets are attributed to their sender.
+// As LookupSocketProcess, only the socket table is searched; ResolveSocketDirection also asks the resolver.
+func (m *Meter) LookupSocketDirection(key, invertedKey SocketConnectionTuple) (connection SocketConnectionProcess, isUpload bool, ok bool) {
+	state := m.sockets.state.Load()
+
+	if connection, ok = state.connections2pid[key]; ok {
+		return connection, true, true
+	} else if connection, ok = state.connections2pid[invertedKey]; ok {
+		return connection, false, true
+	}
+
+	// Fall back to the local ports for unconnected UDP sockets
+	if connection, ok = state.ports2pid[SocketLocalPort{Protocol: key.Protocol, Local_Port: key.Local_Port}]; ok {
+		return connection, true, true
+	}
+	connection, ok = state.ports2pid[SocketLocalPort{Protocol: invertedKey.Protocol, Local_Port: invertedKey.Local_Port}]
+	return connection, false, ok
+}
+
+// ResolveSocketProcess finds the process owning the socket of a pending flow, as LookupSocketProcess does, asking the meter's resolver
+// about the tuples not found in connections2pid before falling back to the local port. Sockets found by the resolver are added to 'resolved',
+// to be added to the socket table at once by SocketTable.AddConnections.
+func (m *Meter) ResolveSocketProcess(key, invertedKey SocketConnectionTuple, localPort SocketLocalPort, resolved map[SocketConnectionTuple]SocketConnectionProcess) (SocketConnectionProcess, bool) {
+	if connection, _, ok := m.lookupConnection(key, invertedKey, resolved); ok {
+		return connection, true
+	}
+
+	// Ask the resolver about this socket, unless it failed to find it recently
+	if connection, ok := m.resolveSocket(key, resolved); ok {
+		return connection, true
+	} else if connection, ok := m.resolveSocket(invertedKey, resolved); ok {
+		return connection, true
+	}
+
+	return m.LookupSocketProcess(key, invertedKey, localPort)
+}
+
+// ResolveSocketDirection finds the process owning the socket of a pending flow whose direction was not found, as LookupSocketDirection does,
+// asking the meter's resolver about the tuples not found in connections2pid before falling back to the local ports. Sockets found are added to 'resolved'.
+func (m *Meter) ResolveSocketDirection(key, invertedKey SocketConnectionTuple, resolved map[SocketConnectionTuple]SocketConnectionProcess) (connection SocketConnectionProcess, isUpload bool, ok bool) {
+	if connection, isUpload, ok = m.lookupConnection(key, invertedKey, resolved); ok {
+		return connection, isUpload, true
+	}
+
+	// Ask the resolver about this socket, unless it failed to find it recently
+	if connection, ok = m.resolveSocket(key, resolved); ok {
+		return connection, true, true
+	} else if connection, ok = m.resolveSocket(invertedKey, resolved); ok {
+		return connection, false, true
+	}
+
+	return m.LookupSocketDirection(key, invertedKey)
+}
+
+// lookupConnection finds a connected socket in connections2pid, or among the sockets just resolved, by either tuple. isUpload is set if it was found by 'key'.
+func (m *Meter) lookupConnection(key, invertedKey SocketConnectionTuple, resolved map[SocketConnectionTuple]SocketConnectionProcess) (connection SocketConnectionProcess, isUpload bool, ok bool) {
+	state := m.sockets.state.Load()
+
+	for _, connections := range []map[SocketConnectionTuple]SocketConnectionProcess{state.connections2pid, resolved} {
+		if connection, ok = connections[key]; ok {
+			return connection, true, true
+		} else if connection, ok = connections[invertedKey]; ok {
+			return connection, false, true
+		}
+	}
+
+	return connection, false, false
+}
+
+// resolveSocket asks the meter's resolver about a tuple, storing the result in 'resolved' if found, or in the unresolved map otherwise.
+func (m *Meter) resolveSocket(tuple SocketConnectionTuple, resolved map[SocketConnectionTuple]SocketConnectionProcess) (SocketConnectionProcess, bool) {
+	var (
+		table      = m.sockets
+		connection SocketConnectionProcess
+	)
+
+	if m.resolver == nil {
+		return connection, false
+	}
+
+	table.mutex.Lock()
+	lastAttempt, failed := table.unresolved[tuple]
+	table.mutex.Unlock()
+
+	if failed && time.Since(lastAttempt) < unresolvedTimeout {
+		return connection, false
+	}
+
+	pid, uid, ok := m.resolver.Resolve(tuple)
+	if ok {
+		var err error
+		if connection, err = m.processes.Owner(pid, uid); err != nil {
+			ok = false
+		}
+	}
+
+	if ok {
+		resolved[tuple] = connection
+		return connection, true
+	}
+
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+
+	if len(table.unresolved) >= maxUnresolved {
+		table.unresolved = make(map[SocketConnectionTuple]time.Time)
+	}
+	table.unresolved[tuple] = time.Now()
+
+	return connection, false
+}
+
+// ExpireUnresolved removes the tuples whose failed lookups are old enough to be retried.
+func (table *SocketTable) ExpireUnresolved() {
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+
+	for tuple, lastAttempt := range table.unresolved {
+		if time.Since(lastAttempt) >= unresolvedTimeout {
+			delete(table.unresolved, tuple)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+//go:build linux
+
+package meter
+
+import (
+	"encoding/binary"
+	"errors"
+	"log"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	sockDiagByFamily  = 20                     // sockDiagByFamily is the SOCK_DIAG_BY_FAMILY netlink message type
+	inetDiagNoCookie  = ^uint32(0)             // inetDiagNoCookie matches a socket regardless of its cookie
+	inetDiagReqLength = 56                     // inetDiagReqLength is the size of struct inet_diag_req_v2
+	inetDiagMsgLength = 72                     // inetDiagMsgLength is the size of struct inet_diag_msg
+	inodeScanInterval = 100 * time.Millisecond // inodeScanInterval is the minimum time between scans of /proc for socket inodes
+)
+
+// netlinkResolver resolves sockets on demand through NETLINK_SOCK_DIAG, mapping the socket's inode to its PID through /proc.
+type netlinkResolver struct {
+	mutex    sync.Mutex
+	fd       int              // fd is the netlink socket used for sock_diag queries
+	sequence uint32           // sequence is the number of the last netlink request
+	inodes   map[uint32]int32 // inodes maps socket inodes to the PID holding them
+	lastScan time.Time        // lastScan is the time /proc was last scanned for socket inodes
+}
+
+// NewSocketResolver returns the netlink resolver of this platform, or nil if NETLINK_SOCK_DIAG is unavailable.
+func NewSocketResolver() SocketResolver {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, unix.NETLINK_SOCK_DIAG)
+	if err != nil {
+		log.Println("Unable to open NETLINK_SOCK_DIAG, polling sockets only: ", err)
+		return nil
+	}
+
+	// Avoid blocking the capture goroutines should the kernel not answer
+	if err = unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &unix.Timeval{Usec: 100000}); err != nil {
+		unix.Close(fd)
+		log.Println("Unable to configure NETLINK_SOCK_DIAG, polling sockets only: ", err)
+		return nil
+	}
+
+	return &netlinkResolver{fd: fd, inodes: make(map[uint32]int32)}
+}
+
+// Resolve queries the kernel for the socket's inode, then finds the process holding it.
+func (resolver *netlinkResolver) Resolve(tuple SocketConnectionTuple) (pid int32, uid int32, ok bool) {
+	resolver.mutex.Lock()
+	defer resolver.mutex.Unlock()
+
+	inode, owner, err := resolver.querySocket(tuple)
+	if err != nil || inode == 0 {
+		return 0, 0, false
+	}
+
+	// Rescan /proc if the inode belongs to a socket opened after the last scan
+	pid, ok = resolver.inodes[inode]
+	if !ok && time.Since(resolver.lastScan) >= inodeScanInterval {
+		resolver.scanInodes()
+		pid, ok = resolver.inodes[inode]
+	}
+
+	return pid, int32(owner), ok
+}
+
+// querySocket looks up a single socket by its tuple, returning its inode and the UID owning it.
+// IPv4 tuples are also looked up as IPv4-mapped addresses, for dual-stack IPv6 sockets.
+func (resolver *netlinkResolver) querySocket(tuple SocketConnectionTuple) (inode uint32, uid uint32, err error) {
+	if tuple.Local_Address.Is4() {
+		if inode, uid, err = resolver.request(unix.AF_INET, tuple, tuple.Local_Address, tuple.Remote_Address); err == nil {
+			return inode, uid, nil
+		}
+		return resolver.request(unix.AF_INET6, tuple, netip.AddrFrom16(tuple.Local_Address.As16()), netip.AddrFrom16(tuple.Remote_Address.As16()))
+	}
+
+	return resolver.request(unix.AF_INET6, tuple, tuple.Local_Address, tuple.Remote_Address)
+}
+
+// request sends an inet_diag_req_v2 for the socket and reads the inet_diag_msg answer, returning the socket's inode and UID.
+func (resolver *netlinkResolver) request(family uint8, tuple SocketConnectionTuple, local, remote netip.Addr) (uint32, uint32, error) {
+	var (
+		request  = make([]byte, unix.SizeofNlMsghdr+inetDiagReqLength)
+		response = make([]byte, 4096)
+	)
+
+	resolver.sequence++
+
+	// struct nlmsghdr
+	binary.LittleEndian.PutUint32(request[0:4], uint32(len(request)))
+	binary.LittleEndian.PutUint16(request[4:6], sockDiagByFamily)
+	binary.LittleEndian.PutUint16(request[6:8], unix.NLM_F_REQUEST)
+	binary.LittleEndian.PutUint32(request[8:12], resolver.sequence)
+
+	// struct inet_diag_req_v2, matching sockets in any state
+	body := request[unix.SizeofNlMsghdr:]
+	body[0] = family
+	body[1] = uint8(tuple.Protocol)
+	binary.LittleEndian.PutUint32(body[4:8], ^uint32(0))
+
+	// struct inet_diag_sockid, with ports and addresses in network byte order.
+	// The kernel looks up UDP sockets with the source and destination swapped
+	localPort, remotePort := tuple.Local_Port, tuple.Remote_Port
+	if tuple.Protocol == layers.IPProtocolUDP {
+		local, remote = remote, local
+		localPort, remotePort = remotePort, localPort
+	}
+	binary.BigEndian.PutUint16(body[8:10], localPort)
+	binary.BigEndian.PutUint16(body[10:12], remotePort)
+	copy(body[12:28], local.AsSlice())
+	copy(body[28:44], remote.AsSlice())
+	binary.LittleEndian.PutUint32(body[48:52], inetDiagNoCookie)
+	binary.LittleEndian.PutUint32(body[52:56], inetDiagNoCookie)
+
+	if err := unix.Sendto(resolver.fd, request, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return 0, 0, err
+	}
+
+	for {
+		n, _, err := unix.Recvfrom(resolver.fd, response, 0)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		for offset := 0; offset+unix.SizeofNlMsghdr <= n; {
+			length := int(binary.LittleEndian.Uint32(response[offset : offset+4]))
+			messageType := binary.LittleEndian.Uint16(response[offset+4 : offset+6])
+			sequence := binary.LittleEndian.Uint32(response[offset+8 : offset+12])
+			if length < unix.SizeofNlMsghdr || offset+length > n {
+				return 0, 0, errors.New("Malformed netlink message")
+			}
+			message := response[offset+unix.SizeofNlMsghdr : offset+length]
+			offset += (length + unix.NLMSG_ALIGNTO - 1) &^ (unix.NLMSG_ALIGNTO - 1)
+
+			// Skip answers to earlier requests that timed out
+			if sequence != resolver.sequence {
+				continue
+			}
+
+			switch messageType {
+			case unix.NLMSG_ERROR:
+				return 0, 0, errors.New("Socket not found")
+			case sockDiagByFamily:
+				if len(message) < inetDiagMsgLength {
+					return 0, 0, errors.New("Malformed inet_diag_msg")
+				}
+
+				// The kernel matches either side of the tuple for some protocols; only accept the socket bound to the local port
+				if binary.BigEndian.Uint16(message[4:6]) != tuple.Local_Port {
+					return 0, 0, errors.New("Socket not found")
+				}
+
+				return binary.LittleEndian.Uint32(message[68:72]), binary.LittleEndian.Uint32(message[64:68]), nil
+			}
+		}
+	}
+}
+
+// scanInodes maps the socket inodes held by every process, reading the file descriptors in /proc/<pid>/fd.
+func (resolver *netlinkResolver) scanInodes() {
+	resolver.lastScan = time.Now()
+	resolver.inodes = make(map[uint32]int32)
+
+	processes, err := os.ReadDir("/proc")
+	if err != nil {
+		return
+	}
+
+	for _, process := range processes {
+		pid, err := strconv.ParseInt(process.Name(), 10, 32)
+		if err != nil {
+			continue
+		}
+
+		fdPath := filepath.Join("/proc", process.Name(), "fd")
+		fds, err := os.ReadDir(fdPath)
+		if err != nil {
+			continue
+		}
+
+		for _, fd := range fds {
+			// Socket file descriptors link to "socket:[<inode>]"
+			link, err := os.Readlink(filepath.Join(fdPath, fd.Name()))
+			if err != nil || !strings.HasPrefix(link, "socket:[") {
+				continue
+			}
+
+			if inode, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]"), 10, 32); err == nil {
+				resolver.inodes[uint32(inode)] = int32(pid)
+			}
+		}
+	}
+}
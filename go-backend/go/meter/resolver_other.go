@@ -0,0 +1,9 @@
+//go:build !linux
+
+package meter
+
+// NewSocketResolver returns nil, as sockets are only resolved on demand on Linux.
+// The socket scans remain the only source of the connections2pid map.
+func NewSocketResolver() SocketResolver {
+	return nil
+}
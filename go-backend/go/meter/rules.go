@@ -0,0 +1,327 @@
+package meter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Fields matched by the application rules.
+const (
+	RuleProcess = "process" // RuleProcess matches the name of the process owning the socket
+	RuleExe     = "exe"     // RuleExe matches the path of the process' executable
+	RuleHost    = "host"    // RuleHost matches the IP address of the remote host, by CIDR prefix or pattern
+)
+
+// ErrRulesNotSaved is returned by the changes of ApplicationRules when the rules file cannot be written. The rules are left unchanged.
+var ErrRulesNotSaved = errors.New("rules file not saved")
+
+// maxMatchCache limits the number of matches remembered by ApplicationRules; the cache is cleared once reached.
+const maxMatchCache = 65536
+
+// ApplicationRule maps the traffic of processes, executables or hosts to a named application and category.
+// Patterns are case-insensitive and may contain "*" wildcards; host patterns may also be CIDR prefixes, such as "10.0.0.0/8".
+type ApplicationRule struct {
+	Id          int    // Id identifies the rule in the API
+	Match       string // Match is the field matched by the rule: RuleProcess, RuleExe or RuleHost
+	Pattern     string // Pattern is the value matched, such as "zoom*", "/opt/zoom/*" or "170.114.0.0/16"
+	Application string // Application is the name the matched traffic is grouped under, such as "Zoom"
+	Category    string // Category is the category of the application, such as "Video conferencing"
+
+	expression *regexp.Regexp // expression is the compiled pattern
+	prefix     netip.Prefix   // prefix is the compiled host pattern, if it is a CIDR prefix
+}
+
+// matchKey identifies the traffic matched by ApplicationRules.Match, for caching.
+type matchKey struct {
+	processName string
+	exe         string
+	host        string
+}
+
+// matchResult stores the application and category matched by ApplicationRules.Match.
+type matchResult struct {
+	application string
+	category    string
+}
+
+// matchState stores the rules in evaluation order and the results of Match for them. It is replaced as a whole whenever the rules change,
+// so packets are matched without locking.
+type matchState struct {
+	rules []*ApplicationRule // rules stores the rules in evaluation order; neither the slice nor the rules are modified
+	cache sync.Map           // cache maps a matchKey to its matchResult
+	size  atomic.Int64       // size is the number of entries in cache
+}
+
+// ApplicationRules stores the ordered list of application rules, saved to a rules file on every change.
+// Rules are evaluated in order, and the first rule matching the traffic applies.
+type ApplicationRules struct {
+	mutex  sync.Mutex                 // mutex serializes the changes of the rules
+	path   string                     // path is the location of the rules file; rules are not saved if empty
+	nextId int                        // nextId is the Id given to the next rule added
+	state  atomic.Pointer[matchState] // state stores the current rules and their cached matches
+}
+
+// NewApplicationRules creates an empty ApplicationRules, saved to the rules file at the given path.
+func NewApplicationRules(path string) *ApplicationRules {
+	rules := &ApplicationRules{path: path, nextId: 1}
+	rules.state.Store(&matchState{rules: make([]*ApplicationRule, 0)})
+	return rules
+}
+
+// LoadApplicationRules reads the rules file at the given path. A missing file is treated as an empty list of rules.
+func LoadApplicationRules(path string) (*ApplicationRules, error) {
+	rules := NewApplicationRules(path)
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return rules, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var fileRules []ApplicationRule
+	if err = json.Unmarshal(content, &fileRules); err != nil {
+		return nil, fmt.Errorf("invalid rules file %s: %w", path, err)
+	}
+
+	loaded := make([]*ApplicationRule, 0, len(fileRules))
+	for _, rule := range fileRules {
+		if err = compileRule(&rule); err != nil {
+			return nil, fmt.Errorf("invalid rule %d in %s: %w", rule.Id, path, err)
+		}
+		if rule.Id >= rules.nextId {
+			rules.nextId = rule.Id + 1
+		}
+
+		rule := rule
+		loaded = append(loaded, &rule)
+	}
+	rules.state.Store(&matchState{rules: loaded})
+
+	return rules, nil
+}
+
+// compileRule validates a rule and compiles its pattern.
+func compileRule(rule *ApplicationRule) error {
+	if rule.Match != RuleProcess && rule.Match != RuleExe && rule.Match != RuleHost {
+		return fmt.Errorf("unknown match %q", rule.Match)
+	}
+	if rule.Pattern == "" || rule.Application == "" {
+		return errors.New("pattern and application are required")
+	}
+
+	rule.prefix = netip.Prefix{}
+	if rule.Match == RuleHost {
+		if prefix, err := netip.ParsePrefix(rule.Pattern); err == nil {
+			rule.prefix = prefix.Masked()
+		}
+	}
+
+	// Only "*" is a wildcard; every other character is matched literally
+	rule.expression = regexp.MustCompile("(?i)^" + strings.ReplaceAll(regexp.QuoteMeta(rule.Pattern), `\*`, ".*") + "$")
+
+	return nil
+}
+
+// matches reports whether the rule matches a process name, its executable, or a host.
+func (rule *ApplicationRule) matches(processName, exe, host string) bool {
+	switch rule.Match {
+	case RuleProcess:
+		return rule.expression.MatchString(processName)
+	case RuleExe:
+		return exe != "" && rule.expression.MatchString(exe)
+	default:
+		if rule.prefix.IsValid() {
+			address, err := netip.ParseAddr(host)
+			return err == nil && rule.prefix.Contains(address.Unmap())
+		}
+		return rule.expression.MatchString(host)
+	}
+}
+
+// Match returns the application and category of traffic, given the process name, the process' executable and the remote host.
+// Traffic not matched by any rule is its process' own application, without category.
+func (rules *ApplicationRules) Match(processName, exe, host string) (application, category string) {
+	var (
+		state = rules.state.Load()
+		key   = matchKey{processName: processName, exe: exe, host: host}
+	)
+
+	if cached, ok := state.cache.Load(key); ok {
+		result := cached.(matchResult)
+		return result.application, result.category
+	}
+
+	result := matchResult{application: processName}
+	for _, rule := range state.rules {
+		if rule.matches(processName, exe, host) {
+			result = matchResult{application: rule.Application, category: rule.Category}
+			break
+		}
+	}
+
+	// Clear the cache once full, by replacing the state with the same rules
+	if _, loaded := state.cache.LoadOrStore(key, result); !loaded && state.size.Add(1) >= maxMatchCache {
+		rules.state.CompareAndSwap(state, &matchState{rules: state.rules})
+	}
+
+	return result.application, result.category
+}
+
+// Rules returns a copy of the rules, in evaluation order.
+func (rules *ApplicationRules) Rules() []ApplicationRule {
+	current := rules.state.Load().rules
+
+	copies := make([]ApplicationRule, 0, len(current))
+	for _, rule := range current {
+		copies = append(copies, *rule)
+	}
+
+	return copies
+}
+
+// Add appends a rule, evaluated after the existing ones, and saves the rules file. Returns the rule with its Id.
+func (rules *ApplicationRules) Add(rule ApplicationRule) (ApplicationRule, error) {
+	if err := compileRule(&rule); err != nil {
+		return rule, err
+	}
+
+	rules.mutex.Lock()
+	defer rules.mutex.Unlock()
+
+	var (
+		current = rules.state.Load().rules
+		updated = make([]*ApplicationRule, 0, len(current)+1)
+	)
+	rule.Id = rules.nextId
+	updated = append(append(updated, current...), &rule)
+
+	if err := rules.replace(updated); err != nil {
+		return rule, err
+	}
+	rules.nextId++
+
+	return rule, nil
+}
+
+// Update replaces the rule with the given Id, keeping its position, and saves the rules file.
+func (rules *ApplicationRules) Update(id int, rule ApplicationRule) (ApplicationRule, error) {
+	if err := compileRule(&rule); err != nil {
+		return rule, err
+	}
+
+	rules.mutex.Lock()
+	defer rules.mutex.Unlock()
+
+	current := rules.state.Load().rules
+	for i, existing := range current {
+		if existing.Id == id {
+			rule.Id = id
+			updated := append([]*ApplicationRule(nil), current...)
+			updated[i] = &rule
+			return rule, rules.replace(updated)
+		}
+	}
+
+	return rule, fmt.Errorf("no rule with id %d", id)
+}
+
+// Remove deletes the rule with the given Id, and saves the rules file.
+func (rules *ApplicationRules) Remove(id int) error {
+	rules.mutex.Lock()
+	defer rules.mutex.Unlock()
+
+	current := rules.state.Load().rules
+	for i, existing := range current {
+		if existing.Id == id {
+			updated := make([]*ApplicationRule, 0, len(current)-1)
+			updated = append(append(updated, current[:i]...), current[i+1:]...)
+			return rules.replace(updated)
+		}
+	}
+
+	return fmt.Errorf("no rule with id %d", id)
+}
+
+// replace saves the updated rules to the rules file, then applies them with an empty cache.
+// The current rules are kept if the file cannot be written, so the rules in use always match the file. The caller must hold the mutex.
+func (rules *ApplicationRules) replace(updated []*ApplicationRule) error {
+	if err := rules.save(updated); err != nil {
+		return fmt.Errorf("%w: %v", ErrRulesNotSaved, err)
+	}
+
+	rules.state.Store(&matchState{rules: updated})
+
+	return nil
+}
+
+// save writes the given rules to the rules file, unless its path is empty.
+func (rules *ApplicationRules) save(updated []*ApplicationRule) error {
+	if rules.path == "" {
+		return nil
+	}
+
+	content, err := json.MarshalIndent(updated, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(rules.path), 0755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, so the rules file is never left half-written
+	temporary := rules.path + ".tmp"
+	if err = os.WriteFile(temporary, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(temporary, rules.path)
+}
+
+// MatchProcess returns the application and category of a process' traffic regardless of its host, given the process name and executable.
+// exact is false if a host rule comes before the first process or exe rule matching, as the application of the traffic then depends on its host.
+func (rules *ApplicationRules) MatchProcess(processName, exe string) (application, category string, exact bool) {
+	for _, rule := range rules.state.Load().rules {
+		if rule.Match == RuleHost {
+			return "", "", false
+		}
+		if rule.matches(processName, exe, "") {
+			return rule.Application, rule.Category, true
+		}
+	}
+
+	return processName, "", true
+}
+
+// Classify reapplies the current process and exe rules to the Applications of an ActiveProcess loaded from the database, as described by MatchProcess.
+// Hosts are not recorded by application, so traffic whose application depends on its host keeps the application it was recorded with.
+func (rules *ApplicationRules) Classify(activeProcess *ActiveProcess) {
+	classified := make(map[string]*ApplicationData, len(activeProcess.Applications))
+
+	for _, recorded := range activeProcess.Applications {
+		application, category := recorded.Application_Name, recorded.Category
+		if matched, matchedCategory, exact := rules.MatchProcess(activeProcess.Name, recorded.Exe); exact {
+			application, category = matched, matchedCategory
+		}
+
+		key := ApplicationKey(application, recorded.Exe)
+		if _, ok := classified[key]; !ok {
+			classified[key] = &ApplicationData{Application_Name: application, Category: category, Exe: recorded.Exe, Accounting: recorded.Accounting}
+		}
+
+		classified[key].Download += recorded.Download
+		classified[key].Upload += recorded.Upload
+		classified[key].Download_Packets += recorded.Download_Packets
+		classified[key].Upload_Packets += recorded.Upload_Packets
+	}
+
+	activeProcess.Applications = classified
+}
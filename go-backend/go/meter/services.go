@@ -0,0 +1,96 @@
+package meter
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/google/gopacket/layers"
+)
+
+// bundledServices maps the most common service ports to their names, for systems without a services file.
+var bundledServices = map[string]string{
+	"tcp/20": "ftp-data", "tcp/21": "ftp", "tcp/22": "ssh", "tcp/23": "telnet", "tcp/25": "smtp",
+	"tcp/53": "domain", "udp/53": "domain", "udp/67": "bootps", "udp/68": "bootpc", "udp/69": "tftp",
+	"tcp/80": "http", "udp/80": "http", "tcp/88": "kerberos", "udp/88": "kerberos", "tcp/110": "pop3",
+	"udp/123": "ntp", "tcp/135": "epmap", "udp/137": "netbios-ns", "udp/138": "netbios-dgm", "tcp/139": "netbios-ssn",
+	"tcp/143": "imap2", "udp/161": "snmp", "udp/162": "snmp-trap", "tcp/179": "bgp", "tcp/389": "ldap",
+	"tcp/443": "https", "udp/443": "https", "tcp/445": "microsoft-ds", "udp/500": "isakmp", "udp/514": "syslog",
+	"tcp/587": "submission", "tcp/636": "ldaps", "tcp/853": "domain-s", "udp/853": "domain-s", "tcp/993": "imaps",
+	"tcp/995": "pop3s", "udp/1194": "openvpn", "tcp/1433": "ms-sql-s", "udp/1900": "ssdp", "tcp/3306": "mysql",
+	"tcp/3389": "ms-wbt-server", "udp/3478": "stun", "udp/4500": "ipsec-nat-t", "tcp/5222": "xmpp-client", "udp/5353": "mdns",
+	"tcp/5432": "postgresql", "udp/5355": "llmnr", "tcp/5900": "rfb", "tcp/6379": "redis", "tcp/8080": "http-alt",
+	"tcp/8443": "https-alt", "tcp/9418": "git", "udp/51820": "wireguard",
+}
+
+// Services maps "transport/port" to a service name, from the system services file and bundledServices. It is not modified once loaded.
+type Services struct {
+	names map[string]string
+}
+
+// ProtocolName returns the name used to record traffic on a transport port, such as "tcp/443".
+func ProtocolName(protocol layers.IPProtocol, port uint16) string {
+	switch protocol {
+	case layers.IPProtocolTCP:
+		return "tcp/" + strconv.FormatUint(uint64(port), 10)
+	case layers.IPProtocolUDP:
+		return "udp/" + strconv.FormatUint(uint64(port), 10)
+	default:
+		return strings.ToLower(protocol.String()) + "/" + strconv.FormatUint(uint64(port), 10)
+	}
+}
+
+// Lookup returns the service name of a protocol recorded by ProtocolName, or an empty string if the port has none.
+func (services *Services) Lookup(protocolName string) string {
+	return services.names[protocolName]
+}
+
+// servicesPath returns the location of the system services file.
+func servicesPath() string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("SystemRoot"), "System32", "drivers", "etc", "services")
+	}
+	return "/etc/services"
+}
+
+// LoadServices reads the system services file, falling back to bundledServices for the ports it does not list.
+func LoadServices() *Services {
+	services := &Services{names: make(map[string]string)}
+
+	// Systems without a services file only use the bundled services
+	if file, err := os.Open(servicesPath()); err == nil {
+		defer file.Close()
+
+		// Lines are formatted as "<name> <port>/<transport> [aliases...] [# comment]"
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line, _, _ := strings.Cut(scanner.Text(), "#")
+			fields := strings.Fields(line)
+			if len(fields) < 2 {
+				continue
+			}
+
+			port, transport, found := strings.Cut(fields[1], "/")
+			if !found {
+				continue
+			}
+
+			// Keep the first name given to a port
+			key := strings.ToLower(transport) + "/" + port
+			if _, ok := services.names[key]; !ok {
+				services.names[key] = fields[0]
+			}
+		}
+	}
+
+	for key, name := range bundledServices {
+		if _, ok := services.names[key]; !ok {
+			services.names[key] = name
+		}
+	}
+
+	return services
+}
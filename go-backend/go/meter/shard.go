@@ -0,0 +1,211 @@
+package meter
+
+import (
+	"sync"
+
+	"github.com/google/gopacket"
+)
+
+// AggregationShard stores the traffic processed by one capture goroutine since the last merge.
+// Each goroutine aggregates into its own shard, so capturing on several interfaces is not serialized by the buffers' mutexes;
+// the shard's mutex is only contended when the meter merges the shard, once per second.
+type AggregationShard struct {
+	mutex      sync.Mutex
+	iface      string                    // iface is the name of the interface captured into the shard
+	parser     map[string]*ActiveProcess // parser stores the traffic to be merged into bufferParser
+	database   map[string]*ActiveProcess // database stores the traffic to be merged into the last map of bufferDatabase
+	captured   uint64                    // captured is the number of bytes captured since the last merge, for the CoverageMonitor
+	attributed uint64                    // attributed is the number of captured bytes attributed to a process since the last merge
+	closed     bool                      // closed is set once the interface is no longer captured; the shard is removed after its last merge
+}
+
+// AggregationShards stores the shards of the capture goroutines.
+type AggregationShards struct {
+	mutex    sync.Mutex
+	shards   []*AggregationShard
+	coverage *CoverageMonitor // coverage counts the bytes captured and attributed on each interface, as the shards are merged
+}
+
+// NewAggregationShards creates an empty AggregationShards, adding the merged bytes to the given CoverageMonitor.
+func NewAggregationShards(coverage *CoverageMonitor) *AggregationShards {
+	return &AggregationShards{coverage: coverage}
+}
+
+// newAggregationShard creates an empty shard for an interface.
+func newAggregationShard(iface string) *AggregationShard {
+	return &AggregationShard{iface: iface, parser: make(map[string]*ActiveProcess), database: make(map[string]*ActiveProcess)}
+}
+
+// Register creates the shard of a capture goroutine. Returns the shard, which must only be used by that goroutine.
+func (shards *AggregationShards) Register(iface string) *AggregationShard {
+	shard := newAggregationShard(iface)
+
+	shards.mutex.Lock()
+	defer shards.mutex.Unlock()
+
+	shards.shards = append(shards.shards, shard)
+	return shard
+}
+
+// Unregister closes the shards of an interface that is no longer captured. Their remaining traffic is kept until the next merge.
+func (shards *AggregationShards) Unregister(iface string) {
+	shards.mutex.Lock()
+	defer shards.mutex.Unlock()
+
+	for _, shard := range shards.shards {
+		if shard.iface == iface {
+			shard.mutex.Lock()
+			shard.closed = true
+			shard.mutex.Unlock()
+		}
+	}
+}
+
+// Merge moves the traffic of every shard into the parser and database maps, and removes the closed shards.
+// The captured and attributed bytes are added to the CoverageMonitor.
+func (shards *AggregationShards) Merge(activeProcessesParser, activeProcessesDatabase map[string]*ActiveProcess) {
+	shards.mutex.Lock()
+	defer shards.mutex.Unlock()
+
+	open := shards.shards[:0]
+	for _, shard := range shards.shards {
+		// Swap the shard's maps for empty ones, so the capture goroutine is only blocked for the swap
+		shard.mutex.Lock()
+		parser, database := shard.parser, shard.database
+		captured, attributed := shard.captured, shard.attributed
+		shard.parser, shard.database = make(map[string]*ActiveProcess), make(map[string]*ActiveProcess)
+		shard.captured, shard.attributed = 0, 0
+		closed := shard.closed
+		shard.mutex.Unlock()
+
+		MergeActiveProcesses(activeProcessesParser, parser)
+		MergeActiveProcesses(activeProcessesDatabase, database)
+		shards.coverage.AddBytes(shard.iface, captured, attributed)
+
+		if !closed {
+			open = append(open, shard)
+		}
+	}
+
+	// Clear the references to the removed shards
+	for i := len(open); i < len(shards.shards); i++ {
+		shards.shards[i] = nil
+	}
+	shards.shards = open
+}
+
+// ProcessPacket processes a packet captured on the shard's interface with the given meter, aggregating its traffic into the shard.
+// Returns true if the packet was attributed to a process.
+func (shard *AggregationShard) ProcessPacket(packet gopacket.Packet, meter *Meter) bool {
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	attributed := meter.ProcessPacket(packet, shard.iface, shard.parser, shard.database)
+
+	size := uint64(packet.Metadata().Length)
+	shard.captured += size
+	if attributed {
+		shard.attributed += size
+	}
+
+	return attributed
+}
+
+// SkipPacket counts an outer packet of a captured tunnel as captured and attributed, as its traffic is attributed on the tunnel interface.
+func (shard *AggregationShard) SkipPacket(packet gopacket.Packet) {
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	size := uint64(packet.Metadata().Length)
+	shard.captured += size
+	shard.attributed += size
+}
+
+// MergeActiveProcesses adds the traffic of every ActiveProcess in 'from' to the ActiveProcess with the same name in 'into'.
+// ActiveProcesses not found in 'into' are moved as they are, so 'from' must not be used afterwards.
+func MergeActiveProcesses(into, from map[string]*ActiveProcess) {
+	for name, activeProcess := range from {
+		if existing, ok := into[name]; ok {
+			MergeActiveProcess(existing, activeProcess)
+		} else {
+			into[name] = activeProcess
+		}
+	}
+}
+
+// MergeActiveProcess adds the traffic of an ActiveProcess, and of each of its maps' entries, to another ActiveProcess of the same name.
+func MergeActiveProcess(into, from *ActiveProcess) {
+	into.Upload += from.Upload
+	into.Download += from.Download
+	into.Upload_Packets += from.Upload_Packets
+	into.Download_Packets += from.Download_Packets
+	if from.Update_Time > into.Update_Time {
+		into.Update_Time = from.Update_Time
+	}
+
+	for key, process := range from.Processes {
+		if existing, ok := into.Processes[key]; ok {
+			existing.Upload += process.Upload
+			existing.Download += process.Download
+			existing.Upload_Packets += process.Upload_Packets
+			existing.Download_Packets += process.Download_Packets
+		} else {
+			into.Processes[key] = process
+		}
+	}
+
+	for key, protocol := range from.Protocols {
+		if existing, ok := into.Protocols[key]; ok {
+			existing.Upload += protocol.Upload
+			existing.Download += protocol.Download
+			existing.Upload_Packets += protocol.Upload_Packets
+			existing.Download_Packets += protocol.Download_Packets
+		} else {
+			into.Protocols[key] = protocol
+		}
+	}
+
+	for key, host := range from.Hosts {
+		if existing, ok := into.Hosts[key]; ok {
+			existing.Upload += host.Upload
+			existing.Download += host.Download
+			existing.Upload_Packets += host.Upload_Packets
+			existing.Download_Packets += host.Download_Packets
+		} else {
+			into.Hosts[key] = host
+		}
+	}
+
+	for key, user := range from.Users {
+		if existing, ok := into.Users[key]; ok {
+			existing.Upload += user.Upload
+			existing.Download += user.Download
+			existing.Upload_Packets += user.Upload_Packets
+			existing.Download_Packets += user.Download_Packets
+		} else {
+			into.Users[key] = user
+		}
+	}
+
+	for key, cgroup := range from.Cgroups {
+		if existing, ok := into.Cgroups[key]; ok {
+			existing.Upload += cgroup.Upload
+			existing.Download += cgroup.Download
+			existing.Upload_Packets += cgroup.Upload_Packets
+			existing.Download_Packets += cgroup.Download_Packets
+		} else {
+			into.Cgroups[key] = cgroup
+		}
+	}
+
+	for key, application := range from.Applications {
+		if existing, ok := into.Applications[key]; ok {
+			existing.Upload += application.Upload
+			existing.Download += application.Download
+			existing.Upload_Packets += application.Upload_Packets
+			existing.Download_Packets += application.Download_Packets
+		} else {
+			into.Applications[key] = application
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package meter
+
+import (
+	"net"
+	"net/netip"
+	"sync"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// benchmarkFlows is the number of TCP connections the benchmark packets are spread over.
+const benchmarkFlows = 64
+
+var (
+	benchmarkLocal  = netip.MustParseAddr("192.168.1.10")
+	benchmarkRemote = netip.MustParseAddr("93.184.216.34")
+)
+
+// setupBenchmark creates a meter whose socket table holds the benchmark connections, and returns their packets and the meter.
+// Half the packets are uploads and half downloads, each carrying 1000 bytes of payload.
+func setupBenchmark(b *testing.B) ([]gopacket.Packet, *Meter) {
+	config := DefaultConfig()
+	config.Direction = DirectionIP
+
+	meter, err := New(config, nil, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	meter.local.state.Load().ips[benchmarkLocal] = true
+
+	var (
+		packets     = make([]gopacket.Packet, 0, 2*benchmarkFlows)
+		connections = make(map[SocketConnectionTuple]SocketConnectionProcess, benchmarkFlows)
+	)
+	for flow := 0; flow < benchmarkFlows; flow++ {
+		localPort := uint16(40000 + flow)
+		connections[SocketConnectionTuple{Protocol: layers.IPProtocolTCP, Local_Address: benchmarkLocal, Local_Port: localPort, Remote_Address: benchmarkRemote, Remote_Port: 443}] =
+			SocketConnectionProcess{name: "benchmark", pid: int32(1000 + flow%4), creationTime: 1, uid: unknownUid}
+
+		packets = append(packets,
+			benchmarkPacket(b, benchmarkLocal, benchmarkRemote, localPort, 443),
+			benchmarkPacket(b, benchmarkRemote, benchmarkLocal, 443, localPort))
+	}
+	meter.sockets.AddConnections(connections)
+
+	return packets, meter
+}
+
+// benchmarkPacket builds an Ethernet frame carrying a TCP segment between two addresses.
+func benchmarkPacket(b *testing.B, srcIP, dstIP netip.Addr, srcPort, dstPort uint16) gopacket.Packet {
+	var (
+		ethernet = &layers.Ethernet{SrcMAC: net.HardwareAddr{2, 0, 0, 0, 0, 1}, DstMAC: net.HardwareAddr{2, 0, 0, 0, 0, 2}, EthernetType: layers.EthernetTypeIPv4}
+		ip       = &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: srcIP.AsSlice(), DstIP: dstIP.AsSlice()}
+		tcp      = &layers.TCP{SrcPort: layers.TCPPort(srcPort), DstPort: layers.TCPPort(dstPort), ACK: true, Window: 65535}
+		buffer   = gopacket.NewSerializeBuffer()
+	)
+
+	tcp.SetNetworkLayerForChecksum(ip)
+	if err := gopacket.SerializeLayers(buffer, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}, ethernet, ip, tcp, gopacket.Payload(make([]byte, 1000))); err != nil {
+		b.Fatal(err)
+	}
+
+	packet := gopacket.NewPacket(buffer.Bytes(), layers.LayerTypeEthernet, gopacket.Default)
+	packet.Metadata().Length = len(buffer.Bytes())
+	packet.Metadata().CaptureLength = len(buffer.Bytes())
+
+	return packet
+}
+
+// reportPacketRate reports the number of packets processed per second, over all goroutines.
+func reportPacketRate(b *testing.B) {
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "packets/s")
+}
+
+// BenchmarkProcessPacketSharedBuffers processes packets from parallel goroutines as the capture goroutines did before aggregating into shards:
+// every packet takes both buffers' mutexes, then the full Lock of getConnectionsMutex, held from the socket lookup until the traffic is attributed.
+func BenchmarkProcessPacketSharedBuffers(b *testing.B) {
+	var (
+		packets, meter          = setupBenchmark(b)
+		bufferParserMutex       sync.RWMutex
+		bufferDatabaseMutex     sync.RWMutex
+		getConnectionsMutex     sync.RWMutex
+		activeProcessesParser   = make(map[string]*ActiveProcess)
+		activeProcessesDatabase = make(map[string]*ActiveProcess)
+	)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			bufferParserMutex.Lock()
+			bufferDatabaseMutex.Lock()
+			getConnectionsMutex.Lock()
+			meter.ProcessPacket(packets[i%len(packets)], "", activeProcessesParser, activeProcessesDatabase)
+			getConnectionsMutex.Unlock()
+			bufferParserMutex.Unlock()
+			bufferDatabaseMutex.Unlock()
+		}
+	})
+	reportPacketRate(b)
+}
+
+// BenchmarkProcessPacketShards processes packets from parallel goroutines, each aggregating into its own shard.
+// The shards are merged every 10000 packets by one of the goroutines, standing in for the tick of the meter.
+func BenchmarkProcessPacketShards(b *testing.B) {
+	var (
+		packets, meter          = setupBenchmark(b)
+		shards                  = NewAggregationShards(meter.coverage)
+		activeProcessesParser   = make(map[string]*ActiveProcess)
+		activeProcessesDatabase = make(map[string]*ActiveProcess)
+	)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		shard := shards.Register("benchmark")
+		for i := 0; pb.Next(); i++ {
+			shard.ProcessPacket(packets[i%len(packets)], meter)
+
+			if i%10000 == 9999 {
+				shards.Merge(activeProcessesParser, activeProcessesDatabase)
+			}
+		}
+	})
+	reportPacketRate(b)
+}
+
+// testActiveProcess creates an ActiveProcess with one entry in each map, each carrying the given traffic.
+func testActiveProcess(meter *Meter, updateTime int64, pid int32, host string, upload, download uint64) *ActiveProcess {
+	activeProcess := meter.CreateActiveProcess("test")
+	owner := SocketConnectionProcess{name: "test", pid: pid, creationTime: 1, uid: 1000, cgroup: "systemd/test.service"}
+	meter.UpdateActiveProcess(activeProcess, owner, host, "https", "Test", "Testing", download, upload, 1, 1)
+	activeProcess.Update_Time = updateTime
+
+	return activeProcess
+}
+
+// checkTraffic fails the test if the traffic of an entry differs from the expected one.
+func checkTraffic(t *testing.T, name string, upload, download, uploadPackets, downloadPackets, expectedUpload, expectedDownload, expectedPackets uint64) {
+	t.Helper()
+
+	if upload != expectedUpload || download != expectedDownload || uploadPackets != expectedPackets || downloadPackets != expectedPackets {
+		t.Errorf("%s: traffic %d/%d bytes, %d/%d packets, expected %d/%d bytes, %d/%d packets",
+			name, upload, download, uploadPackets, downloadPackets, expectedUpload, expectedDownload, expectedPackets, expectedPackets)
+	}
+}
+
+func TestMergeActiveProcess(t *testing.T) {
+	meter, err := New(DefaultConfig(), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	into := testActiveProcess(meter, 2000, 1, "192.0.2.1", 100, 200)
+	MergeActiveProcess(into, testActiveProcess(meter, 1000, 1, "192.0.2.1", 10, 20))
+	MergeActiveProcess(into, testActiveProcess(meter, 3000, 2, "192.0.2.2", 1, 2))
+
+	checkTraffic(t, "active process", into.Upload, into.Download, into.Upload_Packets, into.Download_Packets, 111, 222, 3)
+	if into.Update_Time != 3000 {
+		t.Errorf("Update_Time is %d, expected the latest 3000", into.Update_Time)
+	}
+
+	// Entries found in both are summed, the others are moved
+	if len(into.Processes) != 2 || len(into.Hosts) != 2 {
+		t.Fatalf("%d processes and %d hosts, expected 2 of each", len(into.Processes), len(into.Hosts))
+	}
+	process := into.Processes[ProcessInstanceKey(1, 1)]
+	checkTraffic(t, "process 1", process.Upload, process.Download, process.Upload_Packets, process.Download_Packets, 110, 220, 2)
+	process = into.Processes[ProcessInstanceKey(2, 1)]
+	checkTraffic(t, "process 2", process.Upload, process.Download, process.Upload_Packets, process.Download_Packets, 1, 2, 1)
+	host := into.Hosts["192.0.2.1"]
+	checkTraffic(t, "host 1", host.Upload, host.Download, host.Upload_Packets, host.Download_Packets, 110, 220, 2)
+	host = into.Hosts["192.0.2.2"]
+	checkTraffic(t, "host 2", host.Upload, host.Download, host.Upload_Packets, host.Download_Packets, 1, 2, 1)
+
+	protocol := into.Protocols["https"]
+	checkTraffic(t, "protocol", protocol.Upload, protocol.Download, protocol.Upload_Packets, protocol.Download_Packets, 111, 222, 3)
+	user := into.Users[1000]
+	checkTraffic(t, "user", user.Upload, user.Download, user.Upload_Packets, user.Download_Packets, 111, 222, 3)
+	cgroup := into.Cgroups["systemd/test.service"]
+	checkTraffic(t, "cgroup", cgroup.Upload, cgroup.Download, cgroup.Upload_Packets, cgroup.Download_Packets, 111, 222, 3)
+	application := into.Applications[ApplicationKey("Test", "")]
+	checkTraffic(t, "application", application.Upload, application.Download, application.Upload_Packets, application.Download_Packets, 111, 222, 3)
+}
+
+func TestAggregationShardsMerge(t *testing.T) {
+	meter, err := New(DefaultConfig(), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		shards                  = NewAggregationShards(meter.coverage)
+		eth0                    = shards.Register("eth0")
+		wlan0                   = shards.Register("wlan0")
+		activeProcessesParser   = make(map[string]*ActiveProcess)
+		activeProcessesDatabase = make(map[string]*ActiveProcess)
+	)
+
+	eth0.parser["test"] = testActiveProcess(meter, 1000, 1, "192.0.2.1", 100, 200)
+	eth0.database["test"] = testActiveProcess(meter, 1000, 1, "192.0.2.1", 100, 200)
+	wlan0.parser["test"] = testActiveProcess(meter, 2000, 1, "192.0.2.1", 10, 20)
+	wlan0.database["test"] = testActiveProcess(meter, 2000, 1, "192.0.2.1", 10, 20)
+
+	// A closed shard is merged a last time, then removed
+	shards.Unregister("wlan0")
+	shards.Merge(activeProcessesParser, activeProcessesDatabase)
+
+	for name, activeProcesses := range map[string]map[string]*ActiveProcess{"parser": activeProcessesParser, "database": activeProcessesDatabase} {
+		activeProcess, ok := activeProcesses["test"]
+		if !ok {
+			t.Fatalf("%s: ActiveProcess not merged", name)
+		}
+		checkTraffic(t, name, activeProcess.Upload, activeProcess.Download, activeProcess.Upload_Packets, activeProcess.Download_Packets, 110, 220, 2)
+		if activeProcess.Update_Time != 2000 {
+			t.Errorf("%s: Update_Time is %d, expected the latest 2000", name, activeProcess.Update_Time)
+		}
+	}
+
+	if len(shards.shards) != 1 || shards.shards[0] != eth0 {
+		t.Fatalf("%d shards left, expected the open eth0 shard", len(shards.shards))
+	}
+	if len(eth0.parser) != 0 || len(eth0.database) != 0 {
+		t.Error("the merged shard was not emptied")
+	}
+
+	// The open shard keeps aggregating into the same buffers
+	eth0.parser["test"] = testActiveProcess(meter, 3000, 2, "192.0.2.2", 1, 2)
+	shards.Merge(activeProcessesParser, activeProcessesDatabase)
+
+	activeProcess := activeProcessesParser["test"]
+	checkTraffic(t, "parser after second merge", activeProcess.Upload, activeProcess.Download, activeProcess.Upload_Packets, activeProcess.Download_Packets, 111, 222, 3)
+	if len(activeProcess.Processes) != 2 || activeProcess.Update_Time != 3000 {
+		t.Errorf("%d processes updated at %d, expected 2 updated at 3000", len(activeProcess.Processes), activeProcess.Update_Time)
+	}
+}
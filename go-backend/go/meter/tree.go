@@ -0,0 +1,110 @@
+package meter
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	ps_process "github.com/shirou/gopsutil/v3/process"
+)
+
+// Aggregation modes, selecting the name of the ActiveProcess a process' traffic is attributed to.
+const (
+	AggregateProcess     = "process"     // AggregateProcess attributes traffic to the name of the process owning the socket
+	AggregateApplication = "application" // AggregateApplication attributes traffic to the name of the process' top-level application ancestor
+)
+
+// maxAncestorDepth limits the number of parents visited by ApplicationAncestor.
+const maxAncestorDepth = 32
+
+// sharedDirectories lists the directories holding the executables of unrelated programs.
+// Processes run from these directories only share an application with processes of the same executable.
+var sharedDirectories = map[string]bool{
+	"/bin": true, "/sbin": true, "/usr/bin": true, "/usr/sbin": true, "/usr/local/bin": true, "/usr/local/sbin": true,
+	"/usr/libexec": true, "/opt/homebrew/bin": true, `c:\windows`: true, `c:\windows\system32`: true,
+}
+
+// ValidateAggregation checks if an aggregation mode is supported.
+func ValidateAggregation(mode string) error {
+	switch mode {
+	case AggregateProcess, AggregateApplication:
+		return nil
+	default:
+		return fmt.Errorf("unknown aggregation mode %q", mode)
+	}
+}
+
+// ApplicationAncestor returns the name of a process instance's top-level application ancestor, walking its parents by their stored Ppid.
+// Parents are visited while they belong to the same application, such as the main process of a browser spawning helper processes.
+// Parents not known to the table are read once and remembered, so the other processes of an application are resolved without reading them again.
+// Returns the process' own name if its parent belongs to another application, or if the executables cannot be read.
+func (table *ProcessTable) ApplicationAncestor(metadata *ProcessMetadata) string {
+	var (
+		ancestor = metadata
+		root     = applicationRoot(metadata.Exe)
+	)
+
+	// Stop at the init process, which is the parent of every application
+	for depth := 0; root != "" && ancestor.Ppid > 1 && depth < maxAncestorDepth; depth++ {
+		parent := table.parentMetadata(ancestor)
+		if parent == nil || applicationRoot(parent.Exe) != root {
+			break
+		}
+
+		ancestor = parent
+	}
+
+	return ancestor.Name
+}
+
+// parentMetadata returns the metadata of a process instance's parent, reading it if its PID is not known; nil if the parent has exited.
+// A known instance created after the child is not its parent, as its PID was reused.
+func (table *ProcessTable) parentMetadata(child *ProcessMetadata) *ProcessMetadata {
+	table.mutex.Lock()
+	parent, ok := table.processesByPid[child.Ppid]
+	table.mutex.Unlock()
+	if ok && parent.Creation_Time <= child.Creation_Time {
+		return parent
+	}
+
+	process, err := ps_process.NewProcess(child.Ppid)
+	if err != nil {
+		return nil
+	}
+
+	parent = &ProcessMetadata{Pid: child.Ppid}
+	if parent.Creation_Time, err = process.CreateTime(); err != nil || parent.Creation_Time > child.Creation_Time {
+		return nil
+	}
+	if parent.Name, err = process.Name(); err != nil {
+		return nil
+	}
+	parent.Exe, _ = process.Exe()
+	parent.Ppid, _ = process.Ppid()
+
+	table.mutex.Lock()
+	table.rememberPid(parent)
+	table.mutex.Unlock()
+
+	return parent
+}
+
+// applicationRoot returns the location an executable is installed in, shared by the executables of the same application.
+// Applications are installed in their own directory, or in a bundle on macOS; executables in shared directories are their own root.
+func applicationRoot(exe string) string {
+	if exe == "" {
+		return ""
+	}
+
+	// macOS bundles nest the helper applications inside the main one, such as "Code.app/Contents/Frameworks/Code Helper.app"
+	if i := strings.Index(exe, ".app/"); i >= 0 {
+		return exe[:i+len(".app")]
+	}
+
+	directory := filepath.Dir(exe)
+	if sharedDirectories[strings.ToLower(directory)] {
+		return exe
+	}
+
+	return directory
+}
@@ -0,0 +1,213 @@
+package meter
+
+import (
+	"net/netip"
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// ipsecNatTraversalPort is the UDP port of the IPsec packets encapsulated in UDP to traverse NAT (RFC 3948).
+const ipsecNatTraversalPort = 4500
+
+// underlayProtocols lists the IP protocols encapsulating the packets of kernel tunnels, such as IPsec and GRE.
+var underlayProtocols = map[layers.IPProtocol]bool{
+	layers.IPProtocolESP:  true,
+	layers.IPProtocolAH:   true,
+	layers.IPProtocolGRE:  true,
+	layers.IPProtocolIPv4: true,
+	layers.IPProtocolIPv6: true,
+}
+
+// TunnelEndpoint stores the addresses of the outer packets of a kernel tunnel, such as a GRE or IPsec VTI interface.
+// Either address is invalid if the tunnel accepts any address on its side.
+type TunnelEndpoint struct {
+	Local  netip.Addr
+	Remote netip.Addr
+}
+
+// matches reports whether a packet between two addresses, in either direction, is sent between the tunnel's endpoints.
+func (endpoint TunnelEndpoint) matches(srcIP, dstIP netip.Addr) bool {
+	between := func(local, remote netip.Addr) bool {
+		return (!endpoint.Local.IsValid() || endpoint.Local == local) && (!endpoint.Remote.IsValid() || endpoint.Remote == remote)
+	}
+	return (endpoint.Local.IsValid() || endpoint.Remote.IsValid()) && (between(srcIP, dstIP) || between(dstIP, srcIP))
+}
+
+// underlayState stores the captured tunnels, their endpoints and the local ports of their outer flows. It is replaced as a whole, so packets are matched without locking.
+type underlayState struct {
+	tunnels   map[string]bool            // tunnels stores the names of the captured tunnel interfaces
+	endpoints map[string]TunnelEndpoint  // endpoints stores the endpoints of the captured kernel tunnels, by tunnel
+	ports     map[SocketLocalPort]string // ports maps the local ports of the tunnels' outer flows to their tunnel
+}
+
+// TunnelUnderlay recognizes the outer packets of the captured tunnels on the other interfaces, such as the encrypted packets of a VPN on the
+// physical interface. Their inner packets are counted on the tunnel interface, so counting the outer packets would count the traffic twice.
+// Outer packets of the kernel's encapsulations, such as GRE, IP-in-IP or IPsec, are recognized by their protocol between the endpoints of a captured
+// kernel tunnel; those of the tunnels using UDP or TCP by their local port: the ports of the sockets of the processes owning a tunnel device,
+// such as OpenVPN or wireguard-go, and the listening ports of WireGuard interfaces.
+type TunnelUnderlay struct {
+	mutex   sync.Mutex                    // mutex serializes the changes of state
+	state   atomic.Pointer[underlayState] // state is nil while no tunnel is captured
+	tunnels map[string]bool               // tunnels stores the names of the captured tunnel interfaces
+}
+
+// NewTunnelUnderlay creates a TunnelUnderlay without tunnels.
+func NewTunnelUnderlay() *TunnelUnderlay {
+	return &TunnelUnderlay{tunnels: make(map[string]bool)}
+}
+
+// Register starts recognizing the outer packets of an interface, if it is a tunnel. Its endpoints are read at once, and its outer flows are found by the next Refresh.
+func (underlay *TunnelUnderlay) Register(iface NetworkInterface) {
+	if !iface.Tunnel {
+		return
+	}
+
+	underlay.mutex.Lock()
+	defer underlay.mutex.Unlock()
+
+	state := underlay.current()
+	underlay.tunnels[iface.Name] = true
+	if endpoint, ok := TunnelEndpoints([]string{iface.Name})[iface.Name]; ok {
+		state.endpoints[iface.Name] = endpoint
+	}
+	underlay.update(state.endpoints, state.ports)
+}
+
+// Unregister stops recognizing the outer packets of an interface that is no longer captured.
+func (underlay *TunnelUnderlay) Unregister(iface string) {
+	underlay.mutex.Lock()
+	defer underlay.mutex.Unlock()
+
+	if !underlay.tunnels[iface] {
+		return
+	}
+
+	state := underlay.current()
+	delete(underlay.tunnels, iface)
+	delete(state.endpoints, iface)
+	underlay.update(state.endpoints, state.ports)
+}
+
+// Refresh reads the endpoints of the captured kernel tunnels, and finds the local ports of the outer flows of the captured tunnels:
+// the sockets in the socket table of the processes owning the tunnel devices, and the listening ports of WireGuard interfaces.
+func (underlay *TunnelUnderlay) Refresh(sockets *SocketTable) {
+	underlay.mutex.Lock()
+	defer underlay.mutex.Unlock()
+
+	if len(underlay.tunnels) == 0 {
+		return
+	}
+
+	var (
+		tunnels = make([]string, 0, len(underlay.tunnels))
+		ports   = make(map[SocketLocalPort]string)
+	)
+	for tunnel := range underlay.tunnels {
+		tunnels = append(tunnels, tunnel)
+	}
+
+	for tunnel, port := range WireGuardPorts(tunnels) {
+		ports[SocketLocalPort{Protocol: layers.IPProtocolUDP, Local_Port: port}] = tunnel
+	}
+
+	if owners := TunnelOwners(tunnels); len(owners) > 0 {
+		state := sockets.state.Load()
+		for tuple, connection := range state.connections2pid {
+			if tunnel, ok := owners[connection.pid]; ok {
+				ports[SocketLocalPort{Protocol: tuple.Protocol, Local_Port: tuple.Local_Port}] = tunnel
+			}
+		}
+		for localPort, connection := range state.ports2pid {
+			if tunnel, ok := owners[connection.pid]; ok {
+				ports[localPort] = tunnel
+			}
+		}
+	}
+
+	underlay.update(TunnelEndpoints(tunnels), ports)
+}
+
+// current returns a copy of the endpoints and outer flows found by the last Register or Refresh. The caller must hold the mutex.
+func (underlay *TunnelUnderlay) current() underlayState {
+	state := underlayState{endpoints: make(map[string]TunnelEndpoint), ports: make(map[SocketLocalPort]string)}
+	if current := underlay.state.Load(); current != nil {
+		for tunnel, endpoint := range current.endpoints {
+			state.endpoints[tunnel] = endpoint
+		}
+		state.ports = current.ports
+	}
+	return state
+}
+
+// update replaces the state with the current tunnels and the given endpoints and outer flows. The caller must hold the mutex.
+func (underlay *TunnelUnderlay) update(endpoints map[string]TunnelEndpoint, ports map[SocketLocalPort]string) {
+	if len(underlay.tunnels) == 0 {
+		underlay.state.Store(nil)
+		return
+	}
+
+	state := &underlayState{tunnels: make(map[string]bool, len(underlay.tunnels)), endpoints: endpoints, ports: ports}
+	for tunnel := range underlay.tunnels {
+		state.tunnels[tunnel] = true
+	}
+	underlay.state.Store(state)
+}
+
+// Outer reports whether a packet captured on an interface other than a tunnel is the outer packet of a captured tunnel.
+// Ports are only matched on the local side of the packet, according to the local addresses.
+func (underlay *TunnelUnderlay) Outer(iface string, packet gopacket.Packet, local *LocalAddresses) bool {
+	state := underlay.state.Load()
+	if state == nil || state.tunnels[iface] {
+		return false
+	}
+
+	var encapsulated bool
+	switch networkLayer := packet.NetworkLayer().(type) {
+	case *layers.IPv4:
+		encapsulated = underlayProtocols[networkLayer.Protocol]
+	case *layers.IPv6:
+		encapsulated = underlayProtocols[networkLayer.NextHeader]
+	default:
+		return false
+	}
+
+	srcIP, dstIP, err := GetIPs(packet.NetworkLayer())
+	if err != nil {
+		return false
+	}
+
+	var srcPort, dstPort SocketLocalPort
+	switch transportLayer := packet.TransportLayer().(type) {
+	case *layers.UDP:
+		// IPsec encapsulated in UDP is matched as the kernel's encapsulations
+		encapsulated = encapsulated || transportLayer.SrcPort == ipsecNatTraversalPort || transportLayer.DstPort == ipsecNatTraversalPort
+		srcPort = SocketLocalPort{Protocol: layers.IPProtocolUDP, Local_Port: uint16(transportLayer.SrcPort)}
+		dstPort = SocketLocalPort{Protocol: layers.IPProtocolUDP, Local_Port: uint16(transportLayer.DstPort)}
+	case *layers.TCP:
+		srcPort = SocketLocalPort{Protocol: layers.IPProtocolTCP, Local_Port: uint16(transportLayer.SrcPort)}
+		dstPort = SocketLocalPort{Protocol: layers.IPProtocolTCP, Local_Port: uint16(transportLayer.DstPort)}
+	}
+
+	// Encapsulated packets belong to a captured tunnel only if sent between its endpoints, so unrelated tunnels are counted
+	if encapsulated {
+		for _, endpoint := range state.endpoints {
+			if endpoint.matches(srcIP, dstIP) {
+				return true
+			}
+		}
+	}
+
+	if len(state.ports) == 0 || srcPort.Protocol == 0 {
+		return false
+	}
+
+	// The packet's source port is local if it is sent by this machine, and its destination port otherwise
+	if _, ok := state.ports[srcPort]; ok && local.IsLocal(srcIP) {
+		return true
+	}
+	_, ok := state.ports[dstPort]
+	return ok && local.IsLocal(dstIP)
+}
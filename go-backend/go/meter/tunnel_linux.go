@@ -0,0 +1,289 @@
+//go:build linux
+
+package meter
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	tunDevice          = "/dev/net/tun" // tunDevice is the device file held by the processes owning a TUN or TAP interface
+	genlMsghdrLength   = 4              // genlMsghdrLength is the size of struct genlmsghdr
+	genlControlVersion = 2              // genlControlVersion is the version of the generic netlink controller
+)
+
+// Attributes of the endpoints of kernel tunnels, nested in IFLA_INFO_DATA, from linux/if_tunnel.h.
+const (
+	iflaIptunLocal  = 2 // iflaIptunLocal is IFLA_IPTUN_LOCAL, of ipip, sit and ip6tnl interfaces
+	iflaIptunRemote = 3 // iflaIptunRemote is IFLA_IPTUN_REMOTE
+	iflaGreLocal    = 6 // iflaGreLocal is IFLA_GRE_LOCAL, of GRE and ERSPAN interfaces
+	iflaGreRemote   = 7 // iflaGreRemote is IFLA_GRE_REMOTE
+	iflaVtiLocal    = 4 // iflaVtiLocal is IFLA_VTI_LOCAL, of IPsec VTI interfaces
+	iflaVtiRemote   = 5 // iflaVtiRemote is IFLA_VTI_REMOTE
+)
+
+// tunnelEndpointAttributes maps the kinds of kernel tunnels to the attributes of their local and remote endpoints.
+var tunnelEndpointAttributes = map[string][2]uint16{
+	"ipip": {iflaIptunLocal, iflaIptunRemote}, "sit": {iflaIptunLocal, iflaIptunRemote}, "ip6tnl": {iflaIptunLocal, iflaIptunRemote},
+	"gre": {iflaGreLocal, iflaGreRemote}, "gretap": {iflaGreLocal, iflaGreRemote}, "erspan": {iflaGreLocal, iflaGreRemote},
+	"ip6gre": {iflaGreLocal, iflaGreRemote}, "ip6gretap": {iflaGreLocal, iflaGreRemote}, "ip6erspan": {iflaGreLocal, iflaGreRemote},
+	"vti": {iflaVtiLocal, iflaVtiRemote}, "vti6": {iflaVtiLocal, iflaVtiRemote},
+}
+
+// TunnelOwners returns the processes owning the given tunnel interfaces, mapped to their tunnel, such as the OpenVPN or wireguard-go process of a VPN.
+// The interface of a process' /dev/net/tun file descriptor is read from the "iff" line of its /proc/<pid>/fdinfo.
+func TunnelOwners(tunnels []string) map[int32]string {
+	var (
+		owners = make(map[int32]string)
+		wanted = make(map[string]bool)
+	)
+
+	for _, tunnel := range tunnels {
+		wanted[tunnel] = true
+	}
+
+	processes, err := os.ReadDir("/proc")
+	if err != nil {
+		return owners
+	}
+
+	for _, process := range processes {
+		pid, err := strconv.ParseInt(process.Name(), 10, 32)
+		if err != nil {
+			continue
+		}
+
+		fdPath := filepath.Join("/proc", process.Name(), "fd")
+		fds, err := os.ReadDir(fdPath)
+		if err != nil {
+			continue
+		}
+
+		for _, fd := range fds {
+			if link, err := os.Readlink(filepath.Join(fdPath, fd.Name())); err != nil || link != tunDevice {
+				continue
+			}
+
+			if tunnel := readTunInterface(filepath.Join("/proc", process.Name(), "fdinfo", fd.Name())); wanted[tunnel] {
+				owners[int32(pid)] = tunnel
+			}
+		}
+	}
+
+	return owners
+}
+
+// readTunInterface returns the interface attached to a /dev/net/tun file descriptor, given the path of its fdinfo; empty if it has none.
+func readTunInterface(path string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if name, ok := strings.CutPrefix(scanner.Text(), "iff:"); ok {
+			return strings.TrimSpace(name)
+		}
+	}
+
+	return ""
+}
+
+// WireGuardPorts returns the listening ports of the given tunnels that are kernel WireGuard interfaces, queried through generic netlink.
+// Other tunnels, and every tunnel if the WireGuard module is not loaded, are left out.
+func WireGuardPorts(tunnels []string) map[string]uint16 {
+	ports := make(map[string]uint16)
+
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, unix.NETLINK_GENERIC)
+	if err != nil {
+		return ports
+	}
+	defer unix.Close(fd)
+
+	if err = unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &unix.Timeval{Usec: 100000}); err != nil {
+		return ports
+	}
+
+	// Find the id of the WireGuard family, which only exists once the module is loaded
+	messages, err := genlRequest(fd, unix.GENL_ID_CTRL, unix.CTRL_CMD_GETFAMILY, genlControlVersion, 0, netlinkAttribute(unix.CTRL_ATTR_FAMILY_NAME, []byte(unix.WG_GENL_NAME+"\x00")))
+	if err != nil || len(messages) == 0 {
+		return ports
+	}
+	family, ok := parseNetlinkAttributes(messages[0])[unix.CTRL_ATTR_FAMILY_ID]
+	if !ok || len(family) < 2 {
+		return ports
+	}
+
+	for _, tunnel := range tunnels {
+		// Interfaces of other kinds are answered with an error
+		messages, err := genlRequest(fd, binary.LittleEndian.Uint16(family), unix.WG_CMD_GET_DEVICE, unix.WG_GENL_VERSION, unix.NLM_F_DUMP, netlinkAttribute(unix.WGDEVICE_A_IFNAME, []byte(tunnel+"\x00")))
+		if err != nil {
+			continue
+		}
+
+		for _, message := range messages {
+			if port, ok := parseNetlinkAttributes(message)[unix.WGDEVICE_A_LISTEN_PORT]; ok && len(port) >= 2 && binary.LittleEndian.Uint16(port) != 0 {
+				ports[tunnel] = binary.LittleEndian.Uint16(port)
+			}
+		}
+	}
+
+	return ports
+}
+
+// TunnelEndpoints returns the endpoints of the given tunnels that are kernel tunnels carrying IP packets in IP, such as GRE, IP-in-IP or IPsec VTI
+// interfaces, queried through rtnetlink. Other tunnels, such as TUN devices and WireGuard interfaces, are left out.
+func TunnelEndpoints(tunnels []string) map[string]TunnelEndpoint {
+	endpoints := make(map[string]TunnelEndpoint)
+
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, unix.NETLINK_ROUTE)
+	if err != nil {
+		return endpoints
+	}
+	defer unix.Close(fd)
+
+	if err = unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &unix.Timeval{Usec: 100000}); err != nil {
+		return endpoints
+	}
+
+	for _, tunnel := range tunnels {
+		// The answer is a single RTM_NEWLINK message, starting with its struct ifinfomsg
+		messages, err := netlinkRequest(fd, unix.RTM_GETLINK, 0, make([]byte, unix.SizeofIfInfomsg), netlinkAttribute(unix.IFLA_IFNAME, []byte(tunnel+"\x00")))
+		if err != nil || len(messages) == 0 {
+			continue
+		}
+
+		linkInfo := parseNetlinkAttributes(parseNetlinkAttributes(messages[0])[unix.IFLA_LINKINFO])
+		attributes, ok := tunnelEndpointAttributes[strings.TrimRight(string(linkInfo[unix.IFLA_INFO_KIND]), "\x00")]
+		if !ok {
+			continue
+		}
+
+		data := parseNetlinkAttributes(linkInfo[unix.IFLA_INFO_DATA])
+		endpoint := TunnelEndpoint{Local: endpointAddress(data[attributes[0]]), Remote: endpointAddress(data[attributes[1]])}
+		if endpoint.Local.IsValid() || endpoint.Remote.IsValid() {
+			endpoints[tunnel] = endpoint
+		}
+	}
+
+	return endpoints
+}
+
+// endpointAddress returns the address of a tunnel endpoint attribute, or an invalid address if it is missing or unspecified, accepting any address.
+func endpointAddress(value []byte) netip.Addr {
+	address, ok := netip.AddrFromSlice(value)
+	if !ok || address.IsUnspecified() {
+		return netip.Addr{}
+	}
+	return address.Unmap()
+}
+
+// genlRequest sends a generic netlink request with the given attributes, and returns the attributes of every message of the answer.
+func genlRequest(fd int, family uint16, command uint8, version uint8, flags uint16, attributes []byte) ([][]byte, error) {
+	// struct genlmsghdr
+	header := make([]byte, genlMsghdrLength)
+	header[0] = command
+	header[1] = version
+
+	return netlinkRequest(fd, family, flags, header, attributes)
+}
+
+// netlinkRequest sends a netlink request made of the family's header and the given attributes, and returns the attributes of every message
+// of the answer, following the header.
+func netlinkRequest(fd int, messageType uint16, flags uint16, header []byte, attributes []byte) ([][]byte, error) {
+	var (
+		request  = make([]byte, unix.SizeofNlMsghdr, unix.SizeofNlMsghdr+len(header)+len(attributes))
+		response = make([]byte, 16384)
+		messages = make([][]byte, 0)
+	)
+
+	// struct nlmsghdr, followed by the family's header
+	request = append(append(request, header...), attributes...)
+	binary.LittleEndian.PutUint32(request[0:4], uint32(len(request)))
+	binary.LittleEndian.PutUint16(request[4:6], messageType)
+	binary.LittleEndian.PutUint16(request[6:8], unix.NLM_F_REQUEST|flags)
+	binary.LittleEndian.PutUint32(request[8:12], 1)
+
+	if err := unix.Sendto(fd, request, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return nil, err
+	}
+
+	for {
+		n, _, err := unix.Recvfrom(fd, response, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		for offset := 0; offset+unix.SizeofNlMsghdr <= n; {
+			length := int(binary.LittleEndian.Uint32(response[offset : offset+4]))
+			messageType := binary.LittleEndian.Uint16(response[offset+4 : offset+6])
+			if length < unix.SizeofNlMsghdr || offset+length > n {
+				return nil, errors.New("Malformed netlink message")
+			}
+			message := response[offset+unix.SizeofNlMsghdr : offset+length]
+			offset += (length + unix.NLMSG_ALIGNTO - 1) &^ (unix.NLMSG_ALIGNTO - 1)
+
+			switch messageType {
+			case unix.NLMSG_DONE:
+				return messages, nil
+			case unix.NLMSG_ERROR:
+				if len(message) >= 4 && int32(binary.LittleEndian.Uint32(message[0:4])) != 0 {
+					return nil, syscall.Errno(-int32(binary.LittleEndian.Uint32(message[0:4])))
+				}
+				return messages, nil
+			default:
+				if len(message) >= len(header) {
+					messages = append(messages, message[len(header):])
+				}
+			}
+		}
+
+		// Answers to requests without NLM_F_DUMP are a single message
+		if flags&unix.NLM_F_DUMP == 0 {
+			return messages, nil
+		}
+	}
+}
+
+// netlinkAttribute encodes a netlink attribute, padded to the netlink alignment.
+func netlinkAttribute(attributeType uint16, value []byte) []byte {
+	attribute := make([]byte, (unix.SizeofNlAttr+len(value)+unix.NLA_ALIGNTO-1)&^(unix.NLA_ALIGNTO-1))
+	binary.LittleEndian.PutUint16(attribute[0:2], uint16(unix.SizeofNlAttr+len(value)))
+	binary.LittleEndian.PutUint16(attribute[2:4], attributeType)
+	copy(attribute[unix.SizeofNlAttr:], value)
+	return attribute
+}
+
+// parseNetlinkAttributes returns the values of the attributes of a netlink message by type, ignoring the nested flag.
+func parseNetlinkAttributes(data []byte) map[uint16][]byte {
+	attributes := make(map[uint16][]byte)
+
+	for len(data) >= unix.SizeofNlAttr {
+		length := int(binary.LittleEndian.Uint16(data[0:2]))
+		if length < unix.SizeofNlAttr || length > len(data) {
+			break
+		}
+
+		attributes[binary.LittleEndian.Uint16(data[2:4])&^unix.NLA_F_NESTED] = data[unix.SizeofNlAttr:length]
+
+		aligned := (length + unix.NLA_ALIGNTO - 1) &^ (unix.NLA_ALIGNTO - 1)
+		if aligned > len(data) {
+			break
+		}
+		data = data[aligned:]
+	}
+
+	return attributes
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package meter
+
+// TunnelOwners returns no processes, as the owners of tunnel devices are only found on Linux.
+func TunnelOwners(tunnels []string) map[int32]string {
+	return make(map[int32]string)
+}
+
+// WireGuardPorts returns no ports, as WireGuard interfaces are only queried on Linux.
+func WireGuardPorts(tunnels []string) map[string]uint16 {
+	return make(map[string]uint16)
+}
+
+// TunnelEndpoints returns no endpoints, as kernel tunnels are only queried on Linux.
+func TunnelEndpoints(tunnels []string) map[string]TunnelEndpoint {
+	return make(map[string]TunnelEndpoint)
+}
@@ -0,0 +1,43 @@
+package meter
+
+import (
+	"os/user"
+	"strconv"
+
+	ps_net "github.com/shirou/gopsutil/v3/net"
+)
+
+// unknownUid marks traffic whose socket owner is unknown, such as the traffic of pseudo-processes or of platforms without UIDs.
+const unknownUid int32 = -1
+
+// SocketOwner returns the UID owning a socket found by gopsutil, which is the effective UID of its process.
+// Returns unknownUid on platforms where gopsutil does not report UIDs.
+func SocketOwner(conn ps_net.ConnectionStat) int32 {
+	// Linux reports the real, effective, saved and filesystem UIDs
+	switch {
+	case len(conn.Uids) > 1:
+		return conn.Uids[1]
+	case len(conn.Uids) == 1:
+		return conn.Uids[0]
+	default:
+		return unknownUid
+	}
+}
+
+// Username returns the name of a user given its UID, or the UID itself if the user has no name.
+func (table *ProcessTable) Username(uid int32) string {
+	table.usernamesMutex.Lock()
+	defer table.usernamesMutex.Unlock()
+
+	if username, ok := table.usernames[uid]; ok {
+		return username
+	}
+
+	username := strconv.FormatInt(int64(uid), 10)
+	if account, err := user.LookupId(username); err == nil {
+		username = account.Username
+	}
+	table.usernames[uid] = username
+
+	return username
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Viasat/Viasat-NetworkTrafficMeter/meter"
+)
+
+// PrintCaptureSummary prints the totals of a capture file analysis, followed by the traffic of each ActiveProcess.
+func PrintCaptureSummary(summary *meter.CaptureSummary) {
+	var (
+		activeProcesses            = make([]*meter.ActiveProcess, 0, len(summary.Active_Processes))
+		totalUpload, totalDownload uint64
+	)
+
+	for _, activeProcess := range summary.Active_Processes {
+		activeProcesses = append(activeProcesses, activeProcess)
+		totalUpload += activeProcess.Upload
+		totalDownload += activeProcess.Download
+	}
+
+	// Show the processes with the most traffic first
+	sort.Slice(activeProcesses, func(i, j int) bool {
+		return activeProcesses[i].Upload+activeProcesses[i].Download > activeProcesses[j].Upload+activeProcesses[j].Download
+	})
+
+	fmt.Println("File:", summary.File)
+	if summary.Packets > 0 {
+		fmt.Printf("Duration: %s (%s - %s)\n", summary.Last_Packet.Sub(summary.First_Packet), summary.First_Packet.Format(time.RFC3339), summary.Last_Packet.Format(time.RFC3339))
+	}
+	fmt.Printf("Packets: %d read, %d attributed to processes\n", summary.Packets, summary.Attributed)
+	fmt.Printf("Total: %d bytes uploaded, %d bytes downloaded (%s accounting)\n", totalUpload, totalDownload, summary.Accounting)
+
+	for _, activeProcess := range activeProcesses {
+		fmt.Printf("\n%s: %d bytes uploaded, %d bytes downloaded (%d / %d packets)\n", activeProcess.Name, activeProcess.Upload, activeProcess.Download, activeProcess.Upload_Packets, activeProcess.Download_Packets)
+		for _, process := range activeProcess.Processes {
+			fmt.Printf("  PID %d (created %d): %d up / %d down\n", process.Pid, process.Creation_Time, process.Upload, process.Download)
+		}
+		for _, protocol := range activeProcess.Protocols {
+			fmt.Printf("  Protocol %s %s: %d up / %d down\n", protocol.Protocol_Name, protocol.Service, protocol.Upload, protocol.Download)
+		}
+		for _, host := range activeProcess.Hosts {
+			fmt.Printf("  Host %s: %d up / %d down\n", host.Host_Name, host.Upload, host.Download)
+		}
+		for _, user := range activeProcess.Users {
+			fmt.Printf("  User %s (%d): %d up / %d down\n", user.Username, user.Uid, user.Upload, user.Download)
+		}
+		for _, cgroup := range activeProcess.Cgroups {
+			fmt.Printf("  Cgroup %s: %d up / %d down\n", cgroup.Cgroup_Name, cgroup.Upload, cgroup.Download)
+		}
+		for _, application := range activeProcess.Applications {
+			fmt.Printf("  Application %s [%s]: %d up / %d down\n", application.Application_Name, application.Category, application.Upload, application.Download)
+		}
+	}
+}
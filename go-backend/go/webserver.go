@@ -3,158 +3,53 @@ package main
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
-	"sync"
 
+	"github.com/Viasat/Viasat-NetworkTrafficMeter/meter"
 	"github.com/gin-gonic/gin"
 	"nhooyr.io/websocket"
 )
 
-var (
-	jsonData chan []byte = make(chan []byte) // Channel used to send the JSON data to the websocket server
-)
-
 // GetDevices returns a list of all network interfaces
 func GetDevices(c *gin.Context) {
-	if ifaces, err := GetInterfaceList(); err != nil {
+	if ifaces, err := meter.GetInterfaceList(); err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Unable to retrieve interfaces"})
 	} else {
 		c.JSON(http.StatusOK, ifaces)
 	}
 }
 
-// ParseActiveProcesses parse the activeProcesses data to JSON and sends it to the Websocket server.
-func ParseActiveProcesses(activeProcessesChan <-chan map[string]*ActiveProcess) {
-	for {
-		// Encode the activeProcesses map to JSON, and log any errors
-		if jsonStr, err := json.Marshal(<-activeProcessesChan); err != nil {
-			log.Println(err.Error())
-		} else {
-			// Send the data when jsonData channel is available / when web socket is ready to receive
-			select {
-			case jsonData <- jsonStr:
-			default:
-			}
-		}
-	}
-}
-
-// WebsocketHandler opens the Websocket Server, waits for a connection and sends the 'jsonData' to the client
-// FIXME: Use InsecureSkipVerify ONLY for debugging. Use OriginPatterns in the future to safely accept cross origin websockets
-func WebsocketHandlerLegacy(w http.ResponseWriter, r *http.Request) {
-
-	conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{
-		InsecureSkipVerify: true,
-	})
-	if err != nil {
-		log.Printf("Error: %v", err)
-		return
-	}
-
-	log.Printf("Connected to Websocket client")
-
-	defer conn.Close(websocket.StatusInternalError, "Internal Server Error")
-
-	for {
-
-		data := <-jsonData
-
-		if err := conn.Write(r.Context(), websocket.MessageText, data); err != nil {
-			log.Printf("Failed to send message: %v", err)
-			return
-		}
-	}
-}
-
-// StartServer initializes the Websocket handle and assigns it to port 50000
-func StartServerLegacy(ifaceName chan<- string, legacyMode *bool) {
-	var (
-		conn          *websocket.Conn
-		ifaces        []NetworkInterface
-		data          []byte
-		selectedIface NetworkInterface
-		err           error
-	)
-
-	log.Printf("Waiting for client connection on ws://localhost:50000/")
-
-	if *legacyMode {
-		http.HandleFunc("/", WebsocketHandlerLegacy)
-	} else {
-		http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-			// Upgrades the HTTP connection to a WS connection
-			if conn, err = websocket.Accept(w, r, &websocket.AcceptOptions{InsecureSkipVerify: true}); err != nil {
-				log.Fatal(err)
-			}
-
-			defer conn.Close(websocket.StatusInternalError, "Internal Server Error")
-
-			log.Printf("Connected to Websocket client")
-
-			// Get the list of available network interfaces
-			if ifaces, err = GetInterfaceList(); err != nil {
-				log.Fatal(err)
-			}
-
-			// Parse the list to JSON
-			if data, err = json.Marshal(ifaces); err != nil {
-				log.Fatal(err)
-			}
-
-			// Send the list to the client
-			if err = conn.Write(r.Context(), websocket.MessageText, data); err != nil {
-				log.Fatal(err)
-			}
-
-			// Wait for client response
-			if _, data, err := conn.Read(r.Context()); err != nil {
-				log.Fatal(err)
-			} else {
-				if err = json.Unmarshal(data, &selectedIface); err != nil {
-					log.Fatal(err)
-				}
-			}
-
-			// Send the selected interface to main to open the pcap handle
-			ifaceName <- selectedIface.Name
-
-			// Send the network traffic to client
-			for {
-				data := <-jsonData
-				if err := conn.Write(r.Context(), websocket.MessageText, data); err != nil {
-					log.Printf("Failed to send message: %v", err)
-					return
-				}
-			}
-		})
-	}
-
-	http.ListenAndServe(":50000", nil)
-}
-
-// StartWebserver initializes the Gin webserver on port 50000.
+// StartWebserver initializes the Gin webserver on the given address.
 // It updates the "networkInterfaceChan" channel with the network interface name provided from a POST request to /devices.
-func StartWebserver(db *sql.DB, bufferDatabaseMutex *sync.RWMutex, shutdownChan chan bool) {
+// The application rules are served and changed by the /rules endpoints, and applied to the application queries.
+func StartWebserver(db *sql.DB, trafficMeter *meter.Meter, rules *meter.ApplicationRules, shutdownChan chan bool, listenAddress string, verbose bool) {
 	var (
-		conn *websocket.Conn // conn represents a Websocket connection
-		err  error           // err handles any function errors
+		err error // err handles any function errors
 
 		initialDateInt, endDateInt int64 // Variables for storing the data value as int
 	)
 
-	// Initialize the Gin engine with default options.
-	// TODO: The default option for Gin is a debug version. Adjust accordingly to deploy for production.
+	// Initialize the Gin engine with default options, using the debug version only in verbose mode.
+	if !verbose {
+		gin.SetMode(gin.ReleaseMode)
+	}
 	router := gin.Default()
 
+	// Match the escaped path, so protocol names such as "tcp/443" can be given as "tcp%2F443"
+	router.UseRawPath = true
+
 	// Set the router's endpoints
 	router.GET("/devices", GetDevices)             // Returns a list of all network interfaces
 
 	router.GET("/ws", func(c *gin.Context) { // Websocket for supplying the client with current connections
 		// Upgrades the HTTP connection to a WS connection
-		if conn, err = websocket.Accept(c.Writer, c.Request, &websocket.AcceptOptions{InsecureSkipVerify: true}); err != nil {
-			log.Fatal(err)
+		conn, err := websocket.Accept(c.Writer, c.Request, &websocket.AcceptOptions{InsecureSkipVerify: true})
+		if err != nil {
+			log.Println(err)
+			return
 		}
 
 		// Ensure the connection is closed should any errors occur
@@ -162,9 +57,26 @@ func StartWebserver(db *sql.DB, bufferDatabaseMutex *sync.RWMutex, shutdownChan
 
 		log.Printf("Connected to Websocket")
 
+		// Clients may ask for the coverage of the interfaces, sent along with the active processes
+		withCoverage := c.Query("coverage") == "1" || c.Query("coverage") == "true"
+
+		// Receive the active processes of every second, until the client disconnects or the meter is stopped
+		snapshots := trafficMeter.Subscribe()
+		defer trafficMeter.Unsubscribe(snapshots)
+
 		// Send data to the client
-		for {
-			data := <-jsonData
+		for snapshot := range snapshots {
+			var data []byte
+			if withCoverage {
+				data, err = json.Marshal(gin.H{"active_processes": snapshot.Active_Processes, "coverage": trafficMeter.Coverage()})
+			} else {
+				data, err = json.Marshal(snapshot.Active_Processes)
+			}
+			if err != nil {
+				log.Println(err.Error())
+				continue
+			}
+
 			if err := conn.Write(c, websocket.MessageText, data); err != nil {
 				log.Printf("Failed to send message: %v", err)
 				return
@@ -174,7 +86,14 @@ func StartWebserver(db *sql.DB, bufferDatabaseMutex *sync.RWMutex, shutdownChan
 	})
 
 	router.GET("/statistics", func(c *gin.Context) { // Get total network throughput from the database, or within a timeframe
-		SaveBufferToDatabase(db, bufferDatabaseMutex)
+		trafficMeter.Flush()
+		// Get the accounting mode of the statistics from query parameters
+		accounting, err := accountingMode(c, trafficMeter)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for accounting"})
+			return
+		}
+
 		// Get the dates in Unix Epoch from query parameters
 		initialDate := c.DefaultQuery("initialDate", "")
 		endDate := c.DefaultQuery("endDate", "")
@@ -193,14 +112,14 @@ func StartWebserver(db *sql.DB, bufferDatabaseMutex *sync.RWMutex, shutdownChan
 			}
 
 			// Get all active processes by time
-			if data, err := GetTotalThroughputByTime(db, initialDateInt, endDateInt); err != nil {
+			if data, err := GetTotalThroughputByTime(db, accounting, initialDateInt, endDateInt); err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "No data available"})
 			} else {
 				c.JSON(http.StatusOK, data)
 			}
 		} else {
 			// Get all active processes
-			if data, err := GetTotalThroughput(db); err != nil {
+			if data, err := GetTotalThroughput(db, accounting); err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "No data available"})
 			} else {
 				c.JSON(http.StatusOK, data)
@@ -209,7 +128,7 @@ func StartWebserver(db *sql.DB, bufferDatabaseMutex *sync.RWMutex, shutdownChan
 	})
 
 	router.GET("/active-processes", func(c *gin.Context) { // Get all ActiveProcesses on the database, or within a timeframe
-		SaveBufferToDatabase(db, bufferDatabaseMutex)
+		trafficMeter.Flush()
 		// Get the dates in Unix Epoch from query parameters
 		initialDate := c.DefaultQuery("initialDate", "")
 		endDate := c.DefaultQuery("endDate", "")
@@ -228,14 +147,14 @@ func StartWebserver(db *sql.DB, bufferDatabaseMutex *sync.RWMutex, shutdownChan
 			}
 
 			// Get all active processes by time
-			if data, err := GetActiveProcessesByTime(db, initialDateInt, endDateInt); err != nil {
+			if data, err := GetActiveProcessesByTime(db, rules, initialDateInt, endDateInt); err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": err})
 			} else {
 				c.JSON(http.StatusOK, data)
 			}
 		} else {
 			// Get all active processes
-			if data, err := GetActiveProcesses(db); err != nil {
+			if data, err := GetActiveProcesses(db, rules); err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": err})
 			} else {
 				c.JSON(http.StatusOK, data)
@@ -243,7 +162,7 @@ func StartWebserver(db *sql.DB, bufferDatabaseMutex *sync.RWMutex, shutdownChan
 		}
 	})
 	router.GET("/active-processes/:name", func(c *gin.Context) { // Get all ActiveProcesses by name on the database, or within a timeframe
-		SaveBufferToDatabase(db, bufferDatabaseMutex)
+		trafficMeter.Flush()
 		// Get the active process' name from path parameters
 		name := c.Param("name")
 
@@ -265,14 +184,14 @@ func StartWebserver(db *sql.DB, bufferDatabaseMutex *sync.RWMutex, shutdownChan
 			}
 
 			// Get all active processes by name and time
-			if data, err := GetActiveProcessByNameAndTime(db, name, initialDateInt, endDateInt); err != nil {
+			if data, err := GetActiveProcessByNameAndTime(db, rules, name, initialDateInt, endDateInt); err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": err})
 			} else {
 				c.JSON(http.StatusOK, data)
 			}
 		} else {
 			// Get all active processes by name
-			if data, err := GetActiveProcessByName(db, name); err != nil {
+			if data, err := GetActiveProcessByName(db, rules, name); err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": err})
 			} else {
 				c.JSON(http.StatusOK, data)
@@ -280,7 +199,14 @@ func StartWebserver(db *sql.DB, bufferDatabaseMutex *sync.RWMutex, shutdownChan
 		}
 	})
 	router.GET("/active-processes/statistics/:name", func(c *gin.Context) { // Get network throughput of a certain active process based (or not) on a timeframe
-		SaveBufferToDatabase(db, bufferDatabaseMutex)
+		trafficMeter.Flush()
+		// Get the accounting mode of the statistics from query parameters
+		accounting, err := accountingMode(c, trafficMeter)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for accounting"})
+			return
+		}
+
 		// Get the active process' name from path parameters
 		name := c.Param("name")
 
@@ -302,25 +228,38 @@ func StartWebserver(db *sql.DB, bufferDatabaseMutex *sync.RWMutex, shutdownChan
 			}
 
 			// Get active processes statistics by name and time
-			if data, err := GetActiveProcessesThroughputByNameAndTime(db, name, initialDateInt, endDateInt); err != nil {
+			if data, err := GetActiveProcessesThroughputByNameAndTime(db, accounting, name, initialDateInt, endDateInt); err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "No data available"})
 			} else {
 				c.JSON(http.StatusOK, data)
 			}
 		} else {
 			// Get active processes statistics by name
-			if data, err := GetActiveProcessesThroughputByName(db, name); err != nil {
+			if data, err := GetActiveProcessesThroughputByName(db, accounting, name); err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "No data available"})
 			} else {
 				c.JSON(http.StatusOK, data)
 			}
 		}
 	})
-	router.GET("/active-processes/statistics/entries", func(c *gin.Context) { // Get network throughput of active processes entries based (or not) on a timeframe
-		SaveBufferToDatabase(db, bufferDatabaseMutex)
+	router.GET("/active-processes/statistics/entries", func(c *gin.Context) { // Get network throughput of active processes entries based (or not) on a timeframe, as a flat list or nested under their applications
+		trafficMeter.Flush()
+		// Get the accounting mode of the statistics from query parameters
+		accounting, err := accountingMode(c, trafficMeter)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for accounting"})
+			return
+		}
+
 		// Get the dates in Unix Epoch from query parameters
 		initialDate := c.DefaultQuery("initialDate", "")
 		endDate := c.DefaultQuery("endDate", "")
+		view := c.DefaultQuery("view", "flat")
+
+		if view != "flat" && view != "tree" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for view"})
+			return
+		}
 
 		// Check which query to run, depending if the dates were provided
 		if initialDate != "" && endDate != "" {
@@ -336,14 +275,24 @@ func StartWebserver(db *sql.DB, bufferDatabaseMutex *sync.RWMutex, shutdownChan
 			}
 
 			// Get active processes statistics by entry and time
-			if data, err := GetActiveProcessesThroughputByEntryAndTime(db, initialDateInt, endDateInt); err != nil {
+			getStatistics := GetActiveProcessesThroughputByEntryAndTime
+			if view == "tree" {
+				getStatistics = GetActiveProcessesThroughputTreeAndTime
+			}
+
+			if data, err := getStatistics(db, accounting, initialDateInt, endDateInt); err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "No data available"})
 			} else {
 				c.JSON(http.StatusOK, data)
 			}
 		} else {
 			// Get active processes statistics by entry
-			if data, err := GetActiveProcessesThroughputByEntry(db); err != nil {
+			getStatistics := GetActiveProcessesThroughputByEntry
+			if view == "tree" {
+				getStatistics = GetActiveProcessesThroughputTree
+			}
+
+			if data, err := getStatistics(db, accounting); err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "No data available"})
 			} else {
 				c.JSON(http.StatusOK, data)
@@ -351,11 +300,13 @@ func StartWebserver(db *sql.DB, bufferDatabaseMutex *sync.RWMutex, shutdownChan
 		}
 	})
 
-	router.GET("/processes", func(c *gin.Context) { // Get all Processes on the database, or within a timeframe
-		SaveBufferToDatabase(db, bufferDatabaseMutex)
-		// Get the dates in Unix Epoch from query parameters
+	router.GET("/processes", func(c *gin.Context) { // Get all Processes on the database, or within a timeframe. The exe and user query parameters filter the processes by their metadata
+		trafficMeter.Flush()
+		// Get the dates in Unix Epoch and the metadata filters from query parameters
 		initialDate := c.DefaultQuery("initialDate", "")
 		endDate := c.DefaultQuery("endDate", "")
+		exe := c.DefaultQuery("exe", "")
+		user := c.DefaultQuery("user", "")
 
 		// Check which query to run, depending if the dates were provided
 		if initialDate != "" && endDate != "" {
@@ -370,6 +321,16 @@ func StartWebserver(db *sql.DB, bufferDatabaseMutex *sync.RWMutex, shutdownChan
 				return
 			}
 
+			if exe != "" || user != "" {
+				// Get all processes by metadata and time
+				if data, err := GetProcessesByMetadataAndTime(db, exe, user, initialDateInt, endDateInt); err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+				} else {
+					c.JSON(http.StatusOK, data)
+				}
+				return
+			}
+
 			// Get all processes by time
 			if data, err := GetProcessesByTime(db, initialDateInt, endDateInt); err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": err})
@@ -377,6 +338,16 @@ func StartWebserver(db *sql.DB, bufferDatabaseMutex *sync.RWMutex, shutdownChan
 				c.JSON(http.StatusOK, data)
 			}
 		} else {
+			if exe != "" || user != "" {
+				// Get all processes by metadata
+				if data, err := GetProcessesByMetadata(db, exe, user); err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+				} else {
+					c.JSON(http.StatusOK, data)
+				}
+				return
+			}
+
 			// Get all processes
 			if data, err := GetProcesses(db); err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": err})
@@ -385,19 +356,31 @@ func StartWebserver(db *sql.DB, bufferDatabaseMutex *sync.RWMutex, shutdownChan
 			}
 		}
 	})
-	router.GET("/processes/:pid", func(c *gin.Context) { // Get all Processes by PID on the database, or within a timeframe
-		SaveBufferToDatabase(db, bufferDatabaseMutex)
-		var pidInt int // Variable for storing the PID's value as int
+	router.GET("/processes/:pid", func(c *gin.Context) { // Get all Processes by PID on the database, or within a timeframe. The creationTime query parameter selects a single process instance
+		trafficMeter.Flush()
+		var (
+			pidInt          int   // Variable for storing the PID's value as int
+			creationTimeInt int64 // Variable for storing the process instance's creation time as int
+		)
 
 		// Get the PID value from path parameters
 		pid := c.Param("pid")
 
-		// Get the dates in Unix Epoch from query parameters
+		// Get the dates in Unix Epoch and the creation time from query parameters
 		initialDate := c.DefaultQuery("initialDate", "")
 		endDate := c.DefaultQuery("endDate", "")
+		creationTime := c.DefaultQuery("creationTime", "")
 
 		if pidInt, err = strconv.Atoi(pid); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for pid"})
+			return
+		}
+
+		if creationTime != "" {
+			if creationTimeInt, err = strconv.ParseInt(creationTime, 10, 64); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for creationTime"})
+				return
+			}
 		}
 
 		// Check which query to run, depending if the dates were provided
@@ -413,6 +396,16 @@ func StartWebserver(db *sql.DB, bufferDatabaseMutex *sync.RWMutex, shutdownChan
 				return
 			}
 
+			if creationTime != "" {
+				// Get a process instance by time
+				if data, err := GetProcessesByInstanceAndTime(db, pidInt, creationTimeInt, initialDateInt, endDateInt); err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+				} else {
+					c.JSON(http.StatusOK, data)
+				}
+				return
+			}
+
 			// Get all processes by pid and time
 			if data, err := GetProcessesByPidAndTime(db, pidInt, initialDateInt, endDateInt); err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": err})
@@ -420,6 +413,16 @@ func StartWebserver(db *sql.DB, bufferDatabaseMutex *sync.RWMutex, shutdownChan
 				c.JSON(http.StatusOK, data)
 			}
 		} else {
+			if creationTime != "" {
+				// Get a process instance
+				if data, err := GetProcessesByInstance(db, pidInt, creationTimeInt); err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+				} else {
+					c.JSON(http.StatusOK, data)
+				}
+				return
+			}
+
 			// Get all processes by pid
 			if data, err := GetProcessesByPid(db, pidInt); err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": err})
@@ -428,14 +431,31 @@ func StartWebserver(db *sql.DB, bufferDatabaseMutex *sync.RWMutex, shutdownChan
 			}
 		}
 	})
-	router.GET("/processes/statistics/:pid", func(c *gin.Context) { // Get network throughput of a certain process based (or not) on a timeframe
-		SaveBufferToDatabase(db, bufferDatabaseMutex)
+	router.GET("/processes/statistics/:pid", func(c *gin.Context) { // Get network throughput of each instance of a certain process based (or not) on a timeframe. The creationTime query parameter selects a single instance
+		trafficMeter.Flush()
+		// Get the accounting mode of the statistics from query parameters
+		accounting, err := accountingMode(c, trafficMeter)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for accounting"})
+			return
+		}
+
+		var creationTimeInt int64 // Variable for storing the process instance's creation time as int
+
 		// Get the active process' name from path parameters
 		pid := c.Param("pid")
 
-		// Get the dates in Unix Epoch from query parameters
+		// Get the dates in Unix Epoch and the creation time from query parameters
 		initialDate := c.DefaultQuery("initialDate", "")
 		endDate := c.DefaultQuery("endDate", "")
+		creationTime := c.DefaultQuery("creationTime", "")
+
+		if creationTime != "" {
+			if creationTimeInt, err = strconv.ParseInt(creationTime, 10, 64); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for creationTime"})
+				return
+			}
+		}
 
 		// Check which query to run, depending if the dates were provided
 		if initialDate != "" && endDate != "" {
@@ -450,26 +470,59 @@ func StartWebserver(db *sql.DB, bufferDatabaseMutex *sync.RWMutex, shutdownChan
 				return
 			}
 
+			if creationTime != "" {
+				// Get a process instance's statistics by time
+				if data, err := GetProcessesThroughputByInstanceAndTime(db, accounting, pid, creationTimeInt, initialDateInt, endDateInt); err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "No data available"})
+				} else {
+					c.JSON(http.StatusOK, data)
+				}
+				return
+			}
+
 			// Get processes statistics by PID and time
-			if data, err := GetProcessesThroughputByPidAndTime(db, pid, initialDateInt, endDateInt); err != nil {
+			if data, err := GetProcessesThroughputByPidAndTime(db, accounting, pid, initialDateInt, endDateInt); err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "No data available"})
 			} else {
 				c.JSON(http.StatusOK, data)
 			}
 		} else {
+			if creationTime != "" {
+				// Get a process instance's statistics
+				if data, err := GetProcessesThroughputByInstance(db, accounting, pid, creationTimeInt); err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "No data available"})
+				} else {
+					c.JSON(http.StatusOK, data)
+				}
+				return
+			}
+
 			// Get processes statistics by PIDs
-			if data, err := GetProcessesThroughputByPid(db, pid); err != nil {
+			if data, err := GetProcessesThroughputByPid(db, accounting, pid); err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "No data available"})
 			} else {
 				c.JSON(http.StatusOK, data)
 			}
 		}
 	})
-	router.GET("/processes/statistics/entries", func(c *gin.Context) { // Get network throughput of processes entries based (or not) on a timeframe
-		SaveBufferToDatabase(db, bufferDatabaseMutex)
+	router.GET("/processes/statistics/entries", func(c *gin.Context) { // Get network throughput of processes entries based (or not) on a timeframe, grouped by process instance, executable or user
+		trafficMeter.Flush()
+		// Get the accounting mode of the statistics from query parameters
+		accounting, err := accountingMode(c, trafficMeter)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for accounting"})
+			return
+		}
+
 		// Get the dates in Unix Epoch from query parameters
 		initialDate := c.DefaultQuery("initialDate", "")
 		endDate := c.DefaultQuery("endDate", "")
+		group := c.DefaultQuery("group", "instance")
+
+		if group != "instance" && group != "exe" && group != "user" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for group"})
+			return
+		}
 
 		// Check which query to run, depending if the dates were provided
 		if initialDate != "" && endDate != "" {
@@ -485,24 +538,50 @@ func StartWebserver(db *sql.DB, bufferDatabaseMutex *sync.RWMutex, shutdownChan
 			}
 
 			// Get processes statistics by entry and time
-			if data, err := GetProcessesThroughputByEntryAndTime(db, initialDateInt, endDateInt); err != nil {
+			getStatistics := GetProcessesThroughputByEntryAndTime
+			if group != "instance" {
+				getStatistics = func(db *sql.DB, accounting string, initialDate, endDate int64) (interface{}, error) {
+					return GetProcessesThroughputByGroupAndTime(db, accounting, group, initialDate, endDate)
+				}
+			}
+
+			if data, err := getStatistics(db, accounting, initialDateInt, endDateInt); err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "No data available"})
 			} else {
 				c.JSON(http.StatusOK, data)
 			}
 		} else {
 			// Get processes statistics by entry
-			if data, err := GetProcessesThroughputByEntry(db); err != nil {
+			getStatistics := GetProcessesThroughputByEntry
+			if group != "instance" {
+				getStatistics = func(db *sql.DB, accounting string) (interface{}, error) {
+					return GetProcessesThroughputByGroup(db, accounting, group)
+				}
+			}
+
+			if data, err := getStatistics(db, accounting); err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "No data available"})
 			} else {
 				c.JSON(http.StatusOK, data)
 			}
 		}
 	})
+	router.GET("/processes/metadata", func(c *gin.Context) { // Get the executable, command line, user and parent of the process instances, filtered (or not) by executable or user
+		trafficMeter.Flush()
+		// Get the metadata filters from query parameters
+		exe := c.DefaultQuery("exe", "")
+		user := c.DefaultQuery("user", "")
+
+		if data, err := GetProcessMetadata(db, exe, user); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		} else {
+			c.JSON(http.StatusOK, data)
+		}
+	})
 
 	router.GET("/protocols", func(c *gin.Context) { // Get all Protocols on the database, or within a timeframe
-		SaveBufferToDatabase(db, bufferDatabaseMutex)
-		SaveBufferToDatabase(db, bufferDatabaseMutex)
+		trafficMeter.Flush()
+		trafficMeter.Flush()
 		// Get the dates in Unix Epoch from query parameters
 		initialDate := c.DefaultQuery("initialDate", "")
 		endDate := c.DefaultQuery("endDate", "")
@@ -536,7 +615,7 @@ func StartWebserver(db *sql.DB, bufferDatabaseMutex *sync.RWMutex, shutdownChan
 		}
 	})
 	router.GET("/protocols/:protocol", func(c *gin.Context) { // Get all Protocols by name on the database, or within a timeframe
-		SaveBufferToDatabase(db, bufferDatabaseMutex)
+		trafficMeter.Flush()
 		// Get the protocol name from the path parameters
 		protocol := c.Param("protocol")
 
@@ -573,7 +652,14 @@ func StartWebserver(db *sql.DB, bufferDatabaseMutex *sync.RWMutex, shutdownChan
 		}
 	})
 	router.GET("/protocols/statistics/:name", func(c *gin.Context) { // Get network throughput of a certain protocol based (or not) on a timeframe
-		SaveBufferToDatabase(db, bufferDatabaseMutex)
+		trafficMeter.Flush()
+		// Get the accounting mode of the statistics from query parameters
+		accounting, err := accountingMode(c, trafficMeter)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for accounting"})
+			return
+		}
+
 		// Get the active process' name from path parameters
 		name := c.Param("name")
 
@@ -595,25 +681,38 @@ func StartWebserver(db *sql.DB, bufferDatabaseMutex *sync.RWMutex, shutdownChan
 			}
 
 			// Get protocols statistics by name and time
-			if data, err := GetProtocolsThroughputByNameAndTime(db, name, initialDateInt, endDateInt); err != nil {
+			if data, err := GetProtocolsThroughputByNameAndTime(db, accounting, name, initialDateInt, endDateInt); err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "No data available"})
 			} else {
 				c.JSON(http.StatusOK, data)
 			}
 		} else {
 			// Get protocols statistics by name
-			if data, err := GetProtocolsThroughputByName(db, name); err != nil {
+			if data, err := GetProtocolsThroughputByName(db, accounting, name); err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "No data available"})
 			} else {
 				c.JSON(http.StatusOK, data)
 			}
 		}
 	})
-	router.GET("/protocols/statistics/entries", func(c *gin.Context) { // Get network throughput of protocols entries based (or not) on a timeframe
-		SaveBufferToDatabase(db, bufferDatabaseMutex)
+	router.GET("/protocols/statistics/entries", func(c *gin.Context) { // Get network throughput of protocols entries based (or not) on a timeframe, grouped by protocol or service
+		trafficMeter.Flush()
+		// Get the accounting mode of the statistics from query parameters
+		accounting, err := accountingMode(c, trafficMeter)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for accounting"})
+			return
+		}
+
 		// Get the dates in Unix Epoch from query parameters
 		initialDate := c.DefaultQuery("initialDate", "")
 		endDate := c.DefaultQuery("endDate", "")
+		group := c.DefaultQuery("group", "protocol")
+
+		if group != "protocol" && group != "service" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for group"})
+			return
+		}
 
 		// Check which query to run, depending if the dates were provided
 		if initialDate != "" && endDate != "" {
@@ -629,14 +728,24 @@ func StartWebserver(db *sql.DB, bufferDatabaseMutex *sync.RWMutex, shutdownChan
 			}
 
 			// Get protocols statistics by entry and time
-			if data, err := GetProtocolsThroughputByEntryAndTime(db, initialDateInt, endDateInt); err != nil {
+			getStatistics := GetProtocolsThroughputByEntryAndTime
+			if group == "service" {
+				getStatistics = GetProtocolsThroughputByServiceAndTime
+			}
+
+			if data, err := getStatistics(db, accounting, initialDateInt, endDateInt); err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "No data available"})
 			} else {
 				c.JSON(http.StatusOK, data)
 			}
 		} else {
 			// Get protocols statistics by entry
-			if data, err := GetProtocolsThroughputByEntry(db); err != nil {
+			getStatistics := GetProtocolsThroughputByEntry
+			if group == "service" {
+				getStatistics = GetProtocolsThroughputByService
+			}
+
+			if data, err := getStatistics(db, accounting); err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "No data available"})
 			} else {
 				c.JSON(http.StatusOK, data)
@@ -645,7 +754,7 @@ func StartWebserver(db *sql.DB, bufferDatabaseMutex *sync.RWMutex, shutdownChan
 	})
 
 	router.GET("/hosts", func(c *gin.Context) { // Get all Hosts on the database, or within a timeframe
-		SaveBufferToDatabase(db, bufferDatabaseMutex)
+		trafficMeter.Flush()
 		// Get the dates in Unix Epoch from query parameters
 		initialDate := c.DefaultQuery("initialDate", "")
 		endDate := c.DefaultQuery("endDate", "")
@@ -679,7 +788,7 @@ func StartWebserver(db *sql.DB, bufferDatabaseMutex *sync.RWMutex, shutdownChan
 		}
 	})
 	router.GET("/hosts/:host", func(c *gin.Context) { // Get all Hosts by name on the database, or within a timeframe
-		SaveBufferToDatabase(db, bufferDatabaseMutex)
+		trafficMeter.Flush()
 		// Get the host name from path parameters
 		host := c.Param("host")
 
@@ -716,7 +825,14 @@ func StartWebserver(db *sql.DB, bufferDatabaseMutex *sync.RWMutex, shutdownChan
 		}
 	})
 	router.GET("/hosts/statistics/:name", func(c *gin.Context) { // Get network throughput of a certain host based (or not) on a timeframe
-		SaveBufferToDatabase(db, bufferDatabaseMutex)
+		trafficMeter.Flush()
+		// Get the accounting mode of the statistics from query parameters
+		accounting, err := accountingMode(c, trafficMeter)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for accounting"})
+			return
+		}
+
 		// Get the active process' name from path parameters
 		name := c.Param("name")
 
@@ -738,14 +854,14 @@ func StartWebserver(db *sql.DB, bufferDatabaseMutex *sync.RWMutex, shutdownChan
 			}
 
 			// Get hosts statistics by name and time
-			if data, err := GetHostsThroughputByNameAndTime(db, name, initialDateInt, endDateInt); err != nil {
+			if data, err := GetHostsThroughputByNameAndTime(db, accounting, name, initialDateInt, endDateInt); err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "No data available"})
 			} else {
 				c.JSON(http.StatusOK, data)
 			}
 		} else {
 			// Get hosts statistics by name
-			if data, err := GetHostsThroughputByName(db, name); err != nil {
+			if data, err := GetHostsThroughputByName(db, accounting, name); err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "No data available"})
 			} else {
 				c.JSON(http.StatusOK, data)
@@ -753,7 +869,14 @@ func StartWebserver(db *sql.DB, bufferDatabaseMutex *sync.RWMutex, shutdownChan
 		}
 	})
 	router.GET("/hosts/statistics/entries", func(c *gin.Context) { // Get network throughput of host entries based (or not) on a timeframe
-		SaveBufferToDatabase(db, bufferDatabaseMutex)
+		trafficMeter.Flush()
+		// Get the accounting mode of the statistics from query parameters
+		accounting, err := accountingMode(c, trafficMeter)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for accounting"})
+			return
+		}
+
 		// Get the dates in Unix Epoch from query parameters
 		initialDate := c.DefaultQuery("initialDate", "")
 		endDate := c.DefaultQuery("endDate", "")
@@ -772,14 +895,335 @@ func StartWebserver(db *sql.DB, bufferDatabaseMutex *sync.RWMutex, shutdownChan
 			}
 
 			// Get hosts statistics by entry and time
-			if data, err := GetHostsThroughputByEntryAndTime(db, initialDateInt, endDateInt); err != nil {
+			if data, err := GetHostsThroughputByEntryAndTime(db, accounting, initialDateInt, endDateInt); err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "No data available"})
 			} else {
 				c.JSON(http.StatusOK, data)
 			}
 		} else {
 			// Get hosts statistics by entry
-			if data, err := GetHostsThroughputByEntry(db); err != nil {
+			if data, err := GetHostsThroughputByEntry(db, accounting); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "No data available"})
+			} else {
+				c.JSON(http.StatusOK, data)
+			}
+		}
+	})
+
+	router.GET("/cgroups", func(c *gin.Context) { // Get all Cgroups on the database, or within a timeframe
+		trafficMeter.Flush()
+		// Get the dates in Unix Epoch from query parameters
+		initialDate := c.DefaultQuery("initialDate", "")
+		endDate := c.DefaultQuery("endDate", "")
+
+		// Check which query to run, depending if the dates were provided
+		if initialDate != "" && endDate != "" {
+			// Convert the dates to int
+			if initialDateInt, err = strconv.ParseInt(initialDate, 10, 64); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for initialDate"})
+				return
+			}
+
+			if endDateInt, err = strconv.ParseInt(endDate, 10, 64); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for endDate"})
+				return
+			}
+
+			// Get all cgroups by time
+			if data, err := GetCgroupsByTime(db, initialDateInt, endDateInt); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+			} else {
+				c.JSON(http.StatusOK, data)
+			}
+		} else {
+			// Get all cgroups
+			if data, err := GetCgroups(db); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+			} else {
+				c.JSON(http.StatusOK, data)
+			}
+		}
+	})
+	router.GET("/cgroups/:cgroup", func(c *gin.Context) { // Get all Cgroups by name on the database, or within a timeframe. Names contain a slash, sent escaped as "docker%2F<id>"
+		trafficMeter.Flush()
+		// Get the cgroup name from path parameters
+		cgroup := c.Param("cgroup")
+
+		// Get the dates in Unix Epoch from query parameters
+		initialDate := c.DefaultQuery("initialDate", "")
+		endDate := c.DefaultQuery("endDate", "")
+
+		// Check which query to run, depending if the dates were provided
+		if initialDate != "" && endDate != "" {
+			// Convert the dates to int
+			if initialDateInt, err = strconv.ParseInt(initialDate, 10, 64); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for initialDate"})
+				return
+			}
+
+			if endDateInt, err = strconv.ParseInt(endDate, 10, 64); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for endDate"})
+				return
+			}
+
+			// Get all cgroups by name and time
+			if data, err := GetCgroupsByNameAndTime(db, cgroup, initialDateInt, endDateInt); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+			} else {
+				c.JSON(http.StatusOK, data)
+			}
+		} else {
+			// Get all cgroups by name
+			if data, err := GetCgroupsByName(db, cgroup); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+			} else {
+				c.JSON(http.StatusOK, data)
+			}
+		}
+	})
+	router.GET("/cgroups/statistics/:name", func(c *gin.Context) { // Get network throughput of a certain container or systemd unit based (or not) on a timeframe
+		trafficMeter.Flush()
+		// Get the accounting mode of the statistics from query parameters
+		accounting, err := accountingMode(c, trafficMeter)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for accounting"})
+			return
+		}
+
+		// Get the cgroup name from path parameters
+		name := c.Param("name")
+
+		// Get the dates in Unix Epoch from query parameters
+		initialDate := c.DefaultQuery("initialDate", "")
+		endDate := c.DefaultQuery("endDate", "")
+
+		// Check which query to run, depending if the dates were provided
+		if initialDate != "" && endDate != "" {
+			// Convert the dates to int
+			if initialDateInt, err = strconv.ParseInt(initialDate, 10, 64); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for initialDate"})
+				return
+			}
+
+			if endDateInt, err = strconv.ParseInt(endDate, 10, 64); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for endDate"})
+				return
+			}
+
+			// Get cgroups statistics by name and time
+			if data, err := GetCgroupsThroughputByNameAndTime(db, accounting, name, initialDateInt, endDateInt); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "No data available"})
+			} else {
+				c.JSON(http.StatusOK, data)
+			}
+		} else {
+			// Get cgroups statistics by name
+			if data, err := GetCgroupsThroughputByName(db, accounting, name); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "No data available"})
+			} else {
+				c.JSON(http.StatusOK, data)
+			}
+		}
+	})
+	router.GET("/cgroups/statistics/entries", func(c *gin.Context) { // Get network throughput of container and systemd unit entries based (or not) on a timeframe
+		trafficMeter.Flush()
+		// Get the accounting mode of the statistics from query parameters
+		accounting, err := accountingMode(c, trafficMeter)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for accounting"})
+			return
+		}
+
+		// Get the dates in Unix Epoch from query parameters
+		initialDate := c.DefaultQuery("initialDate", "")
+		endDate := c.DefaultQuery("endDate", "")
+
+		// Check which query to run, depending if the dates were provided
+		if initialDate != "" && endDate != "" {
+			// Convert the dates to int
+			if initialDateInt, err = strconv.ParseInt(initialDate, 10, 64); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for initialDate"})
+				return
+			}
+
+			if endDateInt, err = strconv.ParseInt(endDate, 10, 64); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for endDate"})
+				return
+			}
+
+			// Get cgroups statistics by entry and time
+			if data, err := GetCgroupsThroughputByEntryAndTime(db, accounting, initialDateInt, endDateInt); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "No data available"})
+			} else {
+				c.JSON(http.StatusOK, data)
+			}
+		} else {
+			// Get cgroups statistics by entry
+			if data, err := GetCgroupsThroughputByEntry(db, accounting); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "No data available"})
+			} else {
+				c.JSON(http.StatusOK, data)
+			}
+		}
+	})
+
+	router.GET("/users", func(c *gin.Context) { // Get all Users on the database, or within a timeframe
+		trafficMeter.Flush()
+		// Get the dates in Unix Epoch from query parameters
+		initialDate := c.DefaultQuery("initialDate", "")
+		endDate := c.DefaultQuery("endDate", "")
+
+		// Check which query to run, depending if the dates were provided
+		if initialDate != "" && endDate != "" {
+			// Convert the dates to int
+			if initialDateInt, err = strconv.ParseInt(initialDate, 10, 64); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for initialDate"})
+				return
+			}
+
+			if endDateInt, err = strconv.ParseInt(endDate, 10, 64); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for endDate"})
+				return
+			}
+
+			// Get all users by time
+			if data, err := GetUsersByTime(db, initialDateInt, endDateInt); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+			} else {
+				c.JSON(http.StatusOK, data)
+			}
+		} else {
+			// Get all users
+			if data, err := GetUsers(db); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+			} else {
+				c.JSON(http.StatusOK, data)
+			}
+		}
+	})
+	router.GET("/users/:uid", func(c *gin.Context) { // Get all Users by UID on the database, or within a timeframe
+		trafficMeter.Flush()
+		var uidInt int // Variable for storing the UID's value as int
+
+		// Get the UID value from path parameters
+		uid := c.Param("uid")
+
+		// Get the dates in Unix Epoch from query parameters
+		initialDate := c.DefaultQuery("initialDate", "")
+		endDate := c.DefaultQuery("endDate", "")
+
+		if uidInt, err = strconv.Atoi(uid); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for uid"})
+			return
+		}
+
+		// Check which query to run, depending if the dates were provided
+		if initialDate != "" && endDate != "" {
+			// Convert the dates to int
+			if initialDateInt, err = strconv.ParseInt(initialDate, 10, 64); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for initialDate"})
+				return
+			}
+
+			if endDateInt, err = strconv.ParseInt(endDate, 10, 64); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for endDate"})
+				return
+			}
+
+			// Get all users by uid and time
+			if data, err := GetUsersByUidAndTime(db, uidInt, initialDateInt, endDateInt); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+			} else {
+				c.JSON(http.StatusOK, data)
+			}
+		} else {
+			// Get all users by uid
+			if data, err := GetUsersByUid(db, uidInt); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+			} else {
+				c.JSON(http.StatusOK, data)
+			}
+		}
+	})
+	router.GET("/users/statistics/:uid", func(c *gin.Context) { // Get network throughput of a certain user based (or not) on a timeframe
+		trafficMeter.Flush()
+		// Get the accounting mode of the statistics from query parameters
+		accounting, err := accountingMode(c, trafficMeter)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for accounting"})
+			return
+		}
+
+		// Get the UID from path parameters
+		uid := c.Param("uid")
+
+		// Get the dates in Unix Epoch from query parameters
+		initialDate := c.DefaultQuery("initialDate", "")
+		endDate := c.DefaultQuery("endDate", "")
+
+		// Check which query to run, depending if the dates were provided
+		if initialDate != "" && endDate != "" {
+			// Convert the dates to int
+			if initialDateInt, err = strconv.ParseInt(initialDate, 10, 64); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for initialDate"})
+				return
+			}
+
+			if endDateInt, err = strconv.ParseInt(endDate, 10, 64); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for endDate"})
+				return
+			}
+
+			// Get users statistics by UID and time
+			if data, err := GetUsersThroughputByUidAndTime(db, accounting, uid, initialDateInt, endDateInt); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "No data available"})
+			} else {
+				c.JSON(http.StatusOK, data)
+			}
+		} else {
+			// Get users statistics by UID
+			if data, err := GetUsersThroughputByUid(db, accounting, uid); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "No data available"})
+			} else {
+				c.JSON(http.StatusOK, data)
+			}
+		}
+	})
+	router.GET("/users/statistics/entries", func(c *gin.Context) { // Get network throughput of user entries based (or not) on a timeframe
+		trafficMeter.Flush()
+		// Get the accounting mode of the statistics from query parameters
+		accounting, err := accountingMode(c, trafficMeter)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for accounting"})
+			return
+		}
+
+		// Get the dates in Unix Epoch from query parameters
+		initialDate := c.DefaultQuery("initialDate", "")
+		endDate := c.DefaultQuery("endDate", "")
+
+		// Check which query to run, depending if the dates were provided
+		if initialDate != "" && endDate != "" {
+			// Convert the dates to int
+			if initialDateInt, err = strconv.ParseInt(initialDate, 10, 64); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for initialDate"})
+				return
+			}
+
+			if endDateInt, err = strconv.ParseInt(endDate, 10, 64); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for endDate"})
+				return
+			}
+
+			// Get users statistics by entry and time
+			if data, err := GetUsersThroughputByEntryAndTime(db, accounting, initialDateInt, endDateInt); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "No data available"})
+			} else {
+				c.JSON(http.StatusOK, data)
+			}
+		} else {
+			// Get users statistics by entry
+			if data, err := GetUsersThroughputByEntry(db, accounting); err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "No data available"})
 			} else {
 				c.JSON(http.StatusOK, data)
@@ -787,6 +1231,149 @@ func StartWebserver(db *sql.DB, bufferDatabaseMutex *sync.RWMutex, shutdownChan
 		}
 	})
 
+	router.GET("/applications/statistics/entries", func(c *gin.Context) { // Get network throughput of the applications matched by the application rules based (or not) on a timeframe, by application or nested under their category
+		trafficMeter.Flush()
+		// Get the accounting mode of the statistics from query parameters
+		accounting, err := accountingMode(c, trafficMeter)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for accounting"})
+			return
+		}
+
+		// Get the dates in Unix Epoch from query parameters
+		initialDate := c.DefaultQuery("initialDate", "")
+		endDate := c.DefaultQuery("endDate", "")
+		group := c.DefaultQuery("group", "application")
+
+		if group != "application" && group != "category" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for group"})
+			return
+		}
+
+		// Check which query to run, depending if the dates were provided
+		if initialDate != "" && endDate != "" {
+			// Convert the dates to int
+			if initialDateInt, err = strconv.ParseInt(initialDate, 10, 64); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for initialDate"})
+				return
+			}
+
+			if endDateInt, err = strconv.ParseInt(endDate, 10, 64); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for endDate"})
+				return
+			}
+
+			// Get applications statistics by group and time
+			if data, err := GetApplicationsThroughputByGroupAndTime(db, rules, accounting, group, initialDateInt, endDateInt); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "No data available"})
+			} else {
+				c.JSON(http.StatusOK, data)
+			}
+		} else {
+			// Get applications statistics by group
+			if data, err := GetApplicationsThroughputByGroup(db, rules, accounting, group); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "No data available"})
+			} else {
+				c.JSON(http.StatusOK, data)
+			}
+		}
+	})
+
+	router.GET("/filters", func(c *gin.Context) { // Get the global BPF filter and the per-interface overrides
+		global, interfaces := trafficMeter.Filters().Filters()
+		c.JSON(http.StatusOK, gin.H{"global": global, "interfaces": interfaces})
+	})
+	router.PUT("/filters", func(c *gin.Context) { // Set the global BPF filter, applied to every interface without an override
+		var body struct {
+			Filter string `json:"filter"`
+		}
+
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for filter"})
+			return
+		}
+
+		if err := trafficMeter.Filters().SetGlobal(body.Filter); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusOK, gin.H{"message": "Filter updated sucessfully"})
+		}
+	})
+	router.PUT("/filters/:interface", func(c *gin.Context) { // Set a BPF filter overriding the global one for an interface
+		var body struct {
+			Filter string `json:"filter"`
+		}
+
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for filter"})
+			return
+		}
+
+		if err := trafficMeter.Filters().SetInterface(c.Param("interface"), body.Filter); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusOK, gin.H{"message": "Filter updated sucessfully"})
+		}
+	})
+	router.DELETE("/filters/:interface", func(c *gin.Context) { // Remove an interface's BPF filter, so the global one is applied
+		if err := trafficMeter.Filters().RemoveInterface(c.Param("interface")); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusOK, gin.H{"message": "Filter removed sucessfully"})
+		}
+	})
+
+	router.GET("/rules", func(c *gin.Context) { // Get the application rules, in evaluation order
+		c.JSON(http.StatusOK, rules.Rules())
+	})
+	router.POST("/rules", func(c *gin.Context) { // Add an application rule, evaluated after the existing ones
+		var rule meter.ApplicationRule
+
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for rule"})
+			return
+		}
+
+		if rule, err := rules.Add(rule); err != nil {
+			c.JSON(rulesErrorStatus(err), gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusOK, rule)
+		}
+	})
+	router.PUT("/rules/:id", func(c *gin.Context) { // Replace an application rule, keeping its position
+		var rule meter.ApplicationRule
+
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for id"})
+			return
+		}
+
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for rule"})
+			return
+		}
+
+		if rule, err := rules.Update(id, rule); err != nil {
+			c.JSON(rulesErrorStatus(err), gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusOK, rule)
+		}
+	})
+	router.DELETE("/rules/:id", func(c *gin.Context) { // Remove an application rule
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect value for id"})
+			return
+		}
+
+		if err := rules.Remove(id); err != nil {
+			c.JSON(rulesErrorStatus(err), gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusOK, gin.H{"message": "Rule removed sucessfully"})
+		}
+	})
+
 	router.DELETE("/delete", func(c *gin.Context) { // Remove old entries from database, and free disk space
 		// Get the dates in Unix Epoch from query parameters
 		initialDate := c.DefaultQuery("initialDate", "")
@@ -822,6 +1409,14 @@ func StartWebserver(db *sql.DB, bufferDatabaseMutex *sync.RWMutex, shutdownChan
 
 	})
 
+	router.GET("/coverage", func(c *gin.Context) { // Get the share of each interface's kernel counters attributed to processes
+		c.JSON(http.StatusOK, trafficMeter.Coverage())
+	})
+
+	router.GET("/diagnostics", func(c *gin.Context) { // Get the size of the socket tables and of the pending table
+		c.JSON(http.StatusOK, gin.H{"sockets": trafficMeter.SocketTableStats(), "pending": trafficMeter.PendingStats()})
+	})
+
 	router.GET("/ping", func(c *gin.Context) { // Shutdown the server
 		c.JSON(http.StatusOK, gin.H{"message": "Application is running"})
 	})
@@ -832,5 +1427,22 @@ func StartWebserver(db *sql.DB, bufferDatabaseMutex *sync.RWMutex, shutdownChan
 	})
 
 	// Run the server
-	router.Run("localhost:50000")
+	if err = router.Run(listenAddress); err != nil {
+		log.Fatal("Unable to start webserver: ", err)
+	}
+}
+
+// rulesErrorStatus returns the HTTP status of an error changing the application rules: 500 if the rules file could not be written, 400 otherwise.
+func rulesErrorStatus(err error) int {
+	if errors.Is(err, meter.ErrRulesNotSaved) {
+		return http.StatusInternalServerError
+	}
+	return http.StatusBadRequest
+}
+
+// accountingMode returns the accounting mode of the statistics given in the "accounting" query parameter, or the meter's own mode if not given.
+// Traffic counted in other modes is left out of the statistics, as bytes counted in different modes cannot be summed.
+func accountingMode(c *gin.Context, trafficMeter *meter.Meter) (string, error) {
+	accounting := c.DefaultQuery("accounting", trafficMeter.Accounting())
+	return accounting, meter.ValidateAccounting(accounting)
 }